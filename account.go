@@ -0,0 +1,176 @@
+package main
+
+import "fmt"
+
+type accountState struct {
+	Balance int64
+	Nonce   uint64
+}
+
+// accountSnapshot is an account's state before a block touched it.
+type accountSnapshot struct {
+	Account int
+	State   accountState
+}
+
+// AccountLedger is the Ethereum-style model: each wallet is an account with a
+// balance and a nonce, and a transaction must use the sender's next nonce.
+// Every wallet starts with InitialBalance in the genesis state. The mempool may
+// hold transactions with nonce gaps; they become executable once the missing
+// nonces arrive.
+type AccountLedger struct {
+	accounts map[int]accountState
+	undo     map[string][]accountSnapshot
+	// pending indexes mempool transactions by sender and nonce.
+	pending map[int]map[uint64]string
+}
+
+func NewAccountLedger(n *Node) *AccountLedger {
+	l := &AccountLedger{
+		accounts: make(map[int]accountState),
+		undo:     make(map[string][]accountSnapshot),
+		pending:  make(map[int]map[uint64]string),
+	}
+	for wallet := 0; wallet < n.Cfg.NumWallets; wallet++ {
+		l.accounts[wallet] = accountState{Balance: n.Cfg.InitialBalance}
+	}
+	return l
+}
+
+func (l *AccountLedger) ConnectBlock(b Block) error {
+	snapshots := []accountSnapshot{}
+	touched := make(map[int]bool)
+	touch := func(account int) {
+		if !touched[account] {
+			touched[account] = true
+			snapshots = append(snapshots, accountSnapshot{Account: account, State: l.accounts[account]})
+		}
+	}
+	rollback := func() {
+		for _, s := range snapshots {
+			l.accounts[s.Account] = s.State
+		}
+	}
+
+	for _, tx := range b.Transactions {
+		sender := l.accounts[tx.Sender]
+		if tx.Nonce != sender.Nonce {
+			rollback()
+			return fmt.Errorf("tx %s has nonce %d, account %d expects %d", tx.ID, tx.Nonce, tx.Sender, sender.Nonce)
+		}
+		if sender.Balance < tx.Value+tx.Fee {
+			rollback()
+			return fmt.Errorf("tx %s spends %d but account %d holds %d", tx.ID, tx.Value+tx.Fee, tx.Sender, sender.Balance)
+		}
+		touch(tx.Sender)
+		touch(tx.Recipient)
+		sender.Balance -= tx.Value + tx.Fee
+		sender.Nonce++
+		l.accounts[tx.Sender] = sender
+		recipient := l.accounts[tx.Recipient]
+		recipient.Balance += tx.Value
+		l.accounts[tx.Recipient] = recipient
+	}
+	l.undo[b.Hash] = snapshots
+	return nil
+}
+
+func (l *AccountLedger) DisconnectBlock(b Block) {
+	for _, s := range l.undo[b.Hash] {
+		l.accounts[s.Account] = s.State
+	}
+	delete(l.undo, b.Hash)
+}
+
+// CheckTx rejects transactions whose nonce is already used, on chain or by
+// another mempool transaction. Later nonces are accepted even with a gap.
+func (l *AccountLedger) CheckTx(tx Transaction) error {
+	sender := l.accounts[tx.Sender]
+	if tx.Nonce < sender.Nonce {
+		return ErrConflict
+	}
+	if other, ok := l.pending[tx.Sender][tx.Nonce]; ok && other != tx.ID {
+		return ErrConflict
+	}
+	if sender.Balance < tx.Value+tx.Fee {
+		return ErrConflict
+	}
+	return nil
+}
+
+func (l *AccountLedger) MempoolAdded(tx Transaction) {
+	if l.pending[tx.Sender] == nil {
+		l.pending[tx.Sender] = make(map[uint64]string)
+	}
+	l.pending[tx.Sender][tx.Nonce] = tx.ID
+}
+
+func (l *AccountLedger) MempoolRemoved(tx Transaction) {
+	if l.pending[tx.Sender][tx.Nonce] != tx.ID {
+		return
+	}
+	delete(l.pending[tx.Sender], tx.Nonce)
+	if len(l.pending[tx.Sender]) == 0 {
+		delete(l.pending, tx.Sender)
+	}
+}
+
+// MempoolConflicts returns mempool transactions from b's senders whose nonce
+// is now below the account nonce.
+func (l *AccountLedger) MempoolConflicts(b Block) []string {
+	conflicts := []string{}
+	seen := make(map[int]bool)
+	for _, tx := range b.Transactions {
+		if seen[tx.Sender] {
+			continue
+		}
+		seen[tx.Sender] = true
+		next := l.accounts[tx.Sender].Nonce
+		for nonce, txID := range l.pending[tx.Sender] {
+			if nonce < next {
+				conflicts = append(conflicts, txID)
+			}
+		}
+	}
+	return conflicts
+}
+
+// PackBlock takes the best candidate that is executable next, so a sender's
+// transactions always go in nonce order and gapped ones are left out.
+func (l *AccountLedger) PackBlock(candidates []Transaction, maxBytes int) []Transaction {
+	selectedTxs := []Transaction{}
+	currentBlockSizeBytes := 0
+	selected := make(map[string]bool)
+	state := make(map[int]accountState)
+	account := func(id int) accountState {
+		if s, ok := state[id]; ok {
+			return s
+		}
+		return l.accounts[id]
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, tx := range candidates {
+			if selected[tx.ID] || currentBlockSizeBytes+tx.Size > maxBytes {
+				continue
+			}
+			sender := account(tx.Sender)
+			if tx.Nonce != sender.Nonce || sender.Balance < tx.Value+tx.Fee {
+				continue
+			}
+			sender.Balance -= tx.Value + tx.Fee
+			sender.Nonce++
+			state[tx.Sender] = sender
+			recipient := account(tx.Recipient)
+			recipient.Balance += tx.Value
+			state[tx.Recipient] = recipient
+
+			selected[tx.ID] = true
+			selectedTxs = append(selectedTxs, tx)
+			currentBlockSizeBytes += tx.Size
+			progress = true
+		}
+	}
+	return selectedTxs
+}
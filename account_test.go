@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// accountTestSim returns an account-model network with three wallets of 1000.
+func accountTestSim(t *testing.T) *Simulation {
+	t.Helper()
+	cfg := testConfig(3, 1)
+	cfg.TxModel = TxModelAccount
+	cfg.NumWallets = 3
+	cfg.InitialBalance = 1000
+	return newTestSimulation(t, cfg)
+}
+
+func accountTx(id string, sender, recipient int, nonce uint64, value, fee int64) Transaction {
+	return Transaction{ID: id, Size: 100, Sender: sender, Recipient: recipient, Nonce: nonce, Value: value, Fee: fee, Timestamp: SimulationEpoch}
+}
+
+func balances(l *AccountLedger) string {
+	return fmt.Sprint(l.accounts[0], l.accounts[1], l.accounts[2])
+}
+
+func TestAccountConnectAndDisconnect(t *testing.T) {
+	sim := accountTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*AccountLedger)
+	b := childBlock(n, sim.GenesisBlock.Hash, 1,
+		accountTx("a", 0, 1, 0, 100, 10),
+		accountTx("b", 0, 2, 1, 200, 10),
+		accountTx("c", 1, 0, 0, 1100, 0))
+	if err := ledger.ConnectBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := balances(ledger), "{1780 2} {0 1} {1200 0}"; got != want {
+		t.Errorf("after connecting: accounts %s, want %s", got, want)
+	}
+	ledger.DisconnectBlock(b)
+	if got, want := balances(ledger), "{1000 0} {1000 0} {1000 0}"; got != want {
+		t.Errorf("after disconnecting: accounts %s, want %s", got, want)
+	}
+}
+
+func TestAccountConnectBlockRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		tx   Transaction
+	}{
+		{"nonce gap", accountTx("x", 1, 2, 1, 10, 0)},
+		{"nonce reused", accountTx("x", 0, 2, 0, 10, 0)},
+		{"overspend", accountTx("x", 2, 1, 0, 995, 10)},
+	}
+	for _, tt := range tests {
+		sim := accountTestSim(t)
+		n := sim.Nodes[0]
+		ledger := n.Ledger.(*AccountLedger)
+		b := childBlock(n, sim.GenesisBlock.Hash, 1, accountTx("valid", 0, 1, 0, 100, 0), tt.tx)
+		if err := ledger.ConnectBlock(b); err == nil {
+			t.Errorf("%s: ConnectBlock accepted the block", tt.name)
+		}
+		if got, want := balances(ledger), "{1000 0} {1000 0} {1000 0}"; got != want {
+			t.Errorf("%s: a rejected block left accounts %s, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestAccountCheckTx(t *testing.T) {
+	sim := accountTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*AccountLedger)
+	if err := ledger.ConnectBlock(childBlock(n, sim.GenesisBlock.Hash, 1, accountTx("mined", 0, 1, 0, 100, 0))); err != nil {
+		t.Fatal(err)
+	}
+	pending := accountTx("pending", 0, 1, 1, 100, 0)
+	n.addToMempool(&pending, true)
+
+	tests := []struct {
+		name string
+		tx   Transaction
+		want error
+	}{
+		{"next nonce", accountTx("x", 1, 0, 0, 100, 10), nil},
+		{"nonce gap", accountTx("x", 0, 1, 5, 100, 10), nil},
+		{"same tx again", pending, nil},
+		{"nonce used on chain", accountTx("x", 0, 2, 0, 100, 10), ErrConflict},
+		{"nonce used in mempool", accountTx("x", 0, 2, 1, 100, 10), ErrConflict},
+		{"overspend", accountTx("x", 2, 0, 0, 1000, 1), ErrConflict},
+	}
+	for _, tt := range tests {
+		err := ledger.CheckTx(tt.tx)
+		if (tt.want == nil) != (err == nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: CheckTx = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestAccountPackBlockKeepsNonceOrder(t *testing.T) {
+	sim := accountTestSim(t)
+	ledger := sim.Nodes[0].Ledger.(*AccountLedger)
+	candidates := []Transaction{
+		accountTx("n1", 0, 1, 1, 100, 50),
+		accountTx("gap", 0, 1, 3, 100, 40),
+		accountTx("n0", 0, 1, 0, 100, 1),
+		accountTx("broke", 2, 1, 0, 2000, 1),
+		accountTx("other", 1, 0, 0, 100, 30),
+	}
+	ids := []string{}
+	for _, tx := range ledger.PackBlock(candidates, 1000) {
+		ids = append(ids, tx.ID)
+	}
+	if got, want := fmt.Sprint(ids), "[n0 other n1]"; got != want {
+		t.Errorf("PackBlock = %s, want %s", got, want)
+	}
+}
+
+// TestAccountReorgReplacesNonce moves a node to a branch where the sender's
+// nonce went to another recipient.
+func TestAccountReorgReplacesNonce(t *testing.T) {
+	sim := accountTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*AccountLedger)
+	genesis := sim.GenesisBlock.Hash
+	n.ReceiveBlock(childBlock(n, genesis, 1, accountTx("to-1", 0, 1, 0, 500, 0)), -1)
+	b1 := childBlock(n, genesis, 2, accountTx("to-2", 0, 2, 0, 300, 0))
+	n.ReceiveBlock(b1, -1)
+	n.ReceiveBlock(childBlock(n, b1.Hash, 2), -1)
+
+	if got, want := balances(ledger), "{700 1} {1000 0} {1300 0}"; got != want {
+		t.Errorf("after the reorg: accounts %s, want %s", got, want)
+	}
+	if _, ok := n.Mempool["to-1"]; ok || n.Stats.ConflictingTxDropped != 1 {
+		t.Errorf("replaced tx in mempool = %v, %d conflicts dropped; want false, 1", ok, n.Stats.ConflictingTxDropped)
+	}
+}
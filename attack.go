@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	AttackPending   = ""
+	AttackSucceeded = "succeeded"
+	AttackFailed    = "failed"
+)
+
+// attackTrialBlockLimit caps a trial at this many target block intervals.
+// Trials almost always end long before, when the attacker wins or falls
+// AttackMaxDeficit blocks behind.
+const attackTrialBlockLimit = 1000
+
+// DoubleSpendStrategy pays a merchant on the public chain while privately
+// mining a branch that spends the same coins elsewhere. Following Rosenfeld,
+// the attacker pre-mines: it mines the first conflicting block on the public
+// tip and only sends the payment once it has found it, moving to the new tip
+// if the honest miners get there first. Once the payment has ConfirmDepth
+// confirmations and the private branch is longer than the public one since the
+// fork, the branch is published and the attack succeeds. The attacker gives
+// up when it falls MaxDeficit blocks behind.
+type DoubleSpendStrategy struct {
+	*HonestStrategy
+
+	Merchant     int
+	Payment      Transaction
+	Conflict     Transaction
+	HasConflict  bool
+	ConfirmDepth int
+	MaxDeficit   int
+
+	premining   bool
+	forkPoint   string
+	privateTip  string
+	publicTip   string
+	withheld    []Block
+	Outcome     string
+	ResolvedAt  time.Time
+	BlocksFound int
+}
+
+func (a *DoubleSpendStrategy) Name() string { return "double-spend" }
+
+func (a *DoubleSpendStrategy) ShouldStartMining(n *Node) bool {
+	return a.Outcome == AttackPending
+}
+
+func (a *DoubleSpendStrategy) SelectParent(n *Node) string {
+	return a.privateTip
+}
+
+// SelectTransactions puts the conflicting spend in the first private block.
+func (a *DoubleSpendStrategy) SelectTransactions(n *Node, maxBytes int) []Transaction {
+	if a.privateTip == a.forkPoint && a.HasConflict {
+		return []Transaction{a.Conflict}
+	}
+	return []Transaction{}
+}
+
+func (a *DoubleSpendStrategy) OnBlockFound(n *Node, b Block) {
+	if accepted, _ := n.acceptBlock(b); !accepted {
+		return
+	}
+	a.BlocksFound++
+	a.privateTip = b.Hash
+	a.withheld = append(a.withheld, b)
+	if a.premining {
+		a.premining = false
+		n.Sim.ScheduleEventWithPriority(n.Sim.CurrentTime, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: a.Merchant, FromNodeID: -1, Tx: &a.Payment}, 1)
+	}
+	a.checkAttack(n)
+	n.restartMining()
+}
+
+func (a *DoubleSpendStrategy) OnBlockReceived(n *Node, b Block) {
+	if b.Header.Height > n.Blocks[a.publicTip].Header.Height {
+		a.publicTip = b.Hash
+		if a.premining {
+			a.forkPoint = b.Hash
+			a.privateTip = b.Hash
+			n.restartMining()
+		}
+	}
+	a.checkAttack(n)
+}
+
+// paymentConfirmations returns the depth of the payment on the public chain,
+// or 0 if it is not included yet.
+func (a *DoubleSpendStrategy) paymentConfirmations(n *Node) int {
+	publicHeight := n.Blocks[a.publicTip].Header.Height
+	for current := a.publicTip; current != a.forkPoint; {
+		b, ok := n.Blocks[current]
+		if !ok {
+			return 0
+		}
+		for _, tx := range b.Transactions {
+			if tx.ID == a.Payment.ID {
+				return publicHeight - b.Header.Height + 1
+			}
+		}
+		current = b.Header.PrevHash
+	}
+	return 0
+}
+
+func (a *DoubleSpendStrategy) checkAttack(n *Node) {
+	if a.Outcome != AttackPending || a.premining {
+		return
+	}
+	forkHeight := n.Blocks[a.forkPoint].Header.Height
+	privateLen := n.Blocks[a.privateTip].Header.Height - forkHeight
+	publicLen := n.Blocks[a.publicTip].Header.Height - forkHeight
+
+	switch {
+	case a.paymentConfirmations(n) >= a.ConfirmDepth && privateLen > publicLen:
+		for _, b := range a.withheld {
+			n.relayBlock(b, -1)
+		}
+		a.withheld = nil
+		a.resolve(n, AttackSucceeded)
+	case publicLen-privateLen >= a.MaxDeficit:
+		a.resolve(n, AttackFailed)
+	}
+}
+
+func (a *DoubleSpendStrategy) resolve(n *Node, outcome string) {
+	a.Outcome = outcome
+	a.ResolvedAt = n.Sim.CurrentTime
+	n.Sim.Stop("double-spend attack " + outcome)
+}
+
+// setupDoubleSpendAttack turns the first miner into a double-spend attacker
+// with AttackerHashShare of the hash rate, scaling the honest miners to fill
+// the rest, and starts every miner. The merchant is the lowest honest node and
+// becomes the reference node.
+func (s *Simulation) setupDoubleSpendAttack() error {
+	if s.Cfg.AttackTrials <= 0 {
+		return nil
+	}
+	if len(s.MinerIDs) < 2 {
+		return fmt.Errorf("a double-spend attack needs at least two miners")
+	}
+	attackerID := s.MinerIDs[0]
+	honestTotal := 0.0
+	for _, minerID := range s.MinerIDs[1:] {
+		honestTotal += s.HashPower[minerID]
+	}
+	for _, minerID := range s.MinerIDs[1:] {
+		s.HashPower[minerID] *= (1 - s.Cfg.AttackerHashShare) / honestTotal
+	}
+	s.HashPower[attackerID] = s.Cfg.AttackerHashShare
+
+	s.TxSource.TotalToGenerate++
+	payment, _ := s.TxSource.GetNextTransaction(s.StartTime)
+	attacker := &DoubleSpendStrategy{
+		HonestStrategy: &HonestStrategy{Selection: s.Cfg.TxSelection},
+		Payment:        *payment,
+		premining:      true,
+		ConfirmDepth:   s.Cfg.ConfirmDepth,
+		MaxDeficit:     s.Cfg.AttackMaxDeficit,
+		forkPoint:      s.GenesisBlock.Hash,
+		privateTip:     s.GenesisBlock.Hash,
+		publicTip:      s.GenesisBlock.Hash,
+	}
+	attacker.Conflict, attacker.HasConflict = s.TxSource.ConflictingSpend(*payment)
+	s.Nodes[attackerID].Strategy = attacker
+	s.Attacker = attacker
+
+	for id := 0; id < len(s.Nodes); id++ {
+		if id != attackerID {
+			s.ReferenceNodeID = id
+			break
+		}
+	}
+	attacker.Merchant = s.ReferenceNodeID
+	for _, minerID := range s.MinerIDs {
+		if honest, ok := s.Nodes[minerID].Strategy.(*HonestStrategy); ok {
+			// The payment should count from the next honest block, as the
+			// analytic models assume.
+			honest.RefreshTemplates = true
+		}
+		s.Nodes[minerID].restartMining()
+	}
+	log.Printf("Double-spend attacker: node %d (hash share %.2f%%), merchant: node %d\n", attackerID, s.Cfg.AttackerHashShare*100, s.ReferenceNodeID)
+	return nil
+}
+
+type DoubleSpendTrialSummary struct {
+	Trials       int
+	Succeeded    int
+	Failed       int
+	Unresolved   int
+	HashShare    float64
+	ConfirmDepth int
+	// MeanDuration is the mean time until the attacker won or gave up.
+	MeanDuration time.Duration
+}
+
+// SuccessRate returns the empirical success probability and the half-width
+// of its 95% normal-approximation confidence interval.
+func (s DoubleSpendTrialSummary) SuccessRate() (float64, float64) {
+	if s.Trials == 0 {
+		return 0, 0
+	}
+	p := float64(s.Succeeded) / float64(s.Trials)
+	return p, 1.96 * math.Sqrt(p*(1-p)/float64(s.Trials))
+}
+
+// RunDoubleSpendTrials runs cfg.AttackTrials independent attack simulations,
+// seeded cfg.Seed, cfg.Seed+1, ... Blocks are found under the exponential
+// model so that the attacker's hash share holds, regular transaction
+// injection is off and honest miners mine without waiting for a full mempool. Simulation logs are
+// discarded while the trials run.
+func RunDoubleSpendTrials(cfg Config) (DoubleSpendTrialSummary, error) {
+	summary := DoubleSpendTrialSummary{HashShare: cfg.AttackerHashShare, ConfirmDepth: cfg.ConfirmDepth}
+	previous := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(previous)
+
+	var totalDuration time.Duration
+	for trial := 0; trial < cfg.AttackTrials; trial++ {
+		trialCfg := cfg
+		trialCfg.Seed = cfg.Seed + int64(trial)
+		trialCfg.TotalInputTransactions = 0
+		trialCfg.MiningFillThreshold = 0
+		trialCfg.SelfishMiners = 0
+		trialCfg.MiningModel = MiningExponential
+		trialCfg.SimulationDuration = attackTrialBlockLimit * cfg.TargetBlockInterval
+
+		sim := NewSimulation(trialCfg)
+		if err := sim.Run(); err != nil {
+			return summary, fmt.Errorf("trial %d: %w", trial, err)
+		}
+		summary.Trials++
+		switch sim.Attacker.Outcome {
+		case AttackSucceeded:
+			summary.Succeeded++
+		case AttackFailed:
+			summary.Failed++
+		default:
+			summary.Unresolved++
+			continue
+		}
+		totalDuration += sim.Attacker.ResolvedAt.Sub(sim.StartTime)
+	}
+	if resolved := summary.Succeeded + summary.Failed; resolved > 0 {
+		summary.MeanDuration = totalDuration / time.Duration(resolved)
+	}
+	return summary, nil
+}
+
+// NakamotoSuccessProbability is the probability that an attacker with hash
+// share q ever catches up from z blocks behind, as computed in section 11 of
+// the Bitcoin paper.
+func NakamotoSuccessProbability(q float64, z int) float64 {
+	p := 1 - q
+	if q >= p {
+		return 1
+	}
+	lambda := float64(z) * q / p
+	poisson := math.Exp(-lambda)
+	sum := 1.0
+	for k := 0; k <= z; k++ {
+		if k > 0 {
+			poisson *= lambda / float64(k)
+		}
+		sum -= poisson * (1 - math.Pow(q/p, float64(z-k)))
+	}
+	return sum
+}
+
+// RosenfeldSuccessProbability is Rosenfeld's exact double-spend success
+// probability for a pre-mining attacker with hash share q against a merchant
+// waiting for n confirmations ("Analysis of hashrate-based double spending",
+// 2014). Unlike Nakamoto's estimate it models the attacker's progress while
+// the confirmations accumulate as negative binomial rather than Poisson.
+func RosenfeldSuccessProbability(q float64, n int) float64 {
+	p := 1 - q
+	if q >= p || n == 0 {
+		return 1
+	}
+	sum := 1.0
+	binomial := 1.0 // C(m+n-1, m)
+	for m := 0; m <= n; m++ {
+		if m > 0 {
+			binomial *= float64(n-1+m) / float64(m)
+		}
+		sum -= binomial * (math.Pow(p, float64(n))*math.Pow(q, float64(m)) - math.Pow(q, float64(n))*math.Pow(p, float64(m)))
+	}
+	return sum
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestNakamotoSuccessProbability checks against the tables in section 11 of
+// the Bitcoin paper, which are rounded to seven decimal places.
+func TestNakamotoSuccessProbability(t *testing.T) {
+	tests := []struct {
+		q    float64
+		z    int
+		want float64
+	}{
+		{0.1, 0, 1.0000000},
+		{0.1, 1, 0.2045873},
+		{0.1, 2, 0.0509779},
+		{0.1, 3, 0.0131722},
+		{0.1, 4, 0.0034552},
+		{0.1, 5, 0.0009137},
+		{0.1, 6, 0.0002428},
+		{0.1, 7, 0.0000647},
+		{0.1, 8, 0.0000173},
+		{0.1, 9, 0.0000046},
+		{0.1, 10, 0.0000012},
+		{0.3, 0, 1.0000000},
+		{0.3, 5, 0.1773523},
+		{0.3, 10, 0.0416605},
+		{0.3, 15, 0.0101008},
+		{0.3, 20, 0.0024804},
+		{0.3, 25, 0.0006132},
+		{0.3, 30, 0.0001522},
+		{0.3, 35, 0.0000379},
+		{0.3, 40, 0.0000095},
+		{0.3, 45, 0.0000024},
+		{0.3, 50, 0.0000006},
+		{0.5, 6, 1},
+		{0.6, 6, 1},
+	}
+	for _, tt := range tests {
+		if got := NakamotoSuccessProbability(tt.q, tt.z); math.Abs(got-tt.want) > 5e-8 {
+			t.Errorf("NakamotoSuccessProbability(%v, %d) = %.7f, want %.7f", tt.q, tt.z, got, tt.want)
+		}
+	}
+}
+
+func TestRosenfeldSuccessProbability(t *testing.T) {
+	tests := []struct {
+		q    float64
+		n    int
+		want float64
+	}{
+		{0.1, 0, 1},
+		// With one confirmation the attacker succeeds with probability 2q,
+		// and with two 6q^2 - 4q^3.
+		{0.1, 1, 0.2},
+		{0.3, 1, 0.6},
+		{0.1, 2, 0.056},
+		{0.3, 2, 0.432},
+		// Rosenfeld's headline example: 0.059% for q = 10% and n = 6.
+		{0.1, 6, 0.0005914},
+		{0.5, 6, 1},
+		{0.6, 6, 1},
+	}
+	for _, tt := range tests {
+		if got := RosenfeldSuccessProbability(tt.q, tt.n); math.Abs(got-tt.want) > 5e-8 {
+			t.Errorf("RosenfeldSuccessProbability(%v, %d) = %.7f, want %.7f", tt.q, tt.n, got, tt.want)
+		}
+	}
+}
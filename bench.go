@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// benchConfig is the scale benchmark scenario: a 10,000-node gossip network
+// on a random regular graph, simulated for 24 hours with a light transaction
+// load so that block relay dominates. Blocks are found under the exponential
+// model every 10 minutes and links have 10/50 Mbit/s, so that the scenario does not follow
+// the defaults.
+func benchConfig() Config {
+	cfg := DefaultConfig()
+	cfg.NumNodes = 10000
+	cfg.NumMiners = 100
+	cfg.SimulationDuration = 24 * time.Hour
+	cfg.RelayMode = RelayGossip
+	cfg.Topology = TopologyRegular
+	cfg.PeerDegree = 8
+	cfg.TransactionRatePerSec = 0.01
+	cfg.TotalInputTransactions = int(cfg.TransactionRatePerSec * cfg.SimulationDuration.Seconds())
+	cfg.MiningModel = MiningExponential
+	cfg.TargetBlockInterval = 10 * time.Minute
+	cfg.UploadMbps = 10
+	cfg.DownloadMbps = 50
+	cfg.MiningFillThreshold = 0
+	cfg.Seed = 1
+	return cfg
+}
+
+// memSampler records the peak heap in use while a run is in progress.
+type memSampler struct {
+	mu       sync.Mutex
+	peakHeap uint64
+	done     chan struct{}
+	stopped  chan struct{}
+}
+
+func startMemSampler(interval time.Duration) *memSampler {
+	m := &memSampler{done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(m.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			m.sample()
+			select {
+			case <-m.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return m
+}
+
+func (m *memSampler) sample() {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	m.mu.Lock()
+	if stats.HeapInuse > m.peakHeap {
+		m.peakHeap = stats.HeapInuse
+	}
+	m.mu.Unlock()
+}
+
+// stop takes a last sample and returns the peak heap in use.
+func (m *memSampler) stop() uint64 {
+	close(m.done)
+	<-m.stopped
+	m.sample()
+	return m.peakHeap
+}
+
+// runBench runs the scale benchmark and reports wall time, event throughput
+// and peak memory. It exits with status 1 if the peak heap exceeds the
+// memory budget.
+func runBench(args []string) {
+	cfg := benchConfig()
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	fs.IntVar(&cfg.NumNodes, "nodes", cfg.NumNodes, "Total number of nodes")
+	fs.IntVar(&cfg.NumMiners, "miners", cfg.NumMiners, "Number of mining nodes")
+	fs.DurationVar(&cfg.SimulationDuration, "duration", cfg.SimulationDuration, "Simulated time to run")
+	fs.IntVar(&cfg.PeerDegree, "degree", cfg.PeerDegree, "Peer count per node")
+	fs.Float64Var(&cfg.TransactionRatePerSec, "tx_rate", cfg.TransactionRatePerSec, "Transaction injection rate per second")
+	fs.StringVar(&cfg.RelayProtocol, "relay_protocol", cfg.RelayProtocol, "Relay protocol: 'push' or 'inv'")
+	fs.BoolVar(&cfg.CompactBlocks, "compact_blocks", cfg.CompactBlocks, "Relay blocks as BIP152 compact blocks")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "Random seed")
+	memBudgetMB := fs.Int("mem_budget_mb", 2048, "Peak heap the run may use, in MiB")
+	verbose := fs.Bool("v", false, "Keep the simulation's own log output")
+	fs.Parse(args)
+
+	if cfg.NumNodes <= 0 || cfg.NumMiners <= 0 || cfg.NumMiners > cfg.NumNodes {
+		log.Fatalf("Error: bench needs at least one node and 1..nodes miners.")
+	}
+	if cfg.RelayProtocol != RelayPush && cfg.RelayProtocol != RelayInv {
+		log.Fatalf("Error: Unknown relay protocol %q (expected %q or %q).", cfg.RelayProtocol, RelayPush, RelayInv)
+	}
+	cfg.TotalInputTransactions = int(cfg.TransactionRatePerSec * cfg.SimulationDuration.Seconds())
+
+	log.Printf("--- Benchmark: %d nodes (%d miners), %v simulated, degree %d, %.3f tx/s, %s relay ---",
+		cfg.NumNodes, cfg.NumMiners, cfg.SimulationDuration, cfg.PeerDegree, cfg.TransactionRatePerSec, cfg.RelayProtocol)
+	runtime.GC()
+	sampler := startMemSampler(100 * time.Millisecond)
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+	start := time.Now()
+	sim := NewSimulation(cfg)
+	err := sim.Run()
+	wall := time.Since(start)
+	peakHeap := sampler.stop()
+	log.SetOutput(os.Stderr)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	const mib = 1 << 20
+	log.Printf("Simulated: %v | Main Chain Height: %d | Stale Blocks(G): %d\n",
+		sim.CurrentTime.Sub(sim.StartTime), sim.Nodes[sim.ReferenceNodeID].TipHeight(), sim.GlobalStaleCount)
+	log.Printf("Events: %d | Wall Time: %v | Events/s: %.0f\n",
+		sim.EventCount, wall.Round(time.Millisecond), float64(sim.EventCount)/wall.Seconds())
+	log.Printf("Peak Heap: %.1f MiB | Memory From OS: %.1f MiB | Budget: %d MiB\n",
+		float64(peakHeap)/mib, float64(stats.Sys)/mib, *memBudgetMB)
+	if peakHeap > uint64(*memBudgetMB)*mib {
+		log.Printf("FAIL: peak heap exceeds the memory budget.\n")
+		os.Exit(1)
+	}
+	log.Printf("PASS: within the memory budget.\n")
+}
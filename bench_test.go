@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// benchmarkRun runs cfg b.N times and reports events per run, event
+// throughput and the peak heap in use, next to the allocation counts.
+func benchmarkRun(b *testing.B, cfg Config) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	b.ReportAllocs()
+	var peakHeap uint64
+	events := 0
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		runtime.GC()
+		sampler := startMemSampler(100 * time.Millisecond)
+		b.StartTimer()
+		sim := NewSimulation(cfg)
+		if err := sim.Run(); err != nil {
+			b.Fatal(err)
+		}
+		b.StopTimer()
+		if peak := sampler.stop(); peak > peakHeap {
+			peakHeap = peak
+		}
+		events += sim.EventCount
+		b.StartTimer()
+	}
+	b.ReportMetric(float64(events)/float64(b.N), "events/op")
+	b.ReportMetric(float64(events)/b.Elapsed().Seconds(), "events/s")
+	b.ReportMetric(float64(peakHeap)/(1<<20), "peak-heap-MiB")
+}
+
+// BenchmarkBlockRelay is the bench subcommand's scenario: 10,000 nodes for 24
+// simulated hours with almost no transactions.
+func BenchmarkBlockRelay(b *testing.B) {
+	benchmarkRun(b, benchConfig())
+}
+
+// BenchmarkTxRelay relays transactions at Bitcoin's average rate of about 4
+// tx/s for one block interval, so every transaction fans out to every node.
+func BenchmarkTxRelay(b *testing.B) {
+	for _, nodes := range []int{1000, 10000} {
+		b.Run(fmt.Sprintf("nodes=%d", nodes), func(b *testing.B) {
+			cfg := benchConfig()
+			cfg.NumNodes = nodes
+			cfg.NumMiners = nodes / 100
+			cfg.TransactionRatePerSec = 4
+			cfg.SimulationDuration = 10 * time.Minute
+			cfg.TotalInputTransactions = int(cfg.TransactionRatePerSec * cfg.SimulationDuration.Seconds())
+			benchmarkRun(b, cfg)
+		})
+	}
+}
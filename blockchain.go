@@ -13,14 +13,43 @@ type Transaction struct {
 	Timestamp time.Time
 	Data      string
 	Size      int
+	Fee       int64
+	Inputs    []TxInput
+	Outputs   []TxOutput
+	// Account model fields.
+	Sender    int
+	Recipient int
+	Nonce     uint64
+	Value     int64
 }
 
+// FeeRate returns the fee in satoshis per byte.
+func (tx Transaction) FeeRate() float64 {
+	if tx.Size <= 0 {
+		return 0
+	}
+	return float64(tx.Fee) / float64(tx.Size)
+}
+
+func (tx Transaction) outputValue() int64 {
+	var total int64
+	for _, out := range tx.Outputs {
+		total += out.Value
+	}
+	return total
+}
+
+// BlockHeaderSize is the serialized size of a block header in bytes, as in
+// Bitcoin.
+const BlockHeaderSize = 80
+
 type BlockHeader struct {
-	Height    int
-	Timestamp time.Time
-	PrevHash  string
-	MinerID   int
-	NumTx     int
+	Height     int
+	Timestamp  time.Time
+	PrevHash   string
+	MinerID    int
+	NumTx      int
+	Difficulty float64
 }
 
 type Block struct {
@@ -31,7 +60,7 @@ type Block struct {
 }
 
 func (b *Block) CalculateHash() string {
-	headerStr := fmt.Sprintf("%d%s%s%d%d", b.Header.Height, b.Header.Timestamp.String(), b.Header.PrevHash, b.Header.MinerID, b.Header.NumTx)
+	headerStr := fmt.Sprintf("%d%s%s%d%d%g", b.Header.Height, b.Header.Timestamp.String(), b.Header.PrevHash, b.Header.MinerID, b.Header.NumTx, b.Header.Difficulty)
 
 	var txIDs []string
 	for _, tx := range b.Transactions {
@@ -42,13 +71,44 @@ func (b *Block) CalculateHash() string {
 	return hex.EncodeToString(hashBytes[:])
 }
 
-func NewBlock(height int, prevHash string, attemptTime time.Time, minerID int, txs []Transaction) Block {
+// Size is the block's size on the wire: the header plus its transactions.
+func (b *Block) Size() int {
+	size := BlockHeaderSize
+	for _, tx := range b.Transactions {
+		size += tx.Size
+	}
+	return size
+}
+
+func (b *Block) TotalFees() int64 {
+	var total int64
+	for _, tx := range b.Transactions {
+		total += tx.Fee
+	}
+	return total
+}
+
+func NewBlock(height int, prevHash string, attemptTime time.Time, minerID int, difficulty float64, txs []Transaction) Block {
 	b := Block{
 		Header: BlockHeader{
-			Height: height, Timestamp: attemptTime, PrevHash: prevHash, MinerID: minerID, NumTx: len(txs),
+			Height: height, Timestamp: attemptTime, PrevHash: prevHash, MinerID: minerID, NumTx: len(txs), Difficulty: difficulty,
 		},
 		Transactions: txs,
 	}
 	b.Hash = b.CalculateHash()
 	return b
 }
+
+// blockStore holds one copy of every block in the simulation. Nodes keep
+// pointers into it, so a block is stored once however many nodes have it.
+// Stored blocks must not be modified.
+type blockStore map[string]*Block
+
+func (bs blockStore) intern(b Block) *Block {
+	if stored, ok := bs[b.Hash]; ok {
+		return stored
+	}
+	stored := &b
+	bs[b.Hash] = stored
+	return stored
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxHeadersPerMessage is the most headers a getheaders reply carries, as in
+// Bitcoin. A full reply means the peer has more and the node asks again.
+const maxHeadersPerMessage = 2000
+
+const (
+	getHeadersBaseSize = messageHeaderSize + 4 + 1 + 32
+	locatorEntrySize   = 32
+)
+
+// SyncRecord describes one headers-first block download by a node that joined
+// late or restarted after a crash.
+type SyncRecord struct {
+	NodeID      int
+	Join        bool
+	Start       time.Time
+	End         time.Time
+	StartHeight int
+	EndHeight   int
+	Blocks      int
+	Bytes       int64
+	// Interrupted is set when the node crashed again before it caught up.
+	Interrupted bool
+
+	peer         int
+	targetHeight int
+	headersDone  bool
+	// timeout is the pending timeout of the last getheaders.
+	timeout *Event
+}
+
+// setupLateJoiners takes the LateJoiners highest-numbered nodes that are
+// neither miners nor the reference node offline until their join time.
+func (s *Simulation) setupLateJoiners() error {
+	for id := s.Cfg.NumNodes - 1; id >= 0 && len(s.lateJoiners) < s.Cfg.LateJoiners; id-- {
+		node := s.Nodes[id]
+		if node.IsMiner || id == s.ReferenceNodeID {
+			continue
+		}
+		node.Offline = true
+		s.lateJoiners = append(s.lateJoiners, id)
+	}
+	if len(s.lateJoiners) < s.Cfg.LateJoiners {
+		return fmt.Errorf("late joiners (%d) exceed the nodes that are neither miners nor the reference node (%d)", s.Cfg.LateJoiners, len(s.lateJoiners))
+	}
+	return nil
+}
+
+// scheduleChurn schedules each late joiner at a uniformly random time in the
+// run and, when churn is on, the first crash of every other node except the
+// reference node.
+func (s *Simulation) scheduleChurn() {
+	rng := s.Rand.Churn
+	for _, id := range s.lateJoiners {
+		at := time.Duration(rng.Float64() * float64(s.Cfg.SimulationDuration))
+		s.ScheduleEvent(s.StartTime.Add(at), EvNodeUp, NodeChurnData{NodeID: id, Join: true})
+	}
+	if s.Cfg.ChurnInterval <= 0 {
+		return
+	}
+	for id := 0; id < len(s.Nodes); id++ {
+		if id != s.ReferenceNodeID && !s.Nodes[id].Offline {
+			s.scheduleCrash(id)
+		}
+	}
+}
+
+// scheduleCrash draws the node's next crash after an exponential uptime with
+// mean ChurnInterval.
+func (s *Simulation) scheduleCrash(id int) {
+	uptime := time.Duration(s.Rand.Churn.ExpFloat64() * float64(s.Cfg.ChurnInterval))
+	s.ScheduleEvent(s.CurrentTime.Add(uptime), EvNodeDown, NodeChurnData{NodeID: id})
+}
+
+// onlineNode returns the node with the given ID if it is online. Messages and
+// mining events for an offline node are lost.
+func (s *Simulation) onlineNode(id int) (*Node, bool) {
+	node, ok := s.Nodes[id]
+	if !ok || node.Offline {
+		return nil, false
+	}
+	return node, true
+}
+
+// nearestOnline returns id, or the next online node after it if it is
+// offline, so that wallets hand new transactions to a node that is up.
+func (s *Simulation) nearestOnline(id int) int {
+	for i := 0; i < len(s.Nodes); i++ {
+		candidate := (id + i) % len(s.Nodes)
+		if !s.Nodes[candidate].Offline {
+			return candidate
+		}
+	}
+	return id
+}
+
+func (s *Simulation) handleNodeDown(data NodeChurnData) {
+	node := s.Nodes[data.NodeID]
+	if node.Offline {
+		return
+	}
+	node.crash()
+	s.Crashes++
+	log.Printf("T=%.3fs Node %d: Went offline\n", s.CurrentTime.Sub(s.StartTime).Seconds(), node.ID)
+	downtime := time.Duration(s.Rand.Churn.ExpFloat64() * float64(s.Cfg.ChurnDowntime))
+	s.ScheduleEvent(s.CurrentTime.Add(downtime), EvNodeUp, NodeChurnData{NodeID: node.ID})
+
+	// Nodes that were downloading from it start over with another peer.
+	for id := 0; id < len(s.Nodes); id++ {
+		if other := s.Nodes[id]; !other.Offline && other.syncing != nil && other.syncing.peer == node.ID {
+			other.requested = make(map[string]bool)
+			other.requestHeaders()
+		}
+	}
+	for id := 0; id < len(s.Nodes); id++ {
+		if other := s.Nodes[id]; !other.Offline {
+			other.peerLost(node.ID)
+		}
+	}
+}
+
+func (s *Simulation) handleNodeUp(data NodeChurnData) {
+	node := s.Nodes[data.NodeID]
+	if !node.Offline {
+		return
+	}
+	node.Offline = false
+	if data.Join {
+		log.Printf("T=%.3fs Node %d: Joined the network\n", s.CurrentTime.Sub(s.StartTime).Seconds(), node.ID)
+	} else {
+		s.Restarts++
+		log.Printf("T=%.3fs Node %d: Came back online\n", s.CurrentTime.Sub(s.StartTime).Seconds(), node.ID)
+	}
+	node.startSync(data.Join)
+	if s.Cfg.ChurnInterval > 0 {
+		s.scheduleCrash(node.ID)
+	}
+}
+
+// crash takes the node offline. Blocks and chain state survive; the mempool,
+// orphans, pending requests and the mining job do not.
+func (n *Node) crash() {
+	n.Offline = true
+	n.cancelMiningJob()
+	n.isWaitingToMine = false
+	for id := range n.Mempool {
+		n.removeFromMempool(id)
+	}
+	n.evictionQueue = n.evictionQueue[:0]
+	n.orphanTxs = make(map[string][]*Transaction)
+	n.orphanTxCount = 0
+	n.OrphanBlocks = make(map[string][]Block)
+	n.requested = make(map[string]bool)
+	n.reconstructing = make(map[string]int)
+	n.extraTxs = make(map[string]bool)
+	n.extraTxOrder = nil
+	n.cancelRequestTimeouts()
+	if n.syncing != nil {
+		n.syncing.Interrupted = true
+		n.syncing = nil
+	}
+	// Only what is on disk is still known: the transactions in blocks.
+	n.knownTx = n.knownTx[:0]
+	for _, b := range n.Blocks {
+		for _, tx := range b.Transactions {
+			n.markTxKnown(tx.ID)
+		}
+	}
+}
+
+// startSync begins a headers-first download from a random online relay target.
+// The node neither relays blocks nor mines until it has caught up.
+func (n *Node) startSync(join bool) {
+	n.syncing = &SyncRecord{
+		NodeID:      n.ID,
+		Join:        join,
+		Start:       n.Sim.CurrentTime,
+		StartHeight: n.TipHeight(),
+	}
+	n.Sim.Syncs = append(n.Sim.Syncs, n.syncing)
+	n.requestHeaders()
+}
+
+// requestHeaders picks a sync peer and sends it a getheaders for the node's
+// best chain. Without an online peer the node gives up on the download and
+// catches up from block announcements instead.
+func (n *Node) requestHeaders() {
+	candidates := []int{}
+	for _, id := range n.relayTargets(-1) {
+		if !n.Sim.Nodes[id].Offline {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		log.Printf("T=%.3fs Node %d: No online peer to sync from\n", n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID)
+		n.finishSync()
+		return
+	}
+	n.syncing.peer = candidates[n.Sim.Rand.Churn.Intn(len(candidates))]
+	n.sendGetHeaders(n.syncing.peer, n.blockLocator())
+}
+
+func (n *Node) sendGetHeaders(peerID int, locator []string) {
+	size := getHeadersBaseSize + locatorEntrySize*len(locator)
+	n.send(peerID, MsgGetHeaders, size, EvGetHeaders, GetHeadersData{TargetNodeID: peerID, FromNodeID: n.ID, Locator: locator})
+	n.Sim.CancelEvent(n.syncing.timeout)
+	n.syncing.timeout = n.armRequestTimeout(peerID, MsgGetHeaders, nil, 0)
+}
+
+// blockLocator lists best chain hashes from the tip back to genesis: the
+// last ten blocks, then exponentially sparser.
+func (n *Node) blockLocator() []string {
+	locator := []string{}
+	step := 1
+	hash := n.BestChainTip
+	for {
+		b := n.Blocks[hash]
+		locator = append(locator, hash)
+		if b.Header.Height == 0 {
+			return locator
+		}
+		if len(locator) >= 10 {
+			step *= 2
+		}
+		for i := 0; i < step && b.Header.Height > 0; i++ {
+			hash = b.Header.PrevHash
+			b = n.Blocks[hash]
+		}
+	}
+}
+
+// bestChain returns the hashes of the node's best chain indexed by height.
+func (n *Node) bestChain() []string {
+	tip := n.Blocks[n.BestChainTip]
+	chain := make([]string, tip.Header.Height+1)
+	for hash := n.BestChainTip; ; {
+		b := n.Blocks[hash]
+		chain[b.Header.Height] = hash
+		if b.Header.Height == 0 {
+			return chain
+		}
+		hash = b.Header.PrevHash
+	}
+}
+
+// ReceiveGetHeaders answers with up to maxHeadersPerMessage headers of the
+// best chain following the first locator entry on it.
+func (n *Node) ReceiveGetHeaders(data GetHeadersData) {
+	chain := n.bestChain()
+	fork := 0
+	for _, hash := range data.Locator {
+		if b, ok := n.Blocks[hash]; ok && b.Header.Height < len(chain) && chain[b.Header.Height] == hash {
+			fork = b.Header.Height
+			break
+		}
+	}
+	end := fork + 1 + maxHeadersPerMessage
+	if end > len(chain) {
+		end = len(chain)
+	}
+	reply := HeadersData{TargetNodeID: data.FromNodeID, FromNodeID: n.ID, Response: true}
+	for _, hash := range chain[fork+1 : end] {
+		reply.Hashes = append(reply.Hashes, hash)
+		reply.Headers = append(reply.Headers, n.Blocks[hash].Header)
+	}
+	size := messageHeaderSize + compactSizeLen(len(reply.Headers)) + headersEntrySize*len(reply.Headers)
+	n.send(data.FromNodeID, MsgHeaders, size, EvHeaders, reply)
+}
+
+// continueSync handles the sync peer's reply to getheaders: a full reply is
+// followed by another getheaders, a short one ends the headers phase.
+func (n *Node) continueSync(data HeadersData) {
+	sync := n.syncing
+	n.Sim.CancelEvent(sync.timeout)
+	sync.timeout = nil
+	if len(data.Headers) > 0 {
+		last := len(data.Headers) - 1
+		sync.targetHeight = data.Headers[last].Height
+		if len(data.Headers) == maxHeadersPerMessage {
+			n.sendGetHeaders(sync.peer, append([]string{data.Hashes[last]}, n.blockLocator()...))
+			return
+		}
+	}
+	sync.headersDone = true
+	n.checkSync()
+}
+
+// checkSync ends the download once the headers phase is over and the best
+// chain has reached the last announced header.
+func (n *Node) checkSync() {
+	if sync := n.syncing; sync != nil && sync.headersDone && n.TipHeight() >= sync.targetHeight {
+		n.finishSync()
+	}
+}
+
+func (n *Node) finishSync() {
+	sync := n.syncing
+	n.syncing = nil
+	n.Sim.CancelEvent(sync.timeout)
+	sync.End = n.Sim.CurrentTime
+	sync.EndHeight = n.TipHeight()
+	log.Printf("T=%.3fs Node %d: Synced to height %d (%d blocks in %v)\n",
+		n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, sync.EndHeight, sync.Blocks, sync.End.Sub(sync.Start))
+	if n.IsMiner {
+		n.restartMining()
+	}
+}
+
+// compactSizeLen is the length of a Bitcoin CompactSize integer.
+func compactSizeLen(v int) int {
+	switch {
+	case v < 0xfd:
+		return 1
+	case v <= 0xffff:
+		return 3
+	default:
+		return 5
+	}
+}
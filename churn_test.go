@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// syncTestSim returns a four-node network with one late joiner, and the
+// joiner, after the online nodes have built a chain of height blocks.
+func syncTestSim(t *testing.T, height int) (*Simulation, *Node) {
+	t.Helper()
+	cfg := testConfig(4, 1)
+	cfg.LateJoiners = 1
+	sim := newTestSimulation(t, cfg)
+	tip := sim.GenesisBlock.Hash
+	for i := 0; i < height; i++ {
+		b := childBlock(sim.Nodes[0], tip, sim.MinerIDs[0])
+		for id := 0; id < len(sim.Nodes); id++ {
+			if n := sim.Nodes[id]; !n.Offline {
+				n.ReceiveBlock(b, -1)
+			}
+		}
+		tip = b.Hash
+	}
+	return sim, sim.Nodes[sim.lateJoiners[0]]
+}
+
+// lastGetHeaders returns the most recent getheaders sent.
+func lastGetHeaders(t *testing.T, sim *Simulation) GetHeadersData {
+	t.Helper()
+	events := queued(sim, EvGetHeaders)
+	if len(events) == 0 {
+		t.Fatal("no getheaders sent")
+	}
+	return events[len(events)-1].Data.(GetHeadersData)
+}
+
+func TestLateJoinerSyncsHeadersFirst(t *testing.T) {
+	sim, joiner := syncTestSim(t, 3)
+	sim.handleNodeUp(NodeChurnData{NodeID: joiner.ID, Join: true})
+	if joiner.Offline || joiner.syncing == nil {
+		t.Fatal("the late joiner did not come online and start syncing")
+	}
+	getHeaders := lastGetHeaders(t, sim)
+	if fmt.Sprint(getHeaders.Locator) != fmt.Sprint([]string{sim.GenesisBlock.Hash}) {
+		t.Errorf("locator = %v, want only genesis", getHeaders.Locator)
+	}
+
+	peer := sim.Nodes[getHeaders.TargetNodeID]
+	peer.ReceiveGetHeaders(getHeaders)
+	replies := queued(sim, EvHeaders)
+	reply := replies[len(replies)-1].Data.(HeadersData)
+	if !reply.Response || len(reply.Hashes) != 3 {
+		t.Fatalf("headers reply has %d headers (response %v), want the 3 blocks", len(reply.Hashes), reply.Response)
+	}
+	joiner.ReceiveHeaders(reply)
+	if got, want := fmt.Sprint(requests(sim, EvGetData)), fmt.Sprintf("[%d->%d:%v]", joiner.ID, peer.ID, reply.Hashes); got != want {
+		t.Errorf("getdata sent = %s, want %s", got, want)
+	}
+	if !joiner.syncing.headersDone || joiner.syncing.targetHeight != 3 {
+		t.Errorf("headers done = %v, target %d; want true, 3", joiner.syncing.headersDone, joiner.syncing.targetHeight)
+	}
+
+	relayed := len(queued(sim, EvReceiveBlock))
+	for _, hash := range reply.Hashes {
+		joiner.ReceiveBlock(*peer.Blocks[hash], peer.ID)
+	}
+	if joiner.syncing != nil || joiner.TipHeight() != 3 {
+		t.Fatalf("after the blocks: syncing = %v, height %d; want done at 3", joiner.syncing != nil, joiner.TipHeight())
+	}
+	if record := sim.Syncs[0]; !record.Join || record.Blocks != 3 || record.EndHeight != 3 {
+		t.Errorf("sync record: join %v, %d blocks, end height %d; want true, 3, 3", record.Join, record.Blocks, record.EndHeight)
+	}
+	if len(queued(sim, EvReceiveBlock)) != relayed {
+		t.Error("blocks downloaded during the sync were relayed")
+	}
+}
+
+// TestSyncPeerCrashRestartsDownload checks that a node whose sync peer goes
+// offline asks another peer.
+func TestSyncPeerCrashRestartsDownload(t *testing.T) {
+	sim, joiner := syncTestSim(t, 3)
+	sim.handleNodeUp(NodeChurnData{NodeID: joiner.ID, Join: true})
+	first := lastGetHeaders(t, sim).TargetNodeID
+	sim.handleNodeDown(NodeChurnData{NodeID: first})
+	if second := lastGetHeaders(t, sim).TargetNodeID; second == first || joiner.syncing.peer != second {
+		t.Errorf("after the sync peer crashed: getheaders to %d, sync peer %d; want another peer than %d", second, joiner.syncing.peer, first)
+	}
+}
+
+// TestCrashKeepsOnlyTheChain checks what a crash wipes and that a restart
+// starts a sync.
+func TestCrashKeepsOnlyTheChain(t *testing.T) {
+	sim, _ := syncTestSim(t, 0)
+	miner := sim.Nodes[sim.MinerIDs[0]]
+	confirmed := *testTx("confirmed", 250, 1000)
+	b := childBlock(miner, sim.GenesisBlock.Hash, miner.ID, confirmed)
+	miner.ReceiveBlock(b, -1)
+	miner.ReceiveTransaction(testTx("pending", 250, 1000), -1)
+	miner.requested["wanted"] = true
+	miner.AttemptMining(AttemptMiningData{MinerNodeID: miner.ID, ParentBlockHash: b.Hash, Height: 2})
+	job := miner.CurrentMiningJob
+	if job == nil {
+		t.Fatal("no mining job to lose")
+	}
+
+	sim.handleNodeDown(NodeChurnData{NodeID: miner.ID})
+	if !miner.Offline || len(miner.Mempool) != 0 || len(miner.requested) != 0 || miner.CurrentMiningJob != nil {
+		t.Errorf("after the crash: offline %v, %d mempool txs, %d requests, mining %v",
+			miner.Offline, len(miner.Mempool), len(miner.requested), miner.CurrentMiningJob != nil)
+	}
+	if sim.CancelEvent(job) {
+		t.Error("the mining job was still queued after the crash")
+	}
+	if miner.BestChainTip != b.Hash || !miner.knowsTx("confirmed") || miner.knowsTx("pending") {
+		t.Errorf("after the crash: tip %s, knows confirmed %v, knows pending %v; want the block, true, false",
+			miner.BestChainTip[:6], miner.knowsTx("confirmed"), miner.knowsTx("pending"))
+	}
+
+	sim.handleNodeUp(NodeChurnData{NodeID: miner.ID})
+	if miner.Offline || miner.syncing == nil || miner.syncing.Join || sim.Restarts != 1 {
+		t.Errorf("after the restart: offline %v, syncing %v, %d restarts; want false, a restart sync, 1",
+			miner.Offline, miner.syncing != nil, sim.Restarts)
+	}
+}
@@ -1,6 +1,18 @@
 package main
 
-import "time"
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+const (
+	RelayBroadcast = "broadcast"
+	RelayGossip    = "gossip"
+
+	RelayPush = "push"
+	RelayInv  = "inv"
+)
 
 type Config struct {
 	NumNodes              int
@@ -9,18 +21,89 @@ type Config struct {
 	TargetBlockInterval   time.Duration
 	TransactionRatePerSec float64
 
-	MinTransactionSizeBytes    int     `default:"100"`
-	MaxTransactionSizeBytes    int     `default:"600"`
-	MeanTransactionSizeBytes   float64 `default:"130.0"`
-	StdDevTransactionSizeBytes float64 `default:"150.0"`
+	MinTransactionSizeBytes    int
+	MaxTransactionSizeBytes    int
+	MeanTransactionSizeBytes   float64
+	StdDevTransactionSizeBytes float64
 
 	NetworkDelayMin        time.Duration
 	NetworkDelayMax        time.Duration
+	UploadMbps             float64
+	DownloadMbps           float64
+	Regions                string
+	LatencyMatrixFile      string
+	LatencyJitter          float64
+	PacketLoss             float64
+	PacketDuplication      float64
+	ReorderJitter          time.Duration
+	RequestTimeout         time.Duration
 	TotalInputTransactions int
 	SimulationDuration     time.Duration
+	ConfirmDepth           int
+	RelayMode              string
+	RelayProtocol          string
+	CompactBlocks          bool
+	CompactExtraTxs        int
+	Topology               string
+	PeerDegree             int
+	RewireProb             float64
+	Hubs                   int
+	TopologyFile           string
+	MaxOutbound            int
+	MaxInbound             int
+	Seed                   int64
+
+	FindTimeMin time.Duration
+	FindTimeMax time.Duration
+
+	MiningModel   string
+	HashPowerDist string
+	ZipfExponent  float64
+	HashPowerFile string
+
+	DifficultyAlgorithm string
+	RetargetInterval    int
+	LWMAWindow          int
+	HashRateSchedule    string
+	PartitionSchedule   string
+	TxBurstSchedule     string
+	PartitionMode       string
+	ChurnInterval       time.Duration
+	ChurnDowntime       time.Duration
+	LateJoiners         int
+	TieBreak            string
+
+	FeeRateDist   string
+	FeeRateMedian float64
+	FeeRateSigma  float64
+	FeeRateMin    float64
+	FeeRateMax    float64
+	TxSelection   string
+
+	MempoolMaxBytes       int
+	MempoolExpiry         time.Duration
+	MinRelayFeeRate       float64
+	MinRelayFeeMultiplier float64
+
+	MinerStrategy       string
+	MiningFillThreshold float64
+
+	SelfishMiners    int
+	SelfishHashShare float64
+	SelfishGamma     float64
+
+	TxModel         string
+	NumWallets      int
+	InitialBalance  int64
+	DoubleSpendRate float64
+
+	AttackTrials      int
+	AttackerHashShare float64
+	AttackMaxDeficit  int
 
-	FindTimeMin time.Duration `default:"9m"`
-	FindTimeMax time.Duration `default:"11m"`
+	// NodeOverrides are per-node settings from a scenario file, at most one
+	// per node. They have no command-line flag.
+	NodeOverrides []NodeOverride
 }
 
 func DefaultConfig() Config {
@@ -28,7 +111,7 @@ func DefaultConfig() Config {
 		NumNodes:              20,
 		NumMiners:             5,
 		BlockSizeLimitBytes:   1 * 1024 * 1024,
-		TargetBlockInterval:   10 * time.Minute,
+		TargetBlockInterval:   0, // midpoint of the find time range
 		TransactionRatePerSec: 4.0,
 
 		MinTransactionSizeBytes:    100,
@@ -38,10 +121,364 @@ func DefaultConfig() Config {
 
 		NetworkDelayMin:        100 * time.Millisecond,
 		NetworkDelayMax:        500 * time.Millisecond,
+		Regions:                RegionsNone,
+		LatencyJitter:          0.1,
 		TotalInputTransactions: 20000,
 		SimulationDuration:     1 * time.Hour,
+		ConfirmDepth:           6,
+		RelayMode:              RelayBroadcast,
+		RelayProtocol:          RelayPush,
+		CompactExtraTxs:        100,
+		Topology:               TopologyRandom,
+		PeerDegree:             8,
+		RewireProb:             0.1,
+		Hubs:                   1,
+		MaxOutbound:            8,
+		MaxInbound:             125,
 
 		FindTimeMin: 10 * time.Minute,
 		FindTimeMax: 11 * time.Minute,
+
+		MiningModel:   MiningUniform,
+		HashPowerDist: HashPowerUniform,
+		ZipfExponent:  1.0,
+
+		DifficultyAlgorithm: DifficultyNone,
+		RetargetInterval:    2016,
+		LWMAWindow:          60,
+		TieBreak:            TieBreakFirstSeen,
+		PartitionMode:       PartitionDrop,
+		ChurnDowntime:       10 * time.Minute,
+
+		FeeRateDist:   FeeDistLognormal,
+		FeeRateMedian: 10,
+		FeeRateSigma:  1.0,
+		FeeRateMin:    1,
+		FeeRateMax:    1000,
+		TxSelection:   TxSelectionRandom,
+
+		MinRelayFeeRate:       0,
+		MinRelayFeeMultiplier: 10,
+
+		MinerStrategy:       StrategyHonest,
+		MiningFillThreshold: 0.95,
+
+		TxModel:        TxModelSimple,
+		NumWallets:     1000,
+		InitialBalance: 100000000,
+
+		AttackerHashShare: 0.1,
+		AttackMaxDeficit:  20,
+	}
+}
+
+// registerConfigFlags defines a flag for every Config field on fs, with cfg's
+// current values as defaults.
+func registerConfigFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.IntVar(&cfg.NumNodes, "nodes", cfg.NumNodes, "Total number of nodes")
+	fs.IntVar(&cfg.NumMiners, "miners", cfg.NumMiners, "Number of mining nodes")
+	fs.IntVar(&cfg.BlockSizeLimitBytes, "block_size_bytes", cfg.BlockSizeLimitBytes, "Max block size in bytes")
+	fs.Float64Var(&cfg.TransactionRatePerSec, "tx_rate", cfg.TransactionRatePerSec, "Transaction injection rate per second")
+	fs.IntVar(&cfg.MinTransactionSizeBytes, "tx_size_min", cfg.MinTransactionSizeBytes, "CLAMP: Minimum transaction size in bytes")
+	fs.IntVar(&cfg.MaxTransactionSizeBytes, "tx_size_max", cfg.MaxTransactionSizeBytes, "CLAMP: Maximum transaction size in bytes")
+	fs.Float64Var(&cfg.MeanTransactionSizeBytes, "tx_size_mean", cfg.MeanTransactionSizeBytes, "Mean transaction size in bytes (Normal Dist)")
+	fs.Float64Var(&cfg.StdDevTransactionSizeBytes, "tx_size_stddev", cfg.StdDevTransactionSizeBytes, "Standard Deviation for transaction size (Normal Dist)")
+	fs.DurationVar(&cfg.NetworkDelayMin, "delay_min", cfg.NetworkDelayMin, "Minimum network delay")
+	fs.DurationVar(&cfg.NetworkDelayMax, "delay_max", cfg.NetworkDelayMax, "Maximum network delay")
+	fs.Float64Var(&cfg.UploadMbps, "upload_mbps", cfg.UploadMbps, "Per-node upload bandwidth in Mbit/s (0 = unlimited)")
+	fs.Float64Var(&cfg.DownloadMbps, "download_mbps", cfg.DownloadMbps, "Per-node download bandwidth in Mbit/s (0 = unlimited)")
+	fs.StringVar(&cfg.Regions, "regions", cfg.Regions, "Node placement: 'none' (delay_min..delay_max between all nodes), 'continents' (built-in table) or 'file'")
+	fs.StringVar(&cfg.LatencyMatrixFile, "latency_matrix", cfg.LatencyMatrixFile, "CSV file with region-to-region latencies in milliseconds (for -regions=file)")
+	fs.Float64Var(&cfg.LatencyJitter, "latency_jitter", cfg.LatencyJitter, "Random extra latency as a fraction of the region-to-region latency")
+	fs.Float64Var(&cfg.PacketLoss, "packet_loss", cfg.PacketLoss, "Probability that a message on any link is lost")
+	fs.Float64Var(&cfg.PacketDuplication, "packet_dup", cfg.PacketDuplication, "Probability that a message on any link is delivered twice")
+	fs.DurationVar(&cfg.ReorderJitter, "reorder_jitter", cfg.ReorderJitter, "Random extra delay of up to this much per message, so messages on a link can arrive out of order")
+	fs.DurationVar(&cfg.RequestTimeout, "request_timeout", cfg.RequestTimeout, "Time to wait for a getdata, getblocktxn or getheaders reply before asking another peer (0 = wait forever)")
+	fs.IntVar(&cfg.TotalInputTransactions, "total_txs", cfg.TotalInputTransactions, "Target total input transactions to inject")
+	fs.DurationVar(&cfg.SimulationDuration, "duration", cfg.SimulationDuration, "Maximum simulation duration")
+	fs.DurationVar(&cfg.FindTimeMin, "find_time_min", cfg.FindTimeMin, "Minimum time to find a block")
+	fs.DurationVar(&cfg.FindTimeMax, "find_time_max", cfg.FindTimeMax, "Maximum time to find a block")
+	fs.StringVar(&cfg.RelayMode, "relay", cfg.RelayMode, "Relay mode: 'broadcast' (send to every node) or 'gossip' (forward to peers only)")
+	fs.StringVar(&cfg.RelayProtocol, "relay_protocol", cfg.RelayProtocol, "Relay protocol: 'push' (send full transactions and blocks) or 'inv' (announce with inv/headers, fetch with getdata)")
+	fs.BoolVar(&cfg.CompactBlocks, "compact_blocks", cfg.CompactBlocks, "Relay blocks as BIP152 compact blocks rebuilt from the receiver's mempool")
+	fs.IntVar(&cfg.CompactExtraTxs, "compact_extra_txs", cfg.CompactExtraTxs, "Recently rejected double spends each node keeps for rebuilding compact blocks")
+	fs.StringVar(&cfg.Topology, "topology", cfg.Topology, "Peer graph generator: 'random', 'regular', 'erdos-renyi', 'scale-free', 'small-world', 'star' or 'file'")
+	fs.IntVar(&cfg.PeerDegree, "degree", cfg.PeerDegree, "Target peer count per node (regular, erdos-renyi, scale-free, small-world)")
+	fs.Float64Var(&cfg.RewireProb, "rewire_prob", cfg.RewireProb, "Probability of rewiring each ring connection (small-world)")
+	fs.IntVar(&cfg.Hubs, "hubs", cfg.Hubs, "Number of relay hubs every other node connects to (star)")
+	fs.StringVar(&cfg.TopologyFile, "topology_file", cfg.TopologyFile, "Edge list file with one '<from> <to>' connection per line (for -topology=file)")
+	fs.IntVar(&cfg.MaxOutbound, "max_outbound", cfg.MaxOutbound, "Maximum connections a node initiates (0 = unlimited)")
+	fs.IntVar(&cfg.MaxInbound, "max_inbound", cfg.MaxInbound, "Maximum connections a node accepts (0 = unlimited)")
+	fs.DurationVar(&cfg.TargetBlockInterval, "block_interval", cfg.TargetBlockInterval, "Target network-wide block interval (default: midpoint of find_time_min/max)")
+	fs.StringVar(&cfg.MiningModel, "mining_model", cfg.MiningModel, "Block discovery model: 'uniform' (find_time_min..max) or 'exponential' (Poisson, per-miner hash power)")
+	fs.StringVar(&cfg.HashPowerDist, "hash_power", cfg.HashPowerDist, "Hash power distribution across miners: 'uniform', 'zipf' or 'file'")
+	fs.Float64Var(&cfg.ZipfExponent, "zipf_exponent", cfg.ZipfExponent, "Exponent for the 'zipf' hash power distribution")
+	fs.StringVar(&cfg.HashPowerFile, "hash_power_file", cfg.HashPowerFile, "File with one miner weight per line ('<weight>' or '<nodeID> <weight>')")
+	fs.StringVar(&cfg.DifficultyAlgorithm, "difficulty", cfg.DifficultyAlgorithm, "Difficulty retarget algorithm: 'none', 'bitcoin', 'ethereum' or 'lwma'")
+	fs.IntVar(&cfg.RetargetInterval, "retarget_interval", cfg.RetargetInterval, "Blocks per retarget period for the 'bitcoin' algorithm")
+	fs.IntVar(&cfg.LWMAWindow, "lwma_window", cfg.LWMAWindow, "Averaging window in blocks for the 'lwma' algorithm")
+	fs.StringVar(&cfg.HashRateSchedule, "hashrate_schedule", cfg.HashRateSchedule, "Network hash rate changes as '<time>:<multiplier>,...' (e.g. '2h:0.5,4h:1')")
+	fs.StringVar(&cfg.PartitionSchedule, "partition_schedule", cfg.PartitionSchedule, "Network partitions as '<time>:<groups>' or '<time>:heal', e.g. '1h:0-9,3h:heal' (groups split by '|', IDs joined by '+')")
+	fs.StringVar(&cfg.TxBurstSchedule, "tx_bursts", cfg.TxBurstSchedule, "Extra transactions as '<time>:<count>/<spread>,...', e.g. '2h:500/10m' injects 500 transactions evenly over 10 minutes from 2h")
+	fs.StringVar(&cfg.PartitionMode, "partition_mode", cfg.PartitionMode, "Messages across a partition: 'drop' or 'hold' (delivered on heal)")
+	fs.DurationVar(&cfg.ChurnInterval, "churn_interval", cfg.ChurnInterval, "Mean time a node stays up between crashes (0 = no churn; the reference node never crashes)")
+	fs.DurationVar(&cfg.ChurnDowntime, "churn_downtime", cfg.ChurnDowntime, "Mean time a crashed node stays offline")
+	fs.IntVar(&cfg.LateJoiners, "late_joiners", cfg.LateJoiners, "Number of non-mining nodes that join at random times and sync the chain from peers")
+	fs.StringVar(&cfg.TieBreak, "tie_break", cfg.TieBreak, "Fork choice between equal-work tips: 'first-seen', 'random' or 'lowest-hash'")
+	fs.StringVar(&cfg.FeeRateDist, "fee_dist", cfg.FeeRateDist, "Fee rate distribution: 'lognormal', 'exponential', 'uniform' or 'none'")
+	fs.Float64Var(&cfg.FeeRateMedian, "fee_median", cfg.FeeRateMedian, "Median fee rate in sat/byte (lognormal, exponential)")
+	fs.Float64Var(&cfg.FeeRateSigma, "fee_sigma", cfg.FeeRateSigma, "Sigma of the log fee rate (lognormal)")
+	fs.Float64Var(&cfg.FeeRateMin, "fee_min", cfg.FeeRateMin, "CLAMP: Minimum fee rate in sat/byte")
+	fs.Float64Var(&cfg.FeeRateMax, "fee_max", cfg.FeeRateMax, "CLAMP: Maximum fee rate in sat/byte")
+	fs.StringVar(&cfg.TxSelection, "tx_selection", cfg.TxSelection, "Block template order: 'random' or 'feerate' (highest first)")
+	fs.IntVar(&cfg.MempoolMaxBytes, "mempool_max_bytes", cfg.MempoolMaxBytes, "Per-node mempool byte limit, lowest fee rate evicted first (0 = unlimited)")
+	fs.DurationVar(&cfg.MempoolExpiry, "mempool_expiry", cfg.MempoolExpiry, "Drop mempool transactions older than this (0 = never)")
+	fs.Float64Var(&cfg.MinRelayFeeRate, "min_relay_fee", cfg.MinRelayFeeRate, "Base minimum relay fee rate in sat/byte (ignored with -fee_dist=none)")
+	fs.Float64Var(&cfg.MinRelayFeeMultiplier, "min_relay_fee_multiplier", cfg.MinRelayFeeMultiplier, "Minimum relay fee multiplier reached when the mempool is full (rises from half full)")
+	fs.StringVar(&cfg.MinerStrategy, "miner_strategy", cfg.MinerStrategy, "Strategy for non-selfish miners: 'honest' or 'empty'")
+	fs.Float64Var(&cfg.MiningFillThreshold, "mining_fill_threshold", cfg.MiningFillThreshold, "Fraction of a block's bytes the mempool must hold before honest miners start mining")
+	fs.IntVar(&cfg.SelfishMiners, "selfish_miners", cfg.SelfishMiners, "Number of miners that follow the selfish mining strategy")
+	fs.Float64Var(&cfg.SelfishHashShare, "selfish_hash_share", cfg.SelfishHashShare, "Combined hash share of the selfish miners (0 keeps the -hash_power distribution)")
+	fs.Float64Var(&cfg.SelfishGamma, "selfish_gamma", cfg.SelfishGamma, "Fraction of honest nodes that adopt the attacker's block in a tie")
+	fs.StringVar(&cfg.TxModel, "tx_model", cfg.TxModel, "Transaction model: 'simple' (opaque payloads), 'utxo' (inputs and outputs) or 'account' (sender, nonce and value)")
+	fs.IntVar(&cfg.NumWallets, "wallets", cfg.NumWallets, "Number of wallets funded at genesis (utxo, account)")
+	fs.Int64Var(&cfg.InitialBalance, "initial_balance", cfg.InitialBalance, "Starting balance of each wallet in satoshis (utxo, account)")
+	fs.Float64Var(&cfg.DoubleSpendRate, "double_spend_rate", cfg.DoubleSpendRate, "Fraction of injected transactions that also get a conflicting spend at another node (utxo, account)")
+	fs.IntVar(&cfg.AttackTrials, "attack_trials", cfg.AttackTrials, "Run this many double-spend attack trials instead of a normal simulation (0 = off)")
+	fs.Float64Var(&cfg.AttackerHashShare, "attacker_hash_share", cfg.AttackerHashShare, "Hash share of the double-spend attacker")
+	fs.IntVar(&cfg.AttackMaxDeficit, "attack_max_deficit", cfg.AttackMaxDeficit, "Blocks behind the public chain at which the double-spend attacker gives up")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "Random seed for a reproducible run (0 picks one from the clock)")
+	fs.IntVar(&cfg.ConfirmDepth, "confirm_depth", cfg.ConfirmDepth, "Block depth required to consider a transaction confirmed")
+}
+
+// ConfigError is a setting the simulator cannot run with. Flag is the
+// command-line flag at fault, which is also the setting's name in a scenario
+// file.
+type ConfigError struct {
+	Flag string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return "-" + e.Flag + ": " + e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func invalidFlag(flag, format string, args ...interface{}) error {
+	return &ConfigError{Flag: flag, Err: fmt.Errorf(format, args...)}
+}
+
+// validateConfig checks cfg for settings the simulator cannot run with and
+// returns a *ConfigError for the first one found. It also derives
+// TargetBlockInterval from the find time range when it is unset.
+func validateConfig(cfg *Config) error {
+	if cfg.NumMiners > cfg.NumNodes {
+		return invalidFlag("miners", "number of miners (%d) cannot exceed number of nodes (%d)", cfg.NumMiners, cfg.NumNodes)
+	}
+	if cfg.NetworkDelayMin > cfg.NetworkDelayMax {
+		return invalidFlag("delay_min", "minimum network delay (%v) cannot exceed maximum network delay (%v)", cfg.NetworkDelayMin, cfg.NetworkDelayMax)
+	}
+	if cfg.UploadMbps < 0 {
+		return invalidFlag("upload_mbps", "bandwidth must be non-negative (0 = unlimited)")
+	}
+	if cfg.DownloadMbps < 0 {
+		return invalidFlag("download_mbps", "bandwidth must be non-negative (0 = unlimited)")
+	}
+	if cfg.Regions == RegionsFile && cfg.LatencyMatrixFile == "" {
+		return invalidFlag("latency_matrix", "required with -regions=file")
+	}
+	if _, err := LoadRegionTable(cfg); err != nil {
+		if cfg.Regions == RegionsFile {
+			return &ConfigError{Flag: "latency_matrix", Err: err}
+		}
+		return &ConfigError{Flag: "regions", Err: err}
+	}
+	if cfg.LatencyJitter < 0 {
+		return invalidFlag("latency_jitter", "latency jitter (%.2f) must be non-negative", cfg.LatencyJitter)
+	}
+	if cfg.PacketLoss < 0 || cfg.PacketLoss >= 1 {
+		return invalidFlag("packet_loss", "probability (%g) must be in [0, 1)", cfg.PacketLoss)
+	}
+	if cfg.PacketDuplication < 0 || cfg.PacketDuplication >= 1 {
+		return invalidFlag("packet_dup", "probability (%g) must be in [0, 1)", cfg.PacketDuplication)
+	}
+	if cfg.ReorderJitter < 0 {
+		return invalidFlag("reorder_jitter", "reorder jitter must be non-negative")
+	}
+	if cfg.RequestTimeout < 0 {
+		return invalidFlag("request_timeout", "request timeout must be non-negative")
+	}
+	if cfg.SimulationDuration <= 0 {
+		return invalidFlag("duration", "simulation duration (%v) must be positive", cfg.SimulationDuration)
+	}
+	if cfg.BlockSizeLimitBytes <= 0 {
+		return invalidFlag("block_size_bytes", "block size limit (%d) must be positive", cfg.BlockSizeLimitBytes)
+	}
+	if cfg.MinTransactionSizeBytes <= 0 {
+		return invalidFlag("tx_size_min", "min transaction size must be positive")
+	}
+	if cfg.MaxTransactionSizeBytes < cfg.MinTransactionSizeBytes {
+		return invalidFlag("tx_size_max", "max transaction size cannot be less than min transaction size")
+	}
+	if cfg.RelayMode != RelayBroadcast && cfg.RelayMode != RelayGossip {
+		return invalidFlag("relay", "unknown relay mode %q (expected %q or %q)", cfg.RelayMode, RelayBroadcast, RelayGossip)
+	}
+	if cfg.RelayProtocol != RelayPush && cfg.RelayProtocol != RelayInv {
+		return invalidFlag("relay_protocol", "unknown relay protocol %q (expected %q or %q)", cfg.RelayProtocol, RelayPush, RelayInv)
+	}
+	switch cfg.Topology {
+	case TopologyRandom, TopologyRegular, TopologyErdosRenyi, TopologyScaleFree, TopologySmallWorld, TopologyStar:
+	case TopologyFile:
+		if cfg.TopologyFile == "" {
+			return invalidFlag("topology_file", "required with -topology=file")
+		}
+	default:
+		return invalidFlag("topology", "unknown topology %q", cfg.Topology)
+	}
+	if cfg.PeerDegree < 1 {
+		return invalidFlag("degree", "peer degree (%d) must be at least 1", cfg.PeerDegree)
+	}
+	if cfg.RewireProb < 0 || cfg.RewireProb > 1 {
+		return invalidFlag("rewire_prob", "probability (%g) must be in [0, 1]", cfg.RewireProb)
+	}
+	if cfg.Hubs < 1 {
+		return invalidFlag("hubs", "hub count (%d) must be at least 1", cfg.Hubs)
+	}
+	if cfg.MaxOutbound < 0 {
+		return invalidFlag("max_outbound", "connection limit must be non-negative (0 = unlimited)")
+	}
+	if cfg.MaxInbound < 0 {
+		return invalidFlag("max_inbound", "connection limit must be non-negative (0 = unlimited)")
+	}
+	if cfg.CompactExtraTxs < 0 {
+		return invalidFlag("compact_extra_txs", "number of extra transactions must be non-negative")
+	}
+	if cfg.TieBreak != TieBreakFirstSeen && cfg.TieBreak != TieBreakRandom && cfg.TieBreak != TieBreakLowestHash {
+		return invalidFlag("tie_break", "unknown tie-breaking policy %q", cfg.TieBreak)
+	}
+	switch cfg.FeeRateDist {
+	case FeeDistNone, FeeDistLognormal, FeeDistExponential, FeeDistUniform:
+	default:
+		return invalidFlag("fee_dist", "unknown fee rate distribution %q", cfg.FeeRateDist)
+	}
+	if cfg.FeeRateMin < 0 {
+		return invalidFlag("fee_min", "fee rate must be non-negative")
+	}
+	if cfg.FeeRateMax < cfg.FeeRateMin {
+		return invalidFlag("fee_max", "fee_max (%g) cannot be less than fee_min (%g)", cfg.FeeRateMax, cfg.FeeRateMin)
+	}
+	if cfg.FeeRateMedian <= 0 {
+		return invalidFlag("fee_median", "median fee rate must be positive")
+	}
+	if cfg.MempoolMaxBytes < 0 {
+		return invalidFlag("mempool_max_bytes", "mempool limit must be non-negative (0 = unlimited)")
+	}
+	if cfg.MempoolExpiry < 0 {
+		return invalidFlag("mempool_expiry", "mempool expiry must be non-negative (0 = never)")
+	}
+	if cfg.MinRelayFeeRate < 0 {
+		return invalidFlag("min_relay_fee", "minimum relay fee rate must be non-negative")
+	}
+	if cfg.MinRelayFeeMultiplier < 1 {
+		return invalidFlag("min_relay_fee_multiplier", "multiplier (%g) must be at least 1", cfg.MinRelayFeeMultiplier)
+	}
+	if cfg.TxSelection != TxSelectionFeeRate && cfg.TxSelection != TxSelectionRandom {
+		return invalidFlag("tx_selection", "unknown transaction selection %q", cfg.TxSelection)
+	}
+	if _, err := NewMinerStrategy(cfg.MinerStrategy, cfg); err != nil {
+		return &ConfigError{Flag: "miner_strategy", Err: err}
+	}
+	if cfg.SelfishMiners < 0 || cfg.SelfishMiners > cfg.NumMiners {
+		return invalidFlag("selfish_miners", "selfish miners (%d) must be between 0 and the number of miners (%d)", cfg.SelfishMiners, cfg.NumMiners)
+	}
+	if cfg.SelfishHashShare < 0 || cfg.SelfishHashShare >= 1 {
+		return invalidFlag("selfish_hash_share", "selfish hash share (%.2f) must be in [0, 1)", cfg.SelfishHashShare)
+	}
+	if cfg.SelfishGamma < 0 || cfg.SelfishGamma > 1 {
+		return invalidFlag("selfish_gamma", "selfish gamma (%.2f) must be in [0, 1]", cfg.SelfishGamma)
+	}
+	switch cfg.TxModel {
+	case TxModelSimple:
+	case TxModelUTXO, TxModelAccount:
+		if cfg.NumWallets <= 0 {
+			return invalidFlag("wallets", "the %s model needs a positive number of wallets", cfg.TxModel)
+		}
+		if cfg.InitialBalance <= 0 {
+			return invalidFlag("initial_balance", "the %s model needs a positive initial balance", cfg.TxModel)
+		}
+	default:
+		return invalidFlag("tx_model", "unknown transaction model %q (expected %q, %q or %q)", cfg.TxModel, TxModelSimple, TxModelUTXO, TxModelAccount)
+	}
+	if cfg.DoubleSpendRate < 0 || cfg.DoubleSpendRate > 1 {
+		return invalidFlag("double_spend_rate", "double spend rate (%.2f) must be in [0, 1]", cfg.DoubleSpendRate)
+	}
+	if cfg.AttackTrials < 0 {
+		return invalidFlag("attack_trials", "trial count must be non-negative (0 = off)")
+	}
+	if cfg.AttackerHashShare <= 0 || cfg.AttackerHashShare >= 1 {
+		return invalidFlag("attacker_hash_share", "attacker hash share (%.2f) must be in (0, 1)", cfg.AttackerHashShare)
+	}
+	if cfg.AttackMaxDeficit < 1 {
+		return invalidFlag("attack_max_deficit", "deficit (%d) must be at least 1", cfg.AttackMaxDeficit)
+	}
+	if cfg.AttackTrials > 0 && cfg.NumMiners < 2 {
+		return invalidFlag("miners", "double-spend trials need at least two miners")
+	}
+	if cfg.ConfirmDepth < 1 {
+		return invalidFlag("confirm_depth", "confirmation depth (%d) must be at least 1", cfg.ConfirmDepth)
+	}
+	if cfg.MiningModel != MiningExponential && cfg.MiningModel != MiningUniform {
+		return invalidFlag("mining_model", "unknown mining model %q (expected %q or %q)", cfg.MiningModel, MiningExponential, MiningUniform)
+	}
+	// Uniform find times ignore hash power. Attack trials always run the
+	// exponential model.
+	if cfg.MiningModel == MiningUniform && cfg.AttackTrials == 0 {
+		if cfg.HashPowerDist != HashPowerUniform {
+			return invalidFlag("hash_power", "-hash_power=%s needs -mining_model=exponential", cfg.HashPowerDist)
+		}
+		if cfg.SelfishHashShare > 0 {
+			return invalidFlag("selfish_hash_share", "needs -mining_model=exponential")
+		}
+	}
+	if cfg.HashPowerDist == HashPowerFile && cfg.HashPowerFile == "" {
+		return invalidFlag("hash_power_file", "required with -hash_power=file")
+	}
+	if cfg.TargetBlockInterval <= 0 {
+		cfg.TargetBlockInterval = (cfg.FindTimeMin + cfg.FindTimeMax) / 2.0
+	}
+	if _, err := NewDifficultyAdjuster(cfg); err != nil {
+		flag := "difficulty"
+		switch cfg.DifficultyAlgorithm {
+		case DifficultyBitcoin:
+			flag = "retarget_interval"
+		case DifficultyLWMA:
+			flag = "lwma_window"
+		}
+		return &ConfigError{Flag: flag, Err: err}
+	}
+	if _, err := ParseHashRateSchedule(cfg.HashRateSchedule); err != nil {
+		return &ConfigError{Flag: "hashrate_schedule", Err: err}
+	}
+	if _, err := ParsePartitionSchedule(cfg.PartitionSchedule, cfg.NumNodes); err != nil {
+		return &ConfigError{Flag: "partition_schedule", Err: err}
+	}
+	if _, err := ParseTxBurstSchedule(cfg.TxBurstSchedule); err != nil {
+		return &ConfigError{Flag: "tx_bursts", Err: err}
+	}
+	if cfg.PartitionMode != PartitionDrop && cfg.PartitionMode != PartitionHold {
+		return invalidFlag("partition_mode", "unknown partition mode %q (expected %q or %q)", cfg.PartitionMode, PartitionDrop, PartitionHold)
+	}
+	if cfg.ChurnInterval < 0 {
+		return invalidFlag("churn_interval", "churn interval must be non-negative (0 = no churn)")
+	}
+	if cfg.ChurnDowntime <= 0 {
+		return invalidFlag("churn_downtime", "churn downtime must be positive")
+	}
+	if cfg.LateJoiners < 0 || cfg.LateJoiners > cfg.NumNodes-cfg.NumMiners {
+		return invalidFlag("late_joiners", "late joiners (%d) must be between 0 and the number of non-mining nodes (%d)", cfg.LateJoiners, cfg.NumNodes-cfg.NumMiners)
 	}
+	return checkNodeOverrides(cfg)
 }
@@ -0,0 +1,91 @@
+package main
+
+import "time"
+
+// ConfirmationTracker follows the best chain of the reference node and marks
+// transactions confirmed once their block is buried Depth blocks deep
+// (the including block counts as the first confirmation).
+type ConfirmationTracker struct {
+	Sim             *Simulation
+	Depth           int
+	ConfirmedCount  int
+	RevertedCount   int
+	confirmedBlocks map[string]bool
+}
+
+func NewConfirmationTracker(sim *Simulation, depth int) *ConfirmationTracker {
+	return &ConfirmationTracker{
+		Sim:             sim,
+		Depth:           depth,
+		confirmedBlocks: make(map[string]bool),
+	}
+}
+
+// OnTipChanged walks back from the node's new best tip and confirms every
+// block that has reached the required depth and was not confirmed before.
+func (ct *ConfirmationTracker) OnTipChanged(n *Node) {
+	tip, ok := n.Blocks[n.BestChainTip]
+	if !ok {
+		return
+	}
+	confirmHeight := tip.Header.Height - ct.Depth + 1
+	if confirmHeight < 1 {
+		return
+	}
+
+	current := tip
+	for current.Header.Height > confirmHeight {
+		parent, ok := n.Blocks[current.Header.PrevHash]
+		if !ok {
+			return
+		}
+		current = parent
+	}
+
+	for current.Header.Height > 0 && !ct.confirmedBlocks[current.Hash] {
+		ct.confirmBlock(current)
+		parent, ok := n.Blocks[current.Header.PrevHash]
+		if !ok {
+			return
+		}
+		current = parent
+	}
+}
+
+func (ct *ConfirmationTracker) confirmBlock(b *Block) {
+	ct.confirmedBlocks[b.Hash] = true
+	for _, tx := range b.Transactions {
+		ct.Sim.TxSource.ConfirmTx(tx)
+		meta, exists := ct.Sim.TxStatus[tx.ID]
+		if !exists || meta.IsConfirmed {
+			continue
+		}
+		meta.IsConfirmed = true
+		meta.ConfirmedTime = ct.Sim.CurrentTime
+		meta.IncludedInBlock = b.Hash
+		ct.ConfirmedCount++
+	}
+}
+
+// RevertBlocks un-confirms the transactions of blocks that a reorg removed
+// from the reference chain, and hands any double-spend pairs they settled
+// back to the transaction source.
+func (ct *ConfirmationTracker) RevertBlocks(staleBlocks []*Block) {
+	for _, b := range staleBlocks {
+		if !ct.confirmedBlocks[b.Hash] {
+			continue
+		}
+		delete(ct.confirmedBlocks, b.Hash)
+		for _, tx := range b.Transactions {
+			ct.Sim.TxSource.UnconfirmTx(tx)
+			meta, exists := ct.Sim.TxStatus[tx.ID]
+			if !exists || !meta.IsConfirmed || meta.IncludedInBlock != b.Hash {
+				continue
+			}
+			meta.IsConfirmed = false
+			meta.ConfirmedTime = time.Time{}
+			ct.ConfirmedCount--
+			ct.RevertedCount++
+		}
+	}
+}
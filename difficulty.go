@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DifficultyNone     = "none"
+	DifficultyBitcoin  = "bitcoin"
+	DifficultyEthereum = "ethereum"
+	DifficultyLWMA     = "lwma"
+
+	// GenesisDifficulty is the difficulty at which the initial network hash
+	// rate finds blocks every TargetBlockInterval on average.
+	GenesisDifficulty = 1.0
+	minDifficulty     = 1e-6
+)
+
+// BlockLookup resolves a block hash in some node's view of the block tree.
+type BlockLookup func(hash string) (*Block, bool)
+
+// DifficultyAdjuster decides the difficulty of the block built on parent.
+// Implementations must be deterministic so every node computes the same value
+// and can validate incoming blocks.
+type DifficultyAdjuster interface {
+	Name() string
+	NextDifficulty(lookup BlockLookup, parent *Block) float64
+}
+
+func NewDifficultyAdjuster(cfg *Config) (DifficultyAdjuster, error) {
+	switch cfg.DifficultyAlgorithm {
+	case DifficultyNone:
+		return FixedDifficulty{}, nil
+	case DifficultyBitcoin:
+		if cfg.RetargetInterval < 2 {
+			return nil, fmt.Errorf("retarget interval must be at least 2, got %d", cfg.RetargetInterval)
+		}
+		return BitcoinRetarget{Interval: cfg.RetargetInterval, Target: cfg.TargetBlockInterval}, nil
+	case DifficultyEthereum:
+		return EthereumRetarget{Target: cfg.TargetBlockInterval}, nil
+	case DifficultyLWMA:
+		if cfg.LWMAWindow < 2 {
+			return nil, fmt.Errorf("LWMA window must be at least 2, got %d", cfg.LWMAWindow)
+		}
+		return LWMARetarget{Window: cfg.LWMAWindow, Target: cfg.TargetBlockInterval}, nil
+	}
+	return nil, fmt.Errorf("unknown difficulty algorithm %q", cfg.DifficultyAlgorithm)
+}
+
+// FixedDifficulty never retargets.
+type FixedDifficulty struct{}
+
+func (FixedDifficulty) Name() string { return DifficultyNone }
+
+func (FixedDifficulty) NextDifficulty(lookup BlockLookup, parent *Block) float64 {
+	return parent.Header.Difficulty
+}
+
+// BitcoinRetarget recomputes difficulty every Interval blocks from the time
+// the previous period took, clamped to a factor of 4. Like Bitcoin it measures
+// Interval-1 block intervals against a timespan of Interval targets.
+type BitcoinRetarget struct {
+	Interval int
+	Target   time.Duration
+}
+
+func (BitcoinRetarget) Name() string { return DifficultyBitcoin }
+
+func (r BitcoinRetarget) NextDifficulty(lookup BlockLookup, parent *Block) float64 {
+	if (parent.Header.Height+1)%r.Interval != 0 {
+		return parent.Header.Difficulty
+	}
+	first, ok := ancestorAt(lookup, parent, parent.Header.Height-(r.Interval-1))
+	if !ok {
+		return parent.Header.Difficulty
+	}
+	expected := r.Target.Seconds() * float64(r.Interval)
+	actual := parent.FoundTime.Sub(first.FoundTime).Seconds()
+	actual = math.Max(actual, expected/4)
+	actual = math.Min(actual, expected*4)
+	return math.Max(minDifficulty, parent.Header.Difficulty*expected/actual)
+}
+
+// EthereumRetarget adjusts every block in the style of Homestead:
+// D + D/2048 * max(1 - floor(dt/unit), -99). With exponential block times the
+// adjustment is zero on average when unit = Target*ln2, so the mean interval
+// settles on Target.
+type EthereumRetarget struct {
+	Target time.Duration
+}
+
+func (EthereumRetarget) Name() string { return DifficultyEthereum }
+
+func (r EthereumRetarget) NextDifficulty(lookup BlockLookup, parent *Block) float64 {
+	grandparent, ok := lookup(parent.Header.PrevHash)
+	if !ok || parent.Header.Height == 0 {
+		return parent.Header.Difficulty
+	}
+	unit := r.Target.Seconds() * math.Ln2
+	dt := parent.FoundTime.Sub(grandparent.FoundTime).Seconds()
+	adjustment := math.Max(1-math.Floor(dt/unit), -99)
+	next := parent.Header.Difficulty + parent.Header.Difficulty/2048*adjustment
+	return math.Max(minDifficulty, next)
+}
+
+// LWMARetarget is zawy12's linearly weighted moving average: recent solve
+// times weigh more, so it reacts to hash rate changes within a few blocks.
+type LWMARetarget struct {
+	Window int
+	Target time.Duration
+}
+
+func (LWMARetarget) Name() string { return DifficultyLWMA }
+
+func (r LWMARetarget) NextDifficulty(lookup BlockLookup, parent *Block) float64 {
+	if parent.Header.Height < r.Window {
+		return parent.Header.Difficulty
+	}
+	// blocks[0] is the oldest; blocks[Window] is the parent.
+	blocks := make([]*Block, r.Window+1)
+	current := parent
+	for i := r.Window; i >= 0; i-- {
+		blocks[i] = current
+		if i > 0 {
+			prev, ok := lookup(current.Header.PrevHash)
+			if !ok {
+				return parent.Header.Difficulty
+			}
+			current = prev
+		}
+	}
+
+	target := r.Target.Seconds()
+	weightedSolveTimes := 0.0
+	difficultySum := 0.0
+	for i := 1; i <= r.Window; i++ {
+		solveTime := blocks[i].FoundTime.Sub(blocks[i-1].FoundTime).Seconds()
+		solveTime = math.Min(math.Max(solveTime, -6*target), 6*target)
+		weightedSolveTimes += float64(i) * solveTime
+		difficultySum += blocks[i].Header.Difficulty
+	}
+	k := float64(r.Window*(r.Window+1)) / 2 * target
+	weightedSolveTimes = math.Max(weightedSolveTimes, k/10)
+	return math.Max(minDifficulty, difficultySum/float64(r.Window)*k/weightedSolveTimes)
+}
+
+func ancestorAt(lookup BlockLookup, from *Block, height int) (*Block, bool) {
+	if height < 0 || height > from.Header.Height {
+		return nil, false
+	}
+	current := from
+	for current.Header.Height > height {
+		prev, ok := lookup(current.Header.PrevHash)
+		if !ok {
+			return nil, false
+		}
+		current = prev
+	}
+	return current, true
+}
+
+type HashRateChange struct {
+	At         time.Duration
+	Multiplier float64
+}
+
+// ParseHashRateSchedule parses "2h:0.5,4h:1" into hash rate multipliers applied
+// at the given simulated offsets.
+func ParseHashRateSchedule(spec string) ([]HashRateChange, error) {
+	changes := []HashRateChange{}
+	if strings.TrimSpace(spec) == "" {
+		return changes, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid hash rate change %q (expected <time>:<multiplier>)", entry)
+		}
+		at, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash rate change time %q: %w", parts[0], err)
+		}
+		if at < 0 {
+			return nil, fmt.Errorf("invalid hash rate change time %q", parts[0])
+		}
+		multiplier, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || multiplier <= 0 {
+			return nil, fmt.Errorf("invalid hash rate multiplier %q", parts[1])
+		}
+		changes = append(changes, HashRateChange{At: at, Multiplier: multiplier})
+	}
+	return changes, nil
+}
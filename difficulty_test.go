@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// testChain builds a chain from a genesis block at difficulty, with each later
+// block found intervals[i] after its parent. It returns the blocks by height.
+func testChain(difficulty float64, intervals []time.Duration) (BlockLookup, []*Block) {
+	byHash := make(map[string]*Block)
+	genesis := &Block{Hash: "block-0", Header: BlockHeader{Difficulty: difficulty}, FoundTime: time.Unix(0, 0)}
+	blocks := []*Block{genesis}
+	byHash[genesis.Hash] = genesis
+	for i, interval := range intervals {
+		parent := blocks[i]
+		b := &Block{
+			Hash:      fmt.Sprintf("block-%d", i+1),
+			Header:    BlockHeader{Height: i + 1, PrevHash: parent.Hash, Difficulty: difficulty},
+			FoundTime: parent.FoundTime.Add(interval),
+		}
+		blocks = append(blocks, b)
+		byHash[b.Hash] = b
+	}
+	lookup := func(hash string) (*Block, bool) {
+		b, ok := byHash[hash]
+		return b, ok
+	}
+	return lookup, blocks
+}
+
+func steadyIntervals(n int, interval time.Duration) []time.Duration {
+	intervals := make([]time.Duration, n)
+	for i := range intervals {
+		intervals[i] = interval
+	}
+	return intervals
+}
+
+func approxEqual(got, want, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance*math.Max(1, math.Abs(want))
+}
+
+func TestBitcoinRetarget(t *testing.T) {
+	r := BitcoinRetarget{Interval: 2016, Target: 10 * time.Minute}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		parent   int
+		want     float64
+	}{
+		// The period spans 2015 intervals but is measured against 2016.
+		{"on target", 10 * time.Minute, 2015, 2016.0 / 2015},
+		{"twice as fast", 5 * time.Minute, 2015, 2 * 2016.0 / 2015},
+		{"twice as slow", 20 * time.Minute, 2015, 2016.0 / 2015 / 2},
+		{"clamped to 4x up", time.Minute, 2015, 4},
+		{"clamped to 4x down", 100 * time.Minute, 2015, 0.25},
+		{"between retargets", time.Minute, 2014, 1},
+	}
+	for _, tt := range tests {
+		lookup, blocks := testChain(1, steadyIntervals(tt.parent, tt.interval))
+		if got := r.NextDifficulty(lookup, blocks[tt.parent]); !approxEqual(got, tt.want, 1e-12) {
+			t.Errorf("%s: NextDifficulty = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEthereumRetarget(t *testing.T) {
+	r := EthereumRetarget{Target: 13 * time.Second}
+	unit := time.Duration(r.Target.Seconds() * math.Ln2 * float64(time.Second))
+	tests := []struct {
+		name string
+		dt   time.Duration
+		want float64
+	}{
+		{"fast block", unit / 2, 2048 + 1},
+		{"one unit", unit + time.Millisecond, 2048},
+		{"three units", 3*unit + time.Millisecond, 2048 - 2},
+		{"clamped at -99", 1000 * unit, 2048 - 99},
+	}
+	for _, tt := range tests {
+		lookup, blocks := testChain(2048, []time.Duration{13 * time.Second, tt.dt})
+		if got := r.NextDifficulty(lookup, blocks[2]); !approxEqual(got, tt.want, 1e-12) {
+			t.Errorf("%s: NextDifficulty = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLWMARetarget(t *testing.T) {
+	r := LWMARetarget{Window: 60, Target: 2 * time.Minute}
+	tests := []struct {
+		name     string
+		interval time.Duration
+		blocks   int
+		want     float64
+	}{
+		{"on target", 2 * time.Minute, 60, 1},
+		{"hash rate doubled", time.Minute, 60, 2},
+		{"hash rate halved", 4 * time.Minute, 100, 0.5},
+		{"solve times clamped", 0, 60, 10},
+		{"window not filled", time.Minute, 59, 1},
+	}
+	for _, tt := range tests {
+		lookup, blocks := testChain(1, steadyIntervals(tt.blocks, tt.interval))
+		if got := r.NextDifficulty(lookup, blocks[tt.blocks]); !approxEqual(got, tt.want, 1e-12) {
+			t.Errorf("%s: NextDifficulty = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseHashRateSchedule(t *testing.T) {
+	changes, err := ParseHashRateSchedule("2h:0.5, 4h:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []HashRateChange{{At: 2 * time.Hour, Multiplier: 0.5}, {At: 4 * time.Hour, Multiplier: 1}}
+	if fmt.Sprint(changes) != fmt.Sprint(want) {
+		t.Errorf("ParseHashRateSchedule = %v, want %v", changes, want)
+	}
+	for _, spec := range []string{"2h", "2x:0.5", "-1h:2", "2h:0", "2h:-1", "2h:fast"} {
+		if _, err := ParseHashRateSchedule(spec); err == nil {
+			t.Errorf("ParseHashRateSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
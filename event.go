@@ -12,6 +12,20 @@ const (
 	EvAttemptMining
 	EvBlockFound
 	EvReceiveBlock
+	EvHashRateChange
+	EvInv
+	EvGetData
+	EvHeaders
+	EvCmpctBlock
+	EvGetBlockTxn
+	EvBlockTxn
+	EvPartitionChange
+	EvGetHeaders
+	EvNodeDown
+	EvNodeUp
+	EvRequestTimeout
+	EvTxBurst
+	EvNotFound
 )
 
 type Event struct {
@@ -20,12 +34,14 @@ type Event struct {
 	Data      interface{}
 	Priority  int
 	index     int
+	seq       uint64
 }
 
 type InjectTransactionData struct{}
 type ReceiveTransactionData struct {
 	TargetNodeID int
-	Tx           Transaction
+	FromNodeID   int
+	Tx           *Transaction
 }
 type AttemptMiningData struct {
 	MinerNodeID     int
@@ -38,9 +54,86 @@ type BlockFoundData struct {
 }
 type ReceiveBlockData struct {
 	TargetNodeID int
+	FromNodeID   int
 	Block        Block
 }
 
+// InvData is an inv announcement, a getdata request or a notfound reply for
+// Kind (MsgTx or MsgBlock) objects.
+type InvData struct {
+	TargetNodeID int
+	FromNodeID   int
+	Kind         string
+	Hashes       []string
+}
+
+// HeadersData is a headers message. Response is set when it answers a
+// getheaders rather than announcing a new block.
+type HeadersData struct {
+	TargetNodeID int
+	FromNodeID   int
+	Hashes       []string
+	Headers      []BlockHeader
+	Response     bool
+}
+
+// GetHeadersData asks for the headers following the first Locator hash that
+// is on the peer's best chain.
+type GetHeadersData struct {
+	TargetNodeID int
+	FromNodeID   int
+	Locator      []string
+}
+
+// CompactBlockData carries a cmpctblock or blocktxn message. The full block
+// travels with it, but only the compact encoding is charged to the link.
+type CompactBlockData struct {
+	TargetNodeID int
+	FromNodeID   int
+	Block        Block
+}
+
+type GetBlockTxnData struct {
+	TargetNodeID int
+	FromNodeID   int
+	BlockHash    string
+	TxIDs        []string
+}
+
+// PartitionChangeData splits the network into Groups, or heals it when Groups
+// is nil.
+type PartitionChangeData struct {
+	Groups [][]int
+}
+
+// NodeChurnData takes a node offline (EvNodeDown) or brings it online
+// (EvNodeUp). Join marks a late joiner's first start.
+type NodeChurnData struct {
+	NodeID int
+	Join   bool
+}
+
+// RequestTimeoutData checks whether a request for Kind objects sent to PeerID
+// was answered. Attempt counts the earlier tries.
+type RequestTimeoutData struct {
+	NodeID  int
+	PeerID  int
+	Kind    string
+	Hashes  []string
+	Attempt int
+}
+
+type HashRateChangeData struct {
+	Multiplier float64
+}
+
+// TxBurstData injects one burst transaction and schedules the next of the
+// Remaining ones after Interval.
+type TxBurstData struct {
+	Remaining int
+	Interval  time.Duration
+}
+
 type EventQueue []*Event
 
 func (eq EventQueue) Len() int { return len(eq) }
@@ -53,7 +146,10 @@ func (eq EventQueue) Less(i, j int) bool {
 		return false
 	}
 
-	return eq[i].Priority < eq[j].Priority
+	if eq[i].Priority != eq[j].Priority {
+		return eq[i].Priority < eq[j].Priority
+	}
+	return eq[i].seq < eq[j].seq
 }
 
 func (eq EventQueue) Swap(i, j int) {
@@ -0,0 +1,52 @@
+package main
+
+const (
+	TieBreakFirstSeen  = "first-seen"
+	TieBreakRandom     = "random"
+	TieBreakLowestHash = "lowest-hash"
+)
+
+// prefersChain reports whether the node should move its best tip to the
+// candidate block. The chain with the most cumulative work always wins; when
+// work is equal the configured tie-breaking policy decides.
+func (n *Node) prefersChain(candidate string) bool {
+	candidateWork := n.ChainWork[candidate]
+	currentWork := n.ChainWork[n.BestChainTip]
+	if !workEqual(candidateWork, currentWork) {
+		if candidateWork > currentWork {
+			n.tiedTips = 1
+			return true
+		}
+		return false
+	}
+
+	n.Stats.ForkTies++
+	if n.Sim.IsSelfish(n.ID) {
+		// An attacker never gives up its own branch for an equal one.
+		return false
+	}
+	if candidateSelfish, currentSelfish := n.Sim.IsSelfish(n.blockMiner(candidate)), n.Sim.IsSelfish(n.blockMiner(n.BestChainTip)); candidateSelfish != currentSelfish {
+		// A tie between an attacker block and an honest one: honest nodes end up
+		// on the attacker's branch with probability gamma, whichever arrived
+		// first.
+		mineOnAttacker := n.Sim.Rand.ForkChoice.Float64() < n.Cfg.SelfishGamma
+		return mineOnAttacker == candidateSelfish
+	}
+	switch n.Cfg.TieBreak {
+	case TieBreakRandom:
+		// Reservoir sampling keeps every tied tip equally likely to end up
+		// chosen, no matter how many arrive or in which order.
+		n.tiedTips++
+		return n.Sim.Rand.ForkChoice.Intn(n.tiedTips) == 0
+	case TieBreakLowestHash:
+		return candidate < n.BestChainTip
+	}
+	return false
+}
+
+func (n *Node) blockMiner(hash string) int {
+	if b, ok := n.Blocks[hash]; ok {
+		return b.Header.MinerID
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPrefersChain(t *testing.T) {
+	tests := []struct {
+		name      string
+		tieBreak  string
+		candidate string
+		work      float64
+		want      bool
+	}{
+		{"more work", TieBreakFirstSeen, "c", 3.5, true},
+		{"less work", TieBreakLowestHash, "a", 2.5, false},
+		{"tie, first seen", TieBreakFirstSeen, "a", 3, false},
+		{"tie, lower hash", TieBreakLowestHash, "a", 3, true},
+		{"tie, higher hash", TieBreakLowestHash, "c", 3, false},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(2, 1)
+		cfg.TieBreak = tt.tieBreak
+		n := newTestSimulation(t, cfg).Nodes[0]
+		n.BestChainTip = "b"
+		n.ChainWork["b"] = 3
+		n.ChainWork[tt.candidate] = tt.work
+		if got := n.prefersChain(tt.candidate); got != tt.want {
+			t.Errorf("%s: prefersChain = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRandomTieBreakIsUniform checks that each of three equal tips ends up
+// chosen about a third of the time, whatever order they arrive in.
+func TestRandomTieBreakIsUniform(t *testing.T) {
+	cfg := testConfig(2, 1)
+	cfg.TieBreak = TieBreakRandom
+	n := newTestSimulation(t, cfg).Nodes[0]
+	tips := []string{"a", "b", "c"}
+	for _, tip := range tips {
+		n.ChainWork[tip] = 5
+	}
+	const trials = 3000
+	chosen := make(map[string]int)
+	for i := 0; i < trials; i++ {
+		n.BestChainTip, n.tiedTips = tips[0], 1
+		for _, tip := range tips[1:] {
+			if n.prefersChain(tip) {
+				n.BestChainTip = tip
+			}
+		}
+		chosen[n.BestChainTip]++
+	}
+	for _, tip := range tips {
+		if share := float64(chosen[tip]) / trials; math.Abs(share-1.0/3) > 0.05 {
+			t.Errorf("tip %s chosen %.3f of the time, want about 1/3", tip, share)
+		}
+	}
+}
+
+func TestReorgToHeavierBranch(t *testing.T) {
+	sim := newTestSimulation(t, testConfig(3, 1))
+	n := sim.Nodes[0]
+	genesis := sim.GenesisBlock.Hash
+	a1 := childBlock(n, genesis, 1)
+	b1 := childBlock(n, genesis, 2)
+	n.ReceiveBlock(a1, -1)
+	n.ReceiveBlock(b1, -1)
+	if n.BestChainTip != a1.Hash || n.Stats.ForkTies != 1 {
+		t.Fatalf("after a tie: tip %s, %d ties; want the first-seen block and 1 tie", n.BestChainTip[:6], n.Stats.ForkTies)
+	}
+	b2 := childBlock(n, b1.Hash, 2)
+	n.ReceiveBlock(b2, -1)
+	if n.BestChainTip != b2.Hash {
+		t.Errorf("tip = %s, want the heavier branch's %s", n.BestChainTip[:6], b2.Hash[:6])
+	}
+	if n.Stats.HandledReorgs != 1 || n.Stats.StaleBlocksInReorg != 1 || sim.GlobalStaleCount != 1 {
+		t.Errorf("reorgs %d, stale blocks %d, global stale %d; want 1, 1, 1",
+			n.Stats.HandledReorgs, n.Stats.StaleBlocksInReorg, sim.GlobalStaleCount)
+	}
+	if !workEqual(n.ChainWork[b2.Hash], 2*GenesisDifficulty) {
+		t.Errorf("chain work = %v, want 2", n.ChainWork[b2.Hash])
+	}
+}
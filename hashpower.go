@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	HashPowerUniform = "uniform"
+	HashPowerZipf    = "zipf"
+	HashPowerFile    = "file"
+)
+
+// AssignHashPower returns each miner's share of the total hash rate. Shares
+// always sum to 1; miners with a hash_power override get exactly that share.
+func AssignHashPower(cfg *Config, minerIDs []int) (map[int]float64, error) {
+	weights := make(map[int]float64, len(minerIDs))
+	switch cfg.HashPowerDist {
+	case HashPowerUniform:
+		for _, id := range minerIDs {
+			weights[id] = 1.0
+		}
+	case HashPowerZipf:
+		for rank, id := range minerIDs {
+			weights[id] = 1.0 / math.Pow(float64(rank+1), cfg.ZipfExponent)
+		}
+	case HashPowerFile:
+		fileWeights, err := loadHashPowerFile(cfg.HashPowerFile, minerIDs)
+		if err != nil {
+			return nil, err
+		}
+		weights = fileWeights
+	default:
+		return nil, fmt.Errorf("unknown hash power distribution %q", cfg.HashPowerDist)
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("total hash power must be positive")
+	}
+	for id := range weights {
+		weights[id] /= total
+	}
+	return fixHashShares(cfg.NodeOverrides, weights)
+}
+
+// loadHashPowerFile reads one weight per line. A line is either "<weight>",
+// assigned to miners in order, or "<nodeID> <weight>" for an explicit miner.
+// Blank lines and lines starting with '#' are ignored.
+func loadHashPowerFile(path string, minerIDs []int) (map[int]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening hash power file: %w", err)
+	}
+	defer f.Close()
+
+	isMiner := make(map[int]bool, len(minerIDs))
+	for _, id := range minerIDs {
+		isMiner[id] = true
+	}
+	weights := make(map[int]float64, len(minerIDs))
+	nextMiner := 0
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		var nodeID int
+		var weightStr string
+		switch len(fields) {
+		case 1:
+			if nextMiner >= len(minerIDs) {
+				return nil, fmt.Errorf("%s:%d: more weights than miners (%d)", path, lineNum, len(minerIDs))
+			}
+			nodeID = minerIDs[nextMiner]
+			nextMiner++
+			weightStr = fields[0]
+		case 2:
+			nodeID, err = strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid node ID %q", path, lineNum, fields[0])
+			}
+			if !isMiner[nodeID] {
+				return nil, fmt.Errorf("%s:%d: node %d is not a miner", path, lineNum, nodeID)
+			}
+			weightStr = fields[1]
+		default:
+			return nil, fmt.Errorf("%s:%d: expected '<weight>' or '<nodeID> <weight>'", path, lineNum)
+		}
+		weight, err := strconv.ParseFloat(weightStr, 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("%s:%d: invalid weight %q", path, lineNum, weightStr)
+		}
+		weights[nodeID] = weight
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading hash power file: %w", err)
+	}
+	for _, id := range minerIDs {
+		if _, ok := weights[id]; !ok {
+			weights[id] = 0
+		}
+	}
+	return weights, nil
+}
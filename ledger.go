@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	TxModelSimple  = "simple"
+	TxModelUTXO    = "utxo"
+	TxModelAccount = "account"
+)
+
+var (
+	// ErrMissingInputs means a transaction depends on state the node has not
+	// seen yet; it may become valid once its parent arrives.
+	ErrMissingInputs = errors.New("missing inputs")
+	// ErrConflict means a transaction spends something already spent by the
+	// chain or by another mempool transaction.
+	ErrConflict = errors.New("conflicting transaction")
+	// ErrInvalidTx means a transaction is invalid on any chain, for example
+	// because it creates coins or misstates its fee.
+	ErrInvalidTx = errors.New("invalid transaction")
+)
+
+// MissingInputsError names the unknown parent a transaction is waiting for.
+// It matches ErrMissingInputs with errors.Is.
+type MissingInputsError struct {
+	ParentID string
+}
+
+func (e *MissingInputsError) Error() string {
+	return fmt.Sprintf("%v: parent %s", ErrMissingInputs, e.ParentID)
+}
+
+func (e *MissingInputsError) Is(target error) bool { return target == ErrMissingInputs }
+
+// Ledger is a node's chain state under some transaction model. It always
+// reflects the node's best chain tip: blocks are connected and disconnected as
+// the tip moves, and mempool transactions are validated on top of it.
+type Ledger interface {
+	// ConnectBlock applies b on top of the current state. If b is invalid it
+	// returns an error and leaves the state unchanged.
+	ConnectBlock(b Block) error
+	// DisconnectBlock undoes b, which must be the most recently connected
+	// block.
+	DisconnectBlock(b Block)
+	// CheckTx validates tx against the chain state plus the mempool.
+	CheckTx(tx Transaction) error
+	// MempoolAdded and MempoolRemoved keep mempool-level indexes in sync.
+	MempoolAdded(tx Transaction)
+	MempoolRemoved(tx Transaction)
+	// MempoolConflicts returns the IDs of mempool transactions, and their
+	// mempool descendants, that became invalid because b was connected.
+	MempoolConflicts(b Block) []string
+	// PackBlock picks transactions from candidates, in preference order, that
+	// form a valid block of at most maxBytes on top of the current state.
+	PackBlock(candidates []Transaction, maxBytes int) []Transaction
+}
+
+func NewLedger(model string, n *Node) (Ledger, error) {
+	switch model {
+	case TxModelSimple:
+		return SimpleLedger{}, nil
+	case TxModelUTXO:
+		return NewUTXOLedger(n), nil
+	case TxModelAccount:
+		return NewAccountLedger(n), nil
+	}
+	return nil, fmt.Errorf("unknown transaction model %q", model)
+}
+
+// SimpleLedger treats transactions as opaque payloads: every transaction is
+// valid and never conflicts with another.
+type SimpleLedger struct{}
+
+func (SimpleLedger) ConnectBlock(b Block) error { return nil }
+
+func (SimpleLedger) DisconnectBlock(b Block) {}
+
+func (SimpleLedger) CheckTx(tx Transaction) error { return nil }
+
+func (SimpleLedger) MempoolAdded(tx Transaction) {}
+
+func (SimpleLedger) MempoolRemoved(tx Transaction) {}
+
+func (SimpleLedger) MempoolConflicts(b Block) []string { return nil }
+
+func (SimpleLedger) PackBlock(candidates []Transaction, maxBytes int) []Transaction {
+	selectedTxs := []Transaction{}
+	currentBlockSizeBytes := 0
+	for _, tx := range candidates {
+		if currentBlockSizeBytes+tx.Size <= maxBytes {
+			selectedTxs = append(selectedTxs, tx)
+			currentBlockSizeBytes += tx.Size
+		}
+	}
+	return selectedTxs
+}
+
+// switchChainState moves the node's ledger from oldTip to newTip by
+// disconnecting the old branch and connecting the new one, and returns the
+// connected blocks. If a block on the new branch is invalid it is marked as
+// such, the ledger is restored to oldTip and the error is returned.
+func (n *Node) switchChainState(oldTip, newTip string) ([]Block, error) {
+	ancestor := n.findCommonAncestor(oldTip, newTip)
+	if ancestor == "" {
+		return nil, fmt.Errorf("no common ancestor between %s and %s", oldTip[:6], newTip[:6])
+	}
+	oldBranch := n.branchFrom(ancestor, oldTip)
+	newBranch := n.branchFrom(ancestor, newTip)
+
+	for i := len(oldBranch) - 1; i >= 0; i-- {
+		n.Ledger.DisconnectBlock(oldBranch[i])
+	}
+	for i, b := range newBranch {
+		if err := n.Ledger.ConnectBlock(b); err != nil {
+			n.invalidBlocks[b.Hash] = true
+			for j := i - 1; j >= 0; j-- {
+				n.Ledger.DisconnectBlock(newBranch[j])
+			}
+			for _, old := range oldBranch {
+				if reconnectErr := n.Ledger.ConnectBlock(old); reconnectErr != nil {
+					panic(fmt.Sprintf("node %d: reconnecting block %s: %v", n.ID, old.Hash[:6], reconnectErr))
+				}
+			}
+			return nil, fmt.Errorf("block %s: %w", b.Hash[:6], err)
+		}
+		for _, txID := range n.Ledger.MempoolConflicts(b) {
+			n.removeFromMempool(txID)
+			n.keepExtraTx(txID)
+			n.Stats.ConflictingTxDropped++
+		}
+	}
+	return newBranch, nil
+}
+
+// branchFrom returns the blocks after ancestor up to and including tip,
+// oldest first.
+func (n *Node) branchFrom(ancestor, tip string) []Block {
+	branch := []Block{}
+	for current := tip; current != ancestor; {
+		b, ok := n.Blocks[current]
+		if !ok {
+			break
+		}
+		branch = append(branch, *b)
+		current = b.Header.PrevHash
+	}
+	for i, j := 0, len(branch)-1; i < j; i, j = i+1, j-1 {
+		branch[i], branch[j] = branch[j], branch[i]
+	}
+	return branch
+}
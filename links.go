@@ -0,0 +1,200 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// maxRequestRetries is how many times a timed-out block request is sent
+// again before the node forgets it and waits for another announcement.
+const maxRequestRetries = 5
+
+// LinkStats counts what unreliable links did to messages and how often
+// requests had to be repeated.
+type LinkStats struct {
+	Lost       int
+	Duplicated int
+	Timeouts   int
+	Retries    int
+	GaveUp     int
+}
+
+// deliver schedules a message to targetID that has left the sender after
+// delay. The link may lose it, add reordering jitter, or deliver it twice; its
+// loss and duplication probabilities are the higher of its two ends'.
+func (n *Node) deliver(targetID int, delay time.Duration, et EventType, data interface{}) {
+	s := n.Sim
+	rng := s.Rand.Links
+	target := s.Nodes[targetID]
+	if loss := max(n.PacketLoss, target.PacketLoss); loss > 0 && rng.Float64() < loss {
+		s.Links.Lost++
+		return
+	}
+	s.ScheduleEvent(s.CurrentTime.Add(delay+s.reorderDelay()), et, data)
+	if dup := max(n.PacketDuplication, target.PacketDuplication); dup > 0 && rng.Float64() < dup {
+		s.Links.Duplicated++
+		s.ScheduleEvent(s.CurrentTime.Add(delay+s.reorderDelay()), et, data)
+	}
+}
+
+// reorderDelay draws the extra delay that lets later messages on a link
+// overtake earlier ones.
+func (s *Simulation) reorderDelay() time.Duration {
+	if s.Cfg.ReorderJitter <= 0 {
+		return 0
+	}
+	return time.Duration(s.Rand.Links.Float64() * float64(s.Cfg.ReorderJitter))
+}
+
+// pendingRequest is an armed request timeout and the number of its objects
+// that have not arrived yet. The timeout is cancelled once they all have.
+type pendingRequest struct {
+	event       *Event
+	outstanding int
+}
+
+// armRequestTimeout schedules a check that the request to peerID was
+// answered. Timeouts for getheaders are tracked by the sync record; for other
+// requests, a new request for an object supersedes the old one.
+func (n *Node) armRequestTimeout(peerID int, kind string, hashes []string, attempt int) *Event {
+	if n.Cfg.RequestTimeout <= 0 {
+		return nil
+	}
+	event := &Event{
+		Timestamp: n.Sim.CurrentTime.Add(n.Cfg.RequestTimeout), Type: EvRequestTimeout,
+		Data:     RequestTimeoutData{NodeID: n.ID, PeerID: peerID, Kind: kind, Hashes: hashes, Attempt: attempt},
+		Priority: int(EvRequestTimeout),
+	}
+	n.Sim.PushEvent(event)
+	if kind == MsgGetHeaders {
+		return event
+	}
+	req := &pendingRequest{event: event}
+	for _, hash := range hashes {
+		n.answered(hash)
+		n.pendingRequests[hash] = req
+		req.outstanding++
+	}
+	return event
+}
+
+// answered notes that hash arrived, cancelling its request's timeout when
+// nothing else from that request is outstanding.
+func (n *Node) answered(hash string) {
+	req, ok := n.pendingRequests[hash]
+	if !ok {
+		return
+	}
+	delete(n.pendingRequests, hash)
+	req.outstanding--
+	if req.outstanding == 0 {
+		n.Sim.CancelEvent(req.event)
+	}
+}
+
+// cancelRequestTimeouts drops every pending request timeout.
+func (n *Node) cancelRequestTimeouts() {
+	for hash, req := range n.pendingRequests {
+		n.Sim.CancelEvent(req.event)
+		delete(n.pendingRequests, hash)
+	}
+	if n.syncing != nil {
+		n.Sim.CancelEvent(n.syncing.timeout)
+		n.syncing.timeout = nil
+	}
+}
+
+// handleRequestTimeout deals with a request that went unanswered. Missing
+// blocks are requested again from another peer, transactions are left for the
+// next announcement to fetch, and a stalled header download moves to another
+// sync peer.
+func (n *Node) handleRequestTimeout(data RequestTimeoutData, event *Event) {
+	if data.Kind == MsgGetHeaders {
+		if sync := n.syncing; sync != nil && sync.timeout == event {
+			sync.timeout = nil
+			n.Sim.Links.Timeouts++
+			n.requestHeaders()
+		}
+		return
+	}
+	for _, hash := range data.Hashes {
+		if req, ok := n.pendingRequests[hash]; ok && req.event == event {
+			delete(n.pendingRequests, hash)
+		}
+	}
+	switch data.Kind {
+	case MsgTx:
+		for _, hash := range data.Hashes {
+			if !n.knowsTx(hash) {
+				delete(n.requested, hash)
+			}
+		}
+	case MsgBlock:
+		missing := []string{}
+		for _, hash := range data.Hashes {
+			if _, known := n.Blocks[hash]; !known && n.requested[hash] {
+				missing = append(missing, hash)
+			}
+		}
+		n.retryBlocks(data, missing)
+	case MsgGetBlockTxn:
+		hash := data.Hashes[0]
+		if _, waiting := n.reconstructing[hash]; !waiting {
+			return
+		}
+		delete(n.reconstructing, hash)
+		n.requested[hash] = true
+		n.retryBlocks(data, data.Hashes)
+	}
+}
+
+func (n *Node) retryBlocks(data RequestTimeoutData, missing []string) {
+	if len(missing) == 0 {
+		return
+	}
+	s := n.Sim
+	s.Links.Timeouts++
+	if data.Attempt >= maxRequestRetries {
+		s.Links.GaveUp++
+		for _, hash := range missing {
+			delete(n.requested, hash)
+		}
+		log.Printf("T=%.3fs Node %d: Gave up on %d block(s) after %d retries\n",
+			s.CurrentTime.Sub(s.StartTime).Seconds(), n.ID, len(missing), maxRequestRetries)
+		return
+	}
+	s.Links.Retries++
+	n.sendGetData(n.retryPeer(data.PeerID), MsgBlock, missing, data.Attempt+1)
+}
+
+// peerLost asks another peer for the blocks being reconstructed from peerID,
+// which went offline before sending the blocktxn reply.
+func (n *Node) peerLost(peerID int) {
+	hashes := []string{}
+	for hash, from := range n.reconstructing {
+		if from == peerID {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		n.requested[hash] = true
+	}
+	n.requestData(n.retryPeer(peerID), MsgBlock, hashes)
+}
+
+// retryPeer picks a random online relay target other than the peer that
+// stalled, or the same peer if there is no other.
+func (n *Node) retryPeer(stalled int) int {
+	candidates := []int{}
+	for _, id := range n.relayTargets(stalled) {
+		if id != stalled && !n.Sim.Nodes[id].Offline {
+			candidates = append(candidates, id)
+		}
+	}
+	if len(candidates) == 0 {
+		return stalled
+	}
+	return candidates[n.Sim.Rand.Links.Intn(len(candidates))]
+}
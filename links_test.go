@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestNodeOverridesSetLinkReliability checks that a link loses or duplicates
+// messages with the higher probability of its two ends, as set by node
+// overrides.
+func TestNodeOverridesSetLinkReliability(t *testing.T) {
+	always := 1.0
+	cfg := testConfig(4, 1)
+	cfg.NodeOverrides = []NodeOverride{
+		{NodeID: 1, PacketLoss: &always},
+		{NodeID: 2, PacketDuplication: &always},
+	}
+	sim := newTestSimulation(t, cfg)
+	tests := []struct {
+		from, to  int
+		wantCount int
+	}{
+		{0, 1, 0},
+		{1, 3, 0},
+		{1, 2, 0},
+		{0, 2, 2},
+		{2, 3, 2},
+		{0, 3, 1},
+	}
+	for _, tt := range tests {
+		before := len(queued(sim, EvInv))
+		sim.Nodes[tt.from].deliver(tt.to, time.Second, EvInv, InvData{TargetNodeID: tt.to, FromNodeID: tt.from, Kind: MsgTx})
+		if got := len(queued(sim, EvInv)) - before; got != tt.wantCount {
+			t.Errorf("%d->%d: %d copies delivered, want %d", tt.from, tt.to, got, tt.wantCount)
+		}
+	}
+	if sim.Links.Lost != 3 || sim.Links.Duplicated != 2 {
+		t.Errorf("%d lost, %d duplicated; want 3, 2", sim.Links.Lost, sim.Links.Duplicated)
+	}
+}
+
+// TestBlockRequestRetriesThenGivesUp fires every timeout of a block request
+// that is never answered: it is sent again to another peer up to
+// maxRequestRetries times, then forgotten.
+func TestBlockRequestRetriesThenGivesUp(t *testing.T) {
+	cfg := testConfig(3, 1)
+	cfg.RelayProtocol = RelayInv
+	cfg.RequestTimeout = 5 * time.Second
+	sim := newTestSimulation(t, cfg)
+	n := sim.Nodes[0]
+	n.ReceiveHeaders(HeadersData{TargetNodeID: 0, FromNodeID: 1, Hashes: []string{"block"}})
+
+	for attempt := 0; attempt <= maxRequestRetries; attempt++ {
+		timeouts := queued(sim, EvRequestTimeout)
+		if len(timeouts) != 1 {
+			t.Fatalf("attempt %d: %d request timeouts queued, want 1", attempt, len(timeouts))
+		}
+		timeout := timeouts[0]
+		data := timeout.Data.(RequestTimeoutData)
+		if data.Attempt != attempt {
+			t.Fatalf("timeout for attempt %d, want %d", data.Attempt, attempt)
+		}
+		sim.CancelEvent(timeout)
+		n.handleRequestTimeout(data, timeout)
+		if attempt < maxRequestRetries {
+			getData := queued(sim, EvGetData)
+			if peer := getData[len(getData)-1].Data.(InvData).TargetNodeID; peer == data.PeerID {
+				t.Errorf("attempt %d: retried the peer %d that stalled", attempt+1, peer)
+			}
+		}
+	}
+	links := sim.Links
+	if links.Timeouts != maxRequestRetries+1 || links.Retries != maxRequestRetries || links.GaveUp != 1 {
+		t.Errorf("%d timeouts, %d retries, %d given up; want %d, %d, 1",
+			links.Timeouts, links.Retries, links.GaveUp, maxRequestRetries+1, maxRequestRetries)
+	}
+	if n.requested["block"] || len(queued(sim, EvRequestTimeout)) != 0 {
+		t.Error("the node still waits for the block after giving up")
+	}
+}
@@ -4,74 +4,94 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
 	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "bench":
+			runBench(os.Args[2:])
+			return
+		case "sweep":
+			runSweepCommand(os.Args[2:])
+			return
+		}
+	}
 	log.Printf("--- Starting Simulation Setup ---")
 
 	log.Println("Parsing configuration flags...")
 	cfg := DefaultConfig()
-	flag.IntVar(&cfg.NumNodes, "nodes", cfg.NumNodes, "Total number of nodes")
-	flag.IntVar(&cfg.NumMiners, "miners", cfg.NumMiners, "Number of mining nodes")
-	flag.IntVar(&cfg.BlockSizeLimitBytes, "block_size_bytes", cfg.BlockSizeLimitBytes, "Max block size in bytes")
-	flag.Float64Var(&cfg.TransactionRatePerSec, "tx_rate", cfg.TransactionRatePerSec, "Transaction injection rate per second")
-	flag.IntVar(&cfg.MinTransactionSizeBytes, "tx_size_min", cfg.MinTransactionSizeBytes, "CLAMP: Minimum transaction size in bytes")
-	flag.IntVar(&cfg.MaxTransactionSizeBytes, "tx_size_max", cfg.MaxTransactionSizeBytes, "CLAMP: Maximum transaction size in bytes")
-	flag.Float64Var(&cfg.MeanTransactionSizeBytes, "tx_size_mean", cfg.MeanTransactionSizeBytes, "Mean transaction size in bytes (Normal Dist)")
-	flag.Float64Var(&cfg.StdDevTransactionSizeBytes, "tx_size_stddev", cfg.StdDevTransactionSizeBytes, "Standard Deviation for transaction size (Normal Dist)")
-	flag.DurationVar(&cfg.NetworkDelayMin, "delay_min", cfg.NetworkDelayMin, "Minimum network delay")
-	flag.DurationVar(&cfg.NetworkDelayMax, "delay_max", cfg.NetworkDelayMax, "Maximum network delay")
-	flag.IntVar(&cfg.TotalInputTransactions, "total_txs", cfg.TotalInputTransactions, "Target total input transactions to inject")
-	flag.DurationVar(&cfg.SimulationDuration, "duration", cfg.SimulationDuration, "Maximum simulation duration")
-	flag.DurationVar(&cfg.FindTimeMin, "find_time_min", cfg.FindTimeMin, "Minimum time to find a block")
-	flag.DurationVar(&cfg.FindTimeMax, "find_time_max", cfg.FindTimeMax, "Maximum time to find a block")
-
+	out := DefaultOutputOptions()
+	registerConfigFlags(flag.CommandLine, &cfg)
+	registerOutputFlags(flag.CommandLine, &out)
+	scenarioPath := flag.String("scenario", "", "YAML or JSON scenario file with settings, per-node overrides and timed events (flags given here take precedence)")
 	flag.Parse()
 	log.Println("Flag parsing complete.")
 
-	if cfg.NumMiners > cfg.NumNodes {
-		log.Fatalf("Error: Number of miners (%d) cannot exceed number of nodes (%d)", cfg.NumMiners, cfg.NumNodes)
+	var scenario *Scenario
+	if *scenarioPath != "" {
+		var err error
+		scenario, err = LoadScenario(*scenarioPath)
+		if err == nil {
+			err = scenario.Apply(flag.CommandLine, &cfg)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		log.Printf("Loaded scenario %s.\n", *scenarioPath)
 	}
-	if cfg.NetworkDelayMin > cfg.NetworkDelayMax {
-		log.Fatalf("Error: Minimum network delay (%v) cannot exceed maximum network delay (%v)", cfg.NetworkDelayMin, cfg.NetworkDelayMax)
+	if err := validateConfig(&cfg); err != nil {
+		log.Fatalf("Error: %v", scenario.locate(err))
 	}
 	if cfg.NumMiners <= 0 && cfg.NumNodes > 0 {
 		log.Println("Warning: No miners specified. Blockchain will likely not progress.")
 	}
-	if cfg.SimulationDuration <= 0 {
-		log.Fatalf("Error: Simulation duration (%v) must be positive.", cfg.SimulationDuration)
-	}
-	if cfg.BlockSizeLimitBytes <= 0 {
-		log.Fatalf("Error: Block size limit (%d) must be positive.", cfg.BlockSizeLimitBytes)
-	}
-	if cfg.MinTransactionSizeBytes <= 0 {
-		log.Fatalf("Error: Min transaction size must be positive.")
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
 	}
-	if cfg.MaxTransactionSizeBytes < cfg.MinTransactionSizeBytes {
-		log.Fatalf("Error: Max transaction size cannot be less than min transaction size.")
-	}
-	cfg.TargetBlockInterval = (cfg.FindTimeMin + cfg.FindTimeMax) / 2.0
 
-	log.SetOutput(os.Stdout)
+	logOutput := io.Writer(os.Stdout)
+	if out.LogFile != "" {
+		f, err := os.Create(out.LogFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer f.Close()
+		logOutput = f
+	}
+	log.SetOutput(logOutput)
 	log.SetFlags(log.Ltime | log.Lmicroseconds)
 
 	log.Println("--- Blockchain Simulator ---")
 	log.Printf("Config: %+v\n", cfg)
 
+	if cfg.AttackTrials > 0 {
+		if out.ResultsJSON != "" {
+			log.Println("Warning: -results_json is ignored for double-spend trials.")
+		}
+		runDoubleSpendTrials(cfg)
+		return
+	}
+
 	sim := NewSimulation(cfg)
-	sim.Run()
+	if err := sim.Run(); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 
 	log.Println("--- Simulation Results ---")
 	actualDuration := sim.CurrentTime.Sub(sim.StartTime)
+	log.Printf("Random Seed: %d (rerun with -seed=%d to reproduce)\n", cfg.Seed, cfg.Seed)
 	log.Printf("Simulation Stopped At: %.3f seconds (Target Duration: %v)\n", actualDuration.Seconds(), cfg.SimulationDuration)
 	log.Printf("Global Stale Blocks Count: %d\n", sim.GlobalStaleCount)
 	log.Printf("Total Transactions Injected: %d / %d (target)\n", sim.TxSource.GeneratedCount, cfg.TotalInputTransactions)
 
-	log.Printf("--- Final Chain Analysis (based on Node 0 at T=%.3fs) ---", actualDuration.Seconds())
-	mainChainBlocks, err := getMainChainBlocks(sim, 0)
+	log.Printf("--- Final Chain Analysis (based on Node %d at T=%.3fs) ---", sim.ReferenceNodeID, actualDuration.Seconds())
+	mainChainBlocks, err := getMainChainBlocks(sim, sim.ReferenceNodeID)
 	if err != nil {
 		log.Printf("Could not analyze main chain details: %v\n", err)
 	} else {
@@ -85,13 +105,128 @@ func main() {
 
 		avgBlockTPS := calculateBlockBasedThroughput(mainChainBlocks, &cfg)
 		log.Printf("Average Block Throughput: %.2f TPS (Avg(Block Txs / Target Interval))\n", avgBlockTPS)
+
+		reportDifficultyWindows(mainChainBlocks, sim.StartTime, time.Hour, &cfg)
 	}
 
+	reportBlockPropagation(sim)
+	reportRelayMessages(sim)
+	reportCompactBlocks(sim)
+	reportLinks(sim, mainChainBlocks)
+	reportMinerShares(sim)
+	reportRegions(sim, mainChainBlocks)
+	reportSelfishMining(sim)
+	reportTransactionLatencies(sim)
+	reportFeeMarket(sim, mainChainBlocks)
+	reportMempoolTotals(sim)
+	reportDoubleSpends(sim, mainChainBlocks)
+	reportPartitions(sim)
+	reportChurn(sim)
 	checkChainConsensus(sim)
-	printFinalBlockchain(sim, 0)
+	if out.PrintChain {
+		printFinalBlockchain(sim, sim.ReferenceNodeID)
+	}
+	if out.ResultsJSON != "" {
+		if err := writeResultsJSON(out.ResultsJSON, sim); err != nil {
+			log.Fatalf("Error: writing results: %v", err)
+		}
+		log.Printf("Results written to %s\n", out.ResultsJSON)
+	}
+	log.Println("--- Simulation Complete ---")
+}
+
+func runDoubleSpendTrials(cfg Config) {
+	log.Printf("Running %d double-spend trials (attacker hash share %.2f%%, merchant waits for %d confirmations)...\n",
+		cfg.AttackTrials, cfg.AttackerHashShare*100, cfg.ConfirmDepth)
+	summary, err := RunDoubleSpendTrials(cfg)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	rate, margin := summary.SuccessRate()
+
+	log.Println("--- Double-Spend Attack Results ---")
+	log.Printf("Random Seed: %d (rerun with -seed=%d to reproduce)\n", cfg.Seed, cfg.Seed)
+	log.Printf("Trials: %d | Succeeded: %d | Gave Up: %d | Unresolved: %d | Mean Time to Resolve: %v\n",
+		summary.Trials, summary.Succeeded, summary.Failed, summary.Unresolved, summary.MeanDuration.Round(time.Second))
+	log.Printf("Empirical Success Probability: %.4f ± %.4f (95%% CI)\n", rate, margin)
+	log.Printf("Nakamoto Estimate: %.4f | Rosenfeld Exact: %.4f\n",
+		NakamotoSuccessProbability(summary.HashShare, summary.ConfirmDepth), RosenfeldSuccessProbability(summary.HashShare, summary.ConfirmDepth))
 	log.Println("--- Simulation Complete ---")
 }
 
+func reportPartitions(sim *Simulation) {
+	if len(sim.Partitions) == 0 {
+		return
+	}
+	log.Printf("--- Network Partitions (Mode: %s) ---", sim.Cfg.PartitionMode)
+	for i, p := range sim.Partitions {
+		end := "never healed"
+		if !p.End.IsZero() {
+			end = fmt.Sprintf("healed at T=%.0fs after %v", p.End.Sub(sim.StartTime).Seconds(), p.End.Sub(p.Start))
+		}
+		log.Printf("Partition %d: T=%.0fs, %s | Messages Dropped: %d, Held: %d\n",
+			i+1, p.Start.Sub(sim.StartTime).Seconds(), end, p.Dropped, p.Held)
+		for g, group := range p.Groups {
+			if g < len(p.EndHeights) {
+				log.Printf("  Group %d (%d nodes): Height %d -> %d (+%d blocks)\n",
+					g+1, len(group), p.StartHeights[g], p.EndHeights[g], p.EndHeights[g]-p.StartHeights[g])
+			} else {
+				log.Printf("  Group %d (%d nodes): Height %d at split\n", g+1, len(group), p.StartHeights[g])
+			}
+		}
+		if !p.End.IsZero() {
+			log.Printf("  After Heal: %d node reorgs | Deepest Reorg: %d blocks | Txs Returned To Mempools: %d\n",
+				p.ReorgedNodes, p.MaxReorgDepth, p.RevertedTxs)
+		}
+	}
+}
+
+func reportChurn(sim *Simulation) {
+	if len(sim.Syncs) == 0 && sim.Crashes == 0 {
+		return
+	}
+	log.Printf("--- Node Churn and Initial Block Download ---")
+	log.Printf("Crashes: %d | Restarts: %d | Late Joiners: %d (Downtime Mean: %v)\n",
+		sim.Crashes, sim.Restarts, len(sim.lateJoiners), sim.Cfg.ChurnDowntime)
+	var restartTime time.Duration
+	restartBlocks, restarts := 0, 0
+	var syncTime time.Duration
+	var syncBytes int64
+	syncBlocks := 0
+	for _, sync := range sim.Syncs {
+		if !sync.End.IsZero() {
+			syncTime += sync.End.Sub(sync.Start)
+			syncBlocks += sync.Blocks
+			syncBytes += sync.Bytes
+		}
+		if !sync.Join {
+			if !sync.End.IsZero() {
+				restartTime += sync.End.Sub(sync.Start)
+				restartBlocks += sync.Blocks
+				restarts++
+			}
+			continue
+		}
+		status := fmt.Sprintf("synced %d blocks (%.2f MiB) to height %d in %v",
+			sync.Blocks, float64(sync.Bytes)/(1024*1024), sync.EndHeight, sync.End.Sub(sync.Start).Round(time.Millisecond))
+		if sync.Interrupted {
+			status = fmt.Sprintf("crashed after %d blocks", sync.Blocks)
+		} else if sync.End.IsZero() {
+			status = fmt.Sprintf("still syncing at the end (%d blocks, height %d)", sync.Blocks, sim.Nodes[sync.NodeID].TipHeight())
+		}
+		log.Printf("  Node %d joined at T=%.0fs: %s\n", sync.NodeID, sync.Start.Sub(sim.StartTime).Seconds(), status)
+	}
+	if restarts > 0 {
+		log.Printf("Restart Syncs: %d completed | Mean Time: %v | Mean Blocks Fetched: %.1f\n",
+			restarts, (restartTime / time.Duration(restarts)).Round(time.Millisecond), float64(restartBlocks)/float64(restarts))
+	}
+	if syncBlocks > 0 && syncTime > 0 {
+		log.Printf("Download Rate (completed syncs): %.2f blocks/s, %.2f MiB/s, %v per block\n",
+			float64(syncBlocks)/syncTime.Seconds(), float64(syncBytes)/(1024*1024)/syncTime.Seconds(),
+			(syncTime / time.Duration(syncBlocks)).Round(time.Millisecond))
+	}
+}
+
 func checkChainConsensus(sim *Simulation) {
 	if len(sim.Nodes) == 0 {
 		return
@@ -102,12 +237,7 @@ func checkChainConsensus(sim *Simulation) {
 	consensusHeight := -1
 	for _, node := range sim.Nodes {
 		tipHash := node.BestChainTip
-		tipHeight := -1
-		if workHeight, ok := node.ChainWork[tipHash]; ok {
-			tipHeight = workHeight
-		} else if tipHash == sim.GenesisBlock.Hash {
-			tipHeight = 0
-		}
+		tipHeight := node.TipHeight()
 		tipCounts[tipHash]++
 		if tipHeight > maxHeight {
 			maxHeight = tipHeight
@@ -115,15 +245,20 @@ func checkChainConsensus(sim *Simulation) {
 	}
 	log.Printf("--- Chain Consensus Check (Final State) ---")
 	log.Printf("Max Height Reached (any node): %d", maxHeight)
+	offline := 0
+	for _, node := range sim.Nodes {
+		if node.Offline {
+			offline++
+		}
+	}
+	if offline > 0 {
+		log.Printf("Offline Nodes: %d (their tips are from when they went down, or genesis for late joiners)", offline)
+	}
 	if len(tipCounts) == 1 {
 		for tip := range tipCounts {
 			consensusTip = tip
 		}
-		if workHeight, ok := sim.Nodes[0].ChainWork[consensusTip]; ok {
-			consensusHeight = workHeight
-		} else if consensusTip == sim.GenesisBlock.Hash {
-			consensusHeight = 0
-		}
+		consensusHeight = sim.Nodes[0].TipHeight()
 		log.Printf("All %d nodes agree on final tip: %s (Height: %d)", len(sim.Nodes), consensusTip[:6], consensusHeight)
 	} else {
 		log.Printf("Nodes disagree on final tip:")
@@ -131,11 +266,7 @@ func checkChainConsensus(sim *Simulation) {
 			height := -1
 			for _, node := range sim.Nodes {
 				if node.BestChainTip == tip {
-					if workHeight, ok := node.ChainWork[tip]; ok {
-						height = workHeight
-					} else if tip == sim.GenesisBlock.Hash {
-						height = 0
-					}
+					height = node.TipHeight()
 					break
 				}
 			}
@@ -162,18 +293,13 @@ func getMainChainBlocks(sim *Simulation, referenceNodeID int) ([]Block, error) {
 	mainChain := []Block{}
 	currentHash := finalTipHash
 	blocksToFetch := 0
-	expectedHeight := -1
-	if h, ok := node.ChainWork[finalTipHash]; ok {
-		expectedHeight = h
-	} else if finalTipHash == sim.GenesisBlock.Hash {
-		expectedHeight = 0
-	}
+	expectedHeight, _ := node.heightOf(finalTipHash)
 	for currentHash != "" {
 		block, exists := node.Blocks[currentHash]
 		if !exists {
 			return nil, fmt.Errorf("block %s missing in Node %d's view during chain traversal", currentHash[:6], referenceNodeID)
 		}
-		mainChain = append(mainChain, block)
+		mainChain = append(mainChain, *block)
 		if currentHash == sim.GenesisBlock.Hash {
 			break
 		}
@@ -222,6 +348,37 @@ func calculateAverageBlockInterval(mainChain []Block) (time.Duration, error) {
 	return averageInterval, nil
 }
 
+// reportDifficultyWindows groups main chain blocks into fixed windows of
+// simulated time, showing how block intervals recover after hash rate changes.
+func reportDifficultyWindows(mainChain []Block, startTime time.Time, window time.Duration, cfg *Config) {
+	if len(mainChain) < 2 {
+		return
+	}
+	log.Printf("--- Difficulty by %v Window (Algorithm: %s) ---", window, cfg.DifficultyAlgorithm)
+	windowStart := 0
+	for i := 1; i <= len(mainChain); i++ {
+		if i < len(mainChain) && windowIndex(mainChain[i], startTime, window) == windowIndex(mainChain[windowStart+1], startTime, window) {
+			continue
+		}
+		blocks := mainChain[windowStart+1 : i]
+		if len(blocks) > 0 {
+			difficultySum := 0.0
+			for _, block := range blocks {
+				difficultySum += block.Header.Difficulty
+			}
+			span := blocks[len(blocks)-1].FoundTime.Sub(mainChain[windowStart].FoundTime)
+			log.Printf("  Window %d: Blocks %d | Avg Interval %v | Avg Difficulty %.4f\n",
+				windowIndex(blocks[0], startTime, window), len(blocks),
+				(span / time.Duration(len(blocks))).Round(time.Second), difficultySum/float64(len(blocks)))
+		}
+		windowStart = i - 1
+	}
+}
+
+func windowIndex(block Block, startTime time.Time, window time.Duration) int {
+	return int(block.FoundTime.Sub(startTime) / window)
+}
+
 func calculateBlockBasedThroughput(mainChain []Block, cfg *Config) float64 {
 	if len(mainChain) <= 1 {
 		return 0.0
@@ -247,6 +404,378 @@ func calculateBlockBasedThroughput(mainChain []Block, cfg *Config) float64 {
 	return averageRate
 }
 
+func reportBlockPropagation(sim *Simulation) {
+	var bytesSent int64
+	for _, node := range sim.Nodes {
+		bytesSent += node.Stats.BytesSent
+	}
+	log.Printf("--- Block Propagation (Upload: %s, Download: %s) ---", formatMbps(sim.Cfg.UploadMbps), formatMbps(sim.Cfg.DownloadMbps))
+	for _, p := range []struct {
+		label   string
+		samples []time.Duration
+	}{
+		{"Time to Reach 50% of Nodes", sim.BlockPropagation50},
+		{"Time to Reach 90% of Nodes", sim.BlockPropagation90},
+	} {
+		summary := summarizeDurations(p.samples)
+		if summary.Count == 0 {
+			log.Printf("%s: no samples\n", p.label)
+			continue
+		}
+		log.Printf("%s (%d blocks): Mean=%v Median=%v P90=%v P99=%v\n",
+			p.label, summary.Count, summary.Mean, summary.Median, summary.P90, summary.P99)
+	}
+	log.Printf("Total Bytes Sent: %.2f MiB\n", float64(bytesSent)/(1024*1024))
+}
+
+// reportRelayMessages breaks the traffic down by message type. Getdata
+// requests are the extra round trips of the inv protocol; redundant bytes are
+// payloads delivered to nodes that already had them.
+func reportRelayMessages(sim *Simulation) {
+	log.Printf("--- Relay Messages (Protocol: %s, Mode: %s) ---", sim.Cfg.RelayProtocol, sim.Cfg.RelayMode)
+	var total, payload int64
+	for _, kind := range messageKinds {
+		stats, ok := sim.Messages[kind]
+		if !ok {
+			continue
+		}
+		log.Printf("  %s: %d messages, %.2f MiB\n", kind, stats.Count, float64(stats.Bytes)/(1024*1024))
+		total += stats.Bytes
+		switch kind {
+		case MsgTx, MsgBlock, MsgCmpctBlock, MsgBlockTxn:
+			payload += stats.Bytes
+		}
+	}
+	if total == 0 {
+		return
+	}
+	roundTrips := 0
+	if getData, ok := sim.Messages[MsgGetData]; ok {
+		roundTrips = getData.Count
+	}
+	log.Printf("Round Trips (getdata): %d | Announcement Overhead: %.2f MiB (%.2f%% of traffic)\n",
+		roundTrips, float64(total-payload)/(1024*1024), float64(total-payload)/float64(total)*100)
+	log.Printf("Redundant Payload Bytes: %.2f MiB (%.2f%% of traffic)\n",
+		float64(sim.RedundantBytes)/(1024*1024), float64(sim.RedundantBytes)/float64(total)*100)
+}
+
+func reportLinks(sim *Simulation, mainChain []Block) {
+	cfg := sim.Cfg
+	lossyOverrides := hasLossyLinks(cfg.NodeOverrides)
+	if cfg.PacketLoss == 0 && cfg.PacketDuplication == 0 && cfg.ReorderJitter == 0 && cfg.RequestTimeout == 0 && !lossyOverrides {
+		return
+	}
+	log.Printf("--- Unreliable Links (Loss: %.2f%%, Duplication: %.2f%%, Reorder Jitter: %v, Request Timeout: %v) ---",
+		cfg.PacketLoss*100, cfg.PacketDuplication*100, cfg.ReorderJitter, cfg.RequestTimeout)
+	if lossyOverrides {
+		log.Printf("Node overrides change the loss or duplication of some links.\n")
+	}
+	links := sim.Links
+	log.Printf("Messages Lost: %d | Duplicated: %d\n", links.Lost, links.Duplicated)
+	log.Printf("Request Timeouts: %d | Retries: %d | Given Up: %d\n", links.Timeouts, links.Retries, links.GaveUp)
+	orphans := 0
+	for id := 0; id < len(sim.Nodes); id++ {
+		orphans += sim.Nodes[id].Stats.ReceivedOrphans
+	}
+	log.Printf("Orphan Blocks Received (all nodes): %d\n", orphans)
+	if len(mainChain) > 1 {
+		// Blocks the reference node knows that did not make the main chain.
+		stale := len(sim.Nodes[sim.ReferenceNodeID].Blocks) - len(mainChain)
+		log.Printf("Stale Blocks (Node %d view): %d | Stale Rate: %.2f%%\n",
+			sim.ReferenceNodeID, stale, 100*float64(stale)/float64(stale+len(mainChain)-1))
+	}
+}
+
+func reportCompactBlocks(sim *Simulation) {
+	if !sim.Cfg.CompactBlocks {
+		return
+	}
+	stats := sim.CompactBlocks
+	log.Println("--- Compact Block Relay ---")
+	if stats.Received == 0 {
+		log.Println("No compact blocks received.")
+		return
+	}
+	log.Printf("Compact Blocks Received: %d | Reconstructed From Mempool: %d (%.2f%%) | Needed getblocktxn: %d\n",
+		stats.Received, stats.Reconstructed, float64(stats.Reconstructed)/float64(stats.Received)*100, stats.RoundTrips)
+	meanMissing := 0.0
+	if stats.RoundTrips > 0 {
+		meanMissing = float64(stats.MissingTxs) / float64(stats.RoundTrips)
+	}
+	log.Printf("Missing Transactions Requested: %d (%.1f per round trip)\n", stats.MissingTxs, meanMissing)
+	log.Printf("Bytes Saved vs Full Relay: %.2f MiB (%.1f KiB per block)\n",
+		float64(stats.BytesSaved)/(1024*1024), float64(stats.BytesSaved)/1024/float64(stats.Received))
+}
+
+func formatMbps(mbps float64) string {
+	if mbps == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g Mbit/s", mbps)
+}
+
+func reportMinerShares(sim *Simulation) {
+	if len(sim.MinerIDs) == 0 {
+		return
+	}
+	mainChainBlocks, err := getMainChainBlocks(sim, sim.ReferenceNodeID)
+	if err != nil {
+		log.Printf("Could not compute miner shares: %v\n", err)
+		return
+	}
+	minedCount := make(map[int]int)
+	total := 0
+	for _, block := range mainChainBlocks {
+		if block.Header.Height == 0 {
+			continue
+		}
+		minedCount[block.Header.MinerID]++
+		total++
+	}
+	log.Printf("--- Miner Hash Power vs Main Chain Blocks (Model: %s) ---", sim.Cfg.MiningModel)
+	for _, minerID := range sim.MinerIDs {
+		blockShare := 0.0
+		if total > 0 {
+			blockShare = float64(minedCount[minerID]) / float64(total)
+		}
+		region := ""
+		if sim.Regions != nil {
+			region = " (" + sim.Regions.Names[sim.Nodes[minerID].Region] + ")"
+		}
+		log.Printf("  Miner %d%s: Hash Share %.2f%% | Blocks %d (%.2f%%)\n",
+			minerID, region, sim.HashPower[minerID]*100, minedCount[minerID], blockShare*100)
+	}
+}
+
+// reportRegions compares each region's hash share with the share of main
+// chain blocks its miners won, and counts the stale blocks they mined as seen
+// by the reference node.
+func reportRegions(sim *Simulation, mainChain []Block) {
+	if sim.Regions == nil {
+		return
+	}
+	onMainChain := make(map[string]bool, len(mainChain))
+	won := make([]int, len(sim.Regions.Names))
+	total := 0
+	for _, block := range mainChain {
+		onMainChain[block.Hash] = true
+		if block.Header.Height == 0 {
+			continue
+		}
+		if miner, ok := sim.Nodes[block.Header.MinerID]; ok {
+			won[miner.Region]++
+			total++
+		}
+	}
+	stale := make([]int, len(sim.Regions.Names))
+	for hash, block := range sim.Nodes[sim.ReferenceNodeID].Blocks {
+		if onMainChain[hash] {
+			continue
+		}
+		if miner, ok := sim.Nodes[block.Header.MinerID]; ok {
+			stale[miner.Region]++
+		}
+	}
+	nodes := make([]int, len(sim.Regions.Names))
+	miners := make([]int, len(sim.Regions.Names))
+	hashShare := make([]float64, len(sim.Regions.Names))
+	for _, node := range sim.Nodes {
+		nodes[node.Region]++
+		if node.IsMiner {
+			miners[node.Region]++
+			hashShare[node.Region] += sim.HashPower[node.ID]
+		}
+	}
+
+	log.Printf("--- Results by Region (Regions: %s, Jitter: %.0f%%) ---", sim.Cfg.Regions, sim.Cfg.LatencyJitter*100)
+	for region, name := range sim.Regions.Names {
+		blockShare := 0.0
+		if total > 0 {
+			blockShare = float64(won[region]) / float64(total)
+		}
+		log.Printf("  %s: Nodes %d | Miners %d | Hash Share %.2f%% | Main Chain Blocks %d (%.2f%%) | Stale Blocks %d\n",
+			name, nodes[region], miners[region], hashShare[region]*100, won[region], blockShare*100, stale[region])
+	}
+}
+
+func reportSelfishMining(sim *Simulation) {
+	selfish := 0
+	for _, minerID := range sim.MinerIDs {
+		if sim.IsSelfish(minerID) {
+			selfish++
+		}
+	}
+	if selfish == 0 {
+		return
+	}
+	mainChainBlocks, err := getMainChainBlocks(sim, sim.ReferenceNodeID)
+	if err != nil {
+		log.Printf("Could not compute selfish mining revenue: %v\n", err)
+		return
+	}
+	attackerBlocks := 0
+	total := 0
+	mainChainCount := make(map[int]int)
+	for _, block := range mainChainBlocks {
+		if block.Header.Height == 0 {
+			continue
+		}
+		total++
+		if sim.IsSelfish(block.Header.MinerID) {
+			attackerBlocks++
+			mainChainCount[block.Header.MinerID]++
+		}
+	}
+	log.Printf("--- Selfish Mining (gamma %.2f) ---", sim.Cfg.SelfishGamma)
+	hashShare := 0.0
+	for _, minerID := range sim.MinerIDs {
+		selfish, ok := sim.Nodes[minerID].Strategy.(*SelfishStrategy)
+		if !ok {
+			continue
+		}
+		hashShare += sim.HashPower[minerID]
+		log.Printf("  Selfish Node %d: Found %d | Published %d | In Main Chain %d | Still Withheld %d\n",
+			minerID, selfish.BlocksFound, selfish.BlocksPublished, mainChainCount[minerID], len(selfish.withheld))
+	}
+	revenue := 0.0
+	if total > 0 {
+		revenue = float64(attackerBlocks) / float64(total)
+	}
+	log.Printf("Attacker Hash Share: %.2f%% | Relative Revenue: %.2f%% (%d / %d main chain blocks) | Eyal-Sirer Prediction: %.2f%%\n",
+		hashShare*100, revenue*100, attackerBlocks, total, SelfishRevenueShare(hashShare, sim.Cfg.SelfishGamma)*100)
+}
+
+func reportTransactionLatencies(sim *Simulation) {
+	inclusion := []time.Duration{}
+	confirmation := []time.Duration{}
+	neverConfirmed := 0
+	for _, meta := range sim.TxStatus {
+		if !meta.FirstBlockTime.IsZero() {
+			inclusion = append(inclusion, meta.FirstBlockTime.Sub(meta.InjectTime))
+		}
+		if meta.IsConfirmed {
+			confirmation = append(confirmation, meta.ConfirmedTime.Sub(meta.InjectTime))
+		} else {
+			neverConfirmed++
+		}
+	}
+
+	log.Printf("--- Transaction Latency (Node %d View, Confirm Depth: %d) ---", sim.ReferenceNodeID, sim.Cfg.ConfirmDepth)
+	logLatencySummary("Inclusion Latency", summarizeDurations(inclusion))
+	logLatencySummary("Confirmation Latency", summarizeDurations(confirmation))
+	log.Printf("Never Confirmed Transactions: %d / %d\n", neverConfirmed, len(sim.TxStatus))
+	log.Printf("Confirmations Reverted By Reorgs: %d\n", sim.Confirmations.RevertedCount)
+}
+
+// reportFeeMarket splits transactions into fee rate quintiles and shows how
+// quickly each one made it into a block.
+func reportFeeMarket(sim *Simulation, mainChain []Block) {
+	if sim.Cfg.FeeRateDist == FeeDistNone || len(sim.TxStatus) == 0 {
+		return
+	}
+	metas := make([]*TxMetadata, 0, len(sim.TxStatus))
+	for _, meta := range sim.TxStatus {
+		metas = append(metas, meta)
+	}
+	sort.Slice(metas, func(i, j int) bool { return metas[i].FeeRate < metas[j].FeeRate })
+
+	var totalFees int64
+	for _, block := range mainChain {
+		totalFees += block.TotalFees()
+	}
+	log.Printf("--- Fee Market (Selection: %s) ---", sim.Cfg.TxSelection)
+	log.Printf("Total Fees in Main Chain: %d sat\n", totalFees)
+
+	const buckets = 5
+	for bucket := 0; bucket < buckets; bucket++ {
+		group := metas[bucket*len(metas)/buckets : (bucket+1)*len(metas)/buckets]
+		if len(group) == 0 {
+			continue
+		}
+		inclusion := []time.Duration{}
+		confirmed := 0
+		for _, meta := range group {
+			if !meta.FirstBlockTime.IsZero() {
+				inclusion = append(inclusion, meta.FirstBlockTime.Sub(meta.InjectTime))
+			}
+			if meta.IsConfirmed {
+				confirmed++
+			}
+		}
+		summary := summarizeDurations(inclusion)
+		log.Printf("  Fee Rate %.1f-%.1f sat/B: Txs %d | Included %.1f%% | Confirmed %.1f%% | Inclusion Median %v P90 %v\n",
+			group[0].FeeRate, group[len(group)-1].FeeRate, len(group),
+			100*float64(summary.Count)/float64(len(group)), 100*float64(confirmed)/float64(len(group)),
+			summary.Median.Round(time.Second), summary.P90.Round(time.Second))
+	}
+}
+
+func reportMempoolTotals(sim *Simulation) {
+	var totals NodeStats
+	maxMempoolBytes := 0
+	for _, node := range sim.Nodes {
+		totals.RejectedLowFeeTx += node.Stats.RejectedLowFeeTx
+		totals.EvictedTx += node.Stats.EvictedTx
+		totals.ExpiredTx += node.Stats.ExpiredTx
+		if node.mempoolBytes > maxMempoolBytes {
+			maxMempoolBytes = node.mempoolBytes
+		}
+	}
+	log.Printf("--- Mempool Totals (all nodes, Limit: %d bytes, Expiry: %v) ---", sim.Cfg.MempoolMaxBytes, sim.Cfg.MempoolExpiry)
+	log.Printf("Rejected Below Min Relay Fee: %d | Evicted: %d | Expired: %d | Largest Final Mempool: %d bytes\n",
+		totals.RejectedLowFeeTx, totals.EvictedTx, totals.ExpiredTx, maxMempoolBytes)
+}
+
+// reportDoubleSpends shows which side of each injected double spend ended up
+// in the main chain, and how many conflicting transactions nodes turned away.
+func reportDoubleSpends(sim *Simulation, mainChain []Block) {
+	if sim.Cfg.TxModel == TxModelSimple {
+		return
+	}
+	inMainChain := make(map[string]bool)
+	for _, block := range mainChain {
+		for _, tx := range block.Transactions {
+			inMainChain[tx.ID] = true
+		}
+	}
+	originalWon, conflictWon, neither := 0, 0, 0
+	for original, conflict := range sim.DoubleSpends {
+		switch {
+		case inMainChain[original]:
+			originalWon++
+		case inMainChain[conflict]:
+			conflictWon++
+		default:
+			neither++
+		}
+	}
+	var totals NodeStats
+	for _, node := range sim.Nodes {
+		totals.RejectedDoubleSpend += node.Stats.RejectedDoubleSpend
+		totals.RejectedInvalidTx += node.Stats.RejectedInvalidTx
+		totals.ConflictingTxDropped += node.Stats.ConflictingTxDropped
+		totals.InvalidBlocks += node.Stats.InvalidBlocks
+		totals.OrphanTxs += node.Stats.OrphanTxs
+		totals.OrphanTxsDropped += node.Stats.OrphanTxsDropped
+	}
+	log.Printf("--- Ledger (Model: %s) ---", sim.Cfg.TxModel)
+	log.Printf("Double Spends Injected: %d | Original Mined: %d | Conflict Mined: %d | Neither: %d\n",
+		len(sim.DoubleSpends), originalWon, conflictWon, neither)
+	log.Printf("Conflicting Txs Rejected: %d | Dropped From Mempools: %d | Invalid Blocks: %d (all nodes)\n",
+		totals.RejectedDoubleSpend, totals.ConflictingTxDropped, totals.InvalidBlocks)
+	log.Printf("Invalid Txs Rejected: %d | Orphan Txs: %d | Dropped With Orphan Pool Full: %d (all nodes)\n",
+		totals.RejectedInvalidTx, totals.OrphanTxs, totals.OrphanTxsDropped)
+}
+
+func logLatencySummary(label string, summary LatencySummary) {
+	if summary.Count == 0 {
+		log.Printf("%s: no samples\n", label)
+		return
+	}
+	log.Printf("%s (%d txs): Mean=%v Median=%v P90=%v P99=%v\n",
+		label, summary.Count, summary.Mean, summary.Median, summary.P90, summary.P99)
+}
+
 func printFinalBlockchain(sim *Simulation, referenceNodeID int) {
 	log.Println("--- Final Blockchain (Node", referenceNodeID, " View) ---")
 	mainChainBlocks, err := getMainChainBlocks(sim, referenceNodeID)
@@ -264,15 +793,10 @@ func printFinalBlockchain(sim *Simulation, referenceNodeID int) {
 			indent = "  ->"
 		}
 
-		var blockByteSize int = 0
-		for _, tx := range block.Transactions {
-			blockByteSize += tx.Size
-		}
-
-		fmt.Printf("%s Block Height: %d | Hash: %s | Miner: %d | Time: %s | Txs: %d | Size: %d\n",
+		fmt.Fprintf(log.Writer(), "%s Block Height: %d | Hash: %s | Miner: %d | Time: %s | Txs: %d | Size: %d\n",
 			indent, block.Header.Height, block.Hash[:10], block.Header.MinerID,
 			block.Header.Timestamp.Format(time.StampMilli),
-			block.Header.NumTx, blockByteSize,
+			block.Header.NumTx, block.Size(),
 		)
 	}
 	log.Println("--- End of Blockchain ---")
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"container/heap"
+	"math"
+	"time"
+)
+
+const mempoolExpiryCheckInterval = time.Minute
+
+// feeRateEntry is a mempool transaction in the eviction heap. Entries are
+// removed lazily: an entry whose transaction has left the mempool is skipped
+// when it reaches the top.
+type feeRateEntry struct {
+	txID    string
+	feeRate float64
+}
+
+type feeRateHeap []feeRateEntry
+
+func (h feeRateHeap) Len() int { return len(h) }
+
+func (h feeRateHeap) Less(i, j int) bool {
+	if h[i].feeRate != h[j].feeRate {
+		return h[i].feeRate < h[j].feeRate
+	}
+	return h[i].txID > h[j].txID
+}
+
+func (h feeRateHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *feeRateHeap) Push(x interface{}) { *h = append(*h, x.(feeRateEntry)) }
+
+func (h *feeRateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	*h = old[0 : n-1]
+	return entry
+}
+
+// minRelayFeeRate is the fee rate a new transaction needs to enter the
+// mempool. It stays at the configured base until the pool is half full, then
+// rises geometrically to MinRelayFeeMultiplier times the base when full.
+// Without fees every transaction pays nothing, so there is no minimum.
+func (n *Node) minRelayFeeRate() float64 {
+	base := n.Cfg.MinRelayFeeRate
+	if n.Cfg.FeeRateDist == FeeDistNone {
+		return 0
+	}
+	if n.Cfg.MempoolMaxBytes <= 0 {
+		return base
+	}
+	fill := float64(n.mempoolBytes) / float64(n.Cfg.MempoolMaxBytes)
+	if fill <= 0.5 {
+		return base
+	}
+	return base * math.Pow(n.Cfg.MinRelayFeeMultiplier, math.Min(1, 2*fill-1))
+}
+
+// addToMempool inserts tx, evicting the lowest fee rate transactions if the
+// pool would exceed its byte limit. Transactions returned to the pool by a
+// reorg skip the minimum relay fee check.
+func (n *Node) addToMempool(tx *Transaction, bypassMinFee bool) bool {
+	if _, exists := n.Mempool[tx.ID]; exists {
+		return true
+	}
+	n.expireMempool()
+	if !bypassMinFee && tx.FeeRate() < n.minRelayFeeRate() {
+		n.Stats.RejectedLowFeeTx++
+		return false
+	}
+
+	limit := n.Cfg.MempoolMaxBytes
+	if limit > 0 {
+		for n.mempoolBytes+tx.Size > limit {
+			lowest, ok := n.lowestFeeRateTx()
+			if !ok || lowest.FeeRate() >= tx.FeeRate() {
+				// The newcomer would be the first to go.
+				n.Stats.EvictedTx++
+				return false
+			}
+			n.removeFromMempool(lowest.ID)
+			n.Stats.EvictedTx++
+		}
+	}
+
+	n.Mempool[tx.ID] = tx
+	n.mempoolBytes += tx.Size
+	n.Ledger.MempoolAdded(*tx)
+	if limit > 0 {
+		heap.Push(&n.evictionQueue, feeRateEntry{txID: tx.ID, feeRate: tx.FeeRate()})
+	}
+	return true
+}
+
+func (n *Node) removeFromMempool(txID string) {
+	tx, exists := n.Mempool[txID]
+	if !exists {
+		return
+	}
+	delete(n.Mempool, txID)
+	n.mempoolBytes -= tx.Size
+	n.Ledger.MempoolRemoved(*tx)
+	if len(n.evictionQueue) > 2*len(n.Mempool)+64 {
+		n.rebuildEvictionQueue()
+	}
+}
+
+func (n *Node) lowestFeeRateTx() (*Transaction, bool) {
+	for n.evictionQueue.Len() > 0 {
+		entry := n.evictionQueue[0]
+		if tx, ok := n.Mempool[entry.txID]; ok {
+			return tx, true
+		}
+		heap.Pop(&n.evictionQueue)
+	}
+	return nil, false
+}
+
+func (n *Node) rebuildEvictionQueue() {
+	n.evictionQueue = n.evictionQueue[:0]
+	for id, tx := range n.Mempool {
+		n.evictionQueue = append(n.evictionQueue, feeRateEntry{txID: id, feeRate: tx.FeeRate()})
+	}
+	heap.Init(&n.evictionQueue)
+}
+
+// expireMempool drops transactions older than MempoolExpiry. The scan runs at
+// most once per simulated minute.
+func (n *Node) expireMempool() {
+	if n.Cfg.MempoolExpiry <= 0 || n.Sim.CurrentTime.Sub(n.lastExpiryCheck) < mempoolExpiryCheckInterval {
+		return
+	}
+	n.lastExpiryCheck = n.Sim.CurrentTime
+	cutoff := n.Sim.CurrentTime.Add(-n.Cfg.MempoolExpiry)
+	for id, tx := range n.Mempool {
+		if tx.Timestamp.Before(cutoff) {
+			n.removeFromMempool(id)
+			n.Stats.ExpiredTx++
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+)
+
+func mempoolIDs(n *Node) string {
+	ids := []string{}
+	for id := range n.Mempool {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Sprint(ids)
+}
+
+func TestMempoolEvictsLowestFeeRate(t *testing.T) {
+	cfg := testConfig(2, 1)
+	cfg.MempoolMaxBytes = 1000
+	n := newTestSimulation(t, cfg).Nodes[0]
+	for i, fee := range []int64{300, 600, 900} {
+		if !n.addToMempool(testTx(fmt.Sprintf("rate%d", i+1), 300, fee), false) {
+			t.Fatalf("tx %d rejected from a pool with room", i+1)
+		}
+	}
+	if !n.addToMempool(testTx("rate5", 300, 1500), false) {
+		t.Fatal("higher fee rate tx rejected from a full pool")
+	}
+	if got := mempoolIDs(n); got != "[rate2 rate3 rate5]" || n.mempoolBytes != 900 || n.Stats.EvictedTx != 1 {
+		t.Errorf("after eviction: pool %s (%d bytes), %d evicted; want [rate2 rate3 rate5], 900 bytes, 1 evicted",
+			got, n.mempoolBytes, n.Stats.EvictedTx)
+	}
+	if n.addToMempool(testTx("rate1.5", 300, 450), false) {
+		t.Error("a tx that would be evicted first was accepted into a full pool")
+	}
+	if got := mempoolIDs(n); got != "[rate2 rate3 rate5]" || n.Stats.EvictedTx != 2 {
+		t.Errorf("after a low fee newcomer: pool %s, %d evicted; want it unchanged and 2 evicted", got, n.Stats.EvictedTx)
+	}
+}
+
+func TestMempoolExpiry(t *testing.T) {
+	cfg := testConfig(2, 1)
+	cfg.MempoolExpiry = time.Hour
+	sim := newTestSimulation(t, cfg)
+	n := sim.Nodes[0]
+	old := testTx("old", 250, 250)
+	fresh := testTx("fresh", 250, 250)
+	fresh.Timestamp = SimulationEpoch.Add(time.Hour + 10*time.Second)
+	n.addToMempool(old, false)
+	n.addToMempool(fresh, false)
+
+	sim.CurrentTime = SimulationEpoch.Add(2 * time.Hour)
+	n.expireMempool()
+	if got := mempoolIDs(n); got != "[fresh]" || n.Stats.ExpiredTx != 1 || n.mempoolBytes != 250 {
+		t.Errorf("after 2h: pool %s (%d bytes), %d expired; want [fresh], 250 bytes, 1 expired", got, n.mempoolBytes, n.Stats.ExpiredTx)
+	}
+	// fresh is past the expiry 30s later, but the pool is scanned at most
+	// once a minute.
+	sim.CurrentTime = sim.CurrentTime.Add(30 * time.Second)
+	n.expireMempool()
+	if _, ok := n.Mempool["fresh"]; !ok {
+		t.Error("expiry ran again before a minute had passed since the last scan")
+	}
+}
+
+func TestMinRelayFeeRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		feeDist string
+		fill    float64
+		want    float64
+	}{
+		{"empty", FeeDistLognormal, 0, 2},
+		{"half full", FeeDistLognormal, 0.5, 2},
+		{"three quarters", FeeDistLognormal, 0.75, 2 * math.Sqrt(10)},
+		{"full", FeeDistLognormal, 1, 20},
+		{"no fees", FeeDistNone, 1, 0},
+	}
+	for _, tt := range tests {
+		cfg := testConfig(2, 1)
+		cfg.FeeRateDist = tt.feeDist
+		cfg.MinRelayFeeRate = 2
+		cfg.MempoolMaxBytes = 1000
+		n := newTestSimulation(t, cfg).Nodes[0]
+		n.mempoolBytes = int(tt.fill * 1000)
+		if got := n.minRelayFeeRate(); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: minRelayFeeRate = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMinRelayFeeRejectsCheapTxs(t *testing.T) {
+	cfg := testConfig(2, 1)
+	cfg.MinRelayFeeRate = 2
+	n := newTestSimulation(t, cfg).Nodes[0]
+	if n.addToMempool(testTx("cheap", 100, 150), false) || n.Stats.RejectedLowFeeTx != 1 {
+		t.Errorf("a 1.5 sat/byte tx entered the pool or was not counted (%d rejected)", n.Stats.RejectedLowFeeTx)
+	}
+	if !n.addToMempool(testTx("cheap", 100, 150), true) {
+		t.Error("a tx returned by a reorg was held to the minimum relay fee")
+	}
+	if !n.addToMempool(testTx("paying", 100, 200), false) {
+		t.Error("a tx paying exactly the minimum was rejected")
+	}
+}
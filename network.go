@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// transmissionTime is how long sizeBytes take to cross a link limited by the
+// slower of the sender's upload and the receiver's download bandwidth. A zero
+// bandwidth is unlimited.
+func transmissionTime(sizeBytes int, uploadMbps, downloadMbps float64) time.Duration {
+	mbps := uploadMbps
+	if mbps == 0 || (downloadMbps > 0 && downloadMbps < mbps) {
+		mbps = downloadMbps
+	}
+	if mbps == 0 {
+		return 0
+	}
+	seconds := float64(sizeBytes) * 8 / (mbps * 1e6)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// sendDelay returns how long a message of sizeBytes sent now takes to reach
+// targetID: the time spent queued behind earlier messages on n's upload link,
+// its own transmission time, and the link latency.
+func (n *Node) sendDelay(targetID int, sizeBytes int) time.Duration {
+	target := n.Sim.Nodes[targetID]
+	latency := n.Sim.linkLatency(n, target)
+
+	start := n.Sim.CurrentTime
+	if n.uploadBusyUntil.After(start) {
+		start = n.uploadBusyUntil
+	}
+	n.uploadBusyUntil = start.Add(transmissionTime(sizeBytes, n.UploadMbps, target.DownloadMbps))
+	n.Stats.BytesSent += int64(sizeBytes)
+	return n.uploadBusyUntil.Sub(n.Sim.CurrentTime) + latency
+}
+
+// recordBlockArrival counts a node accepting b and notes when it has reached
+// half and 90% of the network.
+func (s *Simulation) recordBlockArrival(b Block) {
+	s.blockArrivals[b.Hash]++
+	arrivals := s.blockArrivals[b.Hash]
+	elapsed := s.CurrentTime.Sub(b.FoundTime)
+	if arrivals == (len(s.Nodes)+1)/2 {
+		s.BlockPropagation50 = append(s.BlockPropagation50, elapsed)
+	}
+	if arrivals == (len(s.Nodes)*9+9)/10 {
+		s.BlockPropagation90 = append(s.BlockPropagation90, elapsed)
+	}
+}
@@ -1,69 +1,132 @@
 package main
 
 import (
-	"container/heap"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"time"
 )
 
 type NodeStats struct {
-	ReceivedTx         int
-	AddedToMempool     int
-	RelayedTx          int
-	ReceivedBlocks     int
-	ValidatedBlocks    int
-	RelayedBlocks      int
-	ReceivedOrphans    int
-	ProcessedOrphans   int
-	HandledReorgs      int
-	StaleBlocksInReorg int
-	MiningAttempts     int
-	MinedBlocks        int
+	ReceivedTx           int
+	AddedToMempool       int
+	RelayedTx            int
+	ReceivedBlocks       int
+	ValidatedBlocks      int
+	RelayedBlocks        int
+	ReceivedOrphans      int
+	ProcessedOrphans     int
+	HandledReorgs        int
+	StaleBlocksInReorg   int
+	MiningAttempts       int
+	MinedBlocks          int
+	InvalidBlocks        int
+	ForkTies             int
+	RejectedLowFeeTx     int
+	EvictedTx            int
+	ExpiredTx            int
+	RejectedDoubleSpend  int
+	RejectedInvalidTx    int
+	ConflictingTxDropped int
+	OrphanTxs            int
+	OrphanTxsDropped     int
+	BytesSent            int64
 }
 
 type Node struct {
 	ID               int
 	IsMiner          bool
+	Region           int
 	Peers            []int
-	Mempool          map[string]Transaction
-	KnownTx          map[string]bool
-	Blocks           map[string]Block
+	Mempool          map[string]*Transaction
+	Blocks           map[string]*Block
 	ChainHeight      map[int][]string
 	BestChainTip     string
-	ChainWork        map[string]int
+	ChainWork        map[string]float64
 	OrphanBlocks     map[string][]Block
 	CurrentMiningJob *Event
+	Strategy         MinerStrategy
+	Ledger           Ledger
 	Sim              *Simulation
 	Cfg              *Config
 	Stats            NodeStats
+	UploadMbps       float64
+	DownloadMbps     float64
+	// PacketLoss and PacketDuplication are the node's link reliability,
+	// -packet_loss and -packet_dup unless a node override sets them.
+	PacketLoss        float64
+	PacketDuplication float64
+	// Offline is set while the node is down or before a late joiner joins.
+	Offline bool
 
 	isWaitingToMine bool
+	tiedTips        int
+	mempoolBytes    int
+	evictionQueue   feeRateHeap
+	lastExpiryCheck time.Time
+	invalidBlocks   map[string]bool
+	// orphanTxs holds transactions whose inputs are not known yet, keyed by
+	// the missing parent transaction.
+	orphanTxs     map[string][]*Transaction
+	orphanTxCount int
+	// uploadBusyUntil is when the upload link finishes sending what is
+	// already queued on it.
+	uploadBusyUntil time.Time
+	// requested holds the transactions and blocks the node has asked a peer
+	// for, so later announcements from other peers do not fetch them again.
+	requested map[string]bool
+	// knownTx holds every transaction the node has seen.
+	knownTx seenSet
+	// reconstructing maps compact blocks waiting for a blocktxn reply to
+	// the peer that was asked for the missing transactions.
+	reconstructing map[string]int
+	// extraTxs holds the IDs of the last CompactExtraTxs transactions the node
+	// rejected or dropped as double spends, oldest first in extraTxOrder.
+	// Like Bitcoin Core, it uses them to rebuild compact blocks that
+	// include the other side of a double spend.
+	extraTxs     map[string]bool
+	extraTxOrder []string
+	// syncing is the block download in progress, if any.
+	syncing *SyncRecord
+	// pendingRequests maps each requested object to its request timeout.
+	pendingRequests map[string]*pendingRequest
 }
 
+const maxOrphanTxs = 100
+
 func NewNode(id int, isMiner bool, sim *Simulation, cfg *Config) *Node {
 	genesisBlock := sim.GenesisBlock
 	n := &Node{
-		ID:              id,
-		IsMiner:         isMiner,
-		Peers:           make([]int, 0),
-		Mempool:         make(map[string]Transaction),
-		KnownTx:         make(map[string]bool),
-		Blocks:          make(map[string]Block),
-		ChainHeight:     make(map[int][]string),
-		ChainWork:       make(map[string]int),
-		OrphanBlocks:    make(map[string][]Block),
-		BestChainTip:    genesisBlock.Hash,
-		Sim:             sim,
-		Cfg:             cfg,
-		Stats:           NodeStats{},
-		isWaitingToMine: isMiner,
-	}
-
-	n.Blocks[genesisBlock.Hash] = genesisBlock
+		ID:                id,
+		IsMiner:           isMiner,
+		Peers:             make([]int, 0),
+		Mempool:           make(map[string]*Transaction),
+		Blocks:            make(map[string]*Block),
+		ChainHeight:       make(map[int][]string),
+		ChainWork:         make(map[string]float64),
+		OrphanBlocks:      make(map[string][]Block),
+		Ledger:            SimpleLedger{},
+		BestChainTip:      genesisBlock.Hash,
+		Sim:               sim,
+		Cfg:               cfg,
+		Stats:             NodeStats{},
+		UploadMbps:        cfg.UploadMbps,
+		DownloadMbps:      cfg.DownloadMbps,
+		PacketLoss:        cfg.PacketLoss,
+		PacketDuplication: cfg.PacketDuplication,
+		isWaitingToMine:   isMiner,
+		tiedTips:          1,
+		invalidBlocks:     make(map[string]bool),
+		orphanTxs:         make(map[string][]*Transaction),
+		requested:         make(map[string]bool),
+		reconstructing:    make(map[string]int),
+		extraTxs:          make(map[string]bool),
+		pendingRequests:   make(map[string]*pendingRequest),
+	}
+
+	n.Blocks[genesisBlock.Hash] = sim.blockStore.intern(genesisBlock)
 	n.ChainHeight[0] = []string{genesisBlock.Hash}
 	n.ChainWork[genesisBlock.Hash] = 0
-	n.KnownTx[genesisBlock.Hash] = true
 	return n
 }
 
@@ -74,56 +137,187 @@ func (n *Node) AddPeer(peerID int) {
 	}
 }
 
-func (n *Node) ReceiveTransaction(tx Transaction) {
+func (n *Node) ReceiveTransaction(tx *Transaction, fromNodeID int) {
 	n.Stats.ReceivedTx++
-	if _, known := n.KnownTx[tx.ID]; known {
+	n.answered(tx.ID)
+	if n.knowsTx(tx.ID) {
+		if fromNodeID >= 0 {
+			n.Sim.RedundantBytes += int64(messageHeaderSize + tx.Size)
+		}
 		return
 	}
 
-	n.Mempool[tx.ID] = tx
-	n.KnownTx[tx.ID] = true
+	n.markTxKnown(tx.ID)
+	delete(n.requested, tx.ID)
+	n.acceptTransaction(tx, fromNodeID)
+}
+
+// acceptTransaction adds a new transaction to the mempool and relays it. A
+// transaction spending outputs the node has not seen yet waits in the orphan
+// pool until its parent arrives.
+func (n *Node) acceptTransaction(tx *Transaction, fromNodeID int) {
+	if err := n.Ledger.CheckTx(*tx); err != nil {
+		var missing *MissingInputsError
+		if errors.As(err, &missing) {
+			n.addOrphanTx(tx, missing.ParentID)
+		} else if errors.Is(err, ErrInvalidTx) {
+			n.Stats.RejectedInvalidTx++
+		} else {
+			n.Stats.RejectedDoubleSpend++
+			n.keepExtraTx(tx.ID)
+		}
+		return
+	}
+	if !n.addToMempool(tx, false) {
+		return
+	}
 	n.Stats.AddedToMempool++
 
 	if n.IsMiner && n.isWaitingToMine && n.CurrentMiningJob == nil {
 		if n.canAttemptMiningNow() {
-			log.Printf("T=%.3fs Node %d: Mempool reached threshold (95%%) after receiving Tx %s. Triggering mining attempt.\n",
-				n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, tx.ID[:6])
+			log.Printf("T=%.3fs Node %d: %s strategy ready to mine after receiving Tx %s. Triggering mining attempt.\n",
+				n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, n.Strategy.Name(), tx.ID[:6])
 			n.scheduleMiningAttempt()
 			n.isWaitingToMine = false
 		}
+	} else if honest, ok := n.Strategy.(*HonestStrategy); ok && honest.RefreshTemplates && n.CurrentMiningJob != nil {
+		n.restartMining()
+	}
+
+	n.relayTx(tx, fromNodeID)
+	n.retryOrphanTxs(tx.ID)
+}
+
+// keepExtraTx remembers a transaction rejected or dropped as a double spend,
+// forgetting the oldest once CompactExtraTxs are kept.
+func (n *Node) keepExtraTx(id string) {
+	if n.extraTxs[id] || n.Cfg.CompactExtraTxs == 0 {
+		return
+	}
+	if len(n.extraTxOrder) >= n.Cfg.CompactExtraTxs {
+		delete(n.extraTxs, n.extraTxOrder[0])
+		n.extraTxOrder = n.extraTxOrder[1:]
 	}
+	n.extraTxOrder = append(n.extraTxOrder, id)
+	n.extraTxs[id] = true
+}
 
-	for targetNodeID := range n.Sim.Nodes {
-		if targetNodeID == n.ID {
-			continue
+// addOrphanTx holds tx until parentID arrives. When the orphan pool is full
+// the node drops tx and forgets it, so a later relay can still deliver it.
+func (n *Node) addOrphanTx(tx *Transaction, parentID string) {
+	if n.orphanTxCount >= maxOrphanTxs {
+		n.Stats.OrphanTxsDropped++
+		n.forgetTx(tx.ID)
+		return
+	}
+	n.orphanTxs[parentID] = append(n.orphanTxs[parentID], tx)
+	n.orphanTxCount++
+	n.Stats.OrphanTxs++
+}
+
+// retryOrphanTxs re-validates orphans waiting on parentID now that it is in
+// the mempool or on chain.
+func (n *Node) retryOrphanTxs(parentID string) {
+	orphans, ok := n.orphanTxs[parentID]
+	if !ok {
+		return
+	}
+	delete(n.orphanTxs, parentID)
+	n.orphanTxCount -= len(orphans)
+	for _, orphan := range orphans {
+		n.acceptTransaction(orphan, -1)
+	}
+}
+
+// relayTargets returns the nodes a message is forwarded to. In broadcast mode
+// that is every other node; in gossip mode only direct peers, skipping the
+// peer the message came from.
+func (n *Node) relayTargets(fromNodeID int) []int {
+	targets := []int{}
+	if n.Cfg.RelayMode == RelayGossip {
+		for _, peerID := range n.Peers {
+			if peerID != fromNodeID {
+				targets = append(targets, peerID)
+			}
 		}
-		delay := CalculateNetworkDelay(n.Cfg)
-		n.Sim.ScheduleEvent(n.Sim.CurrentTime.Add(delay), EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: targetNodeID, Tx: tx})
-		n.Stats.RelayedTx++
+		return targets
 	}
+	for targetNodeID := 0; targetNodeID < len(n.Sim.Nodes); targetNodeID++ {
+		if targetNodeID != n.ID {
+			targets = append(targets, targetNodeID)
+		}
+	}
+	return targets
 }
 
-func (n *Node) ReceiveBlock(b Block) {
+func (n *Node) ReceiveBlock(b Block, fromNodeID int) {
 	n.Stats.ReceivedBlocks++
+	n.answered(b.Hash)
 	if _, known := n.Blocks[b.Hash]; known {
+		if fromNodeID >= 0 {
+			n.Sim.RedundantBytes += int64(messageHeaderSize + b.Size())
+		}
 		return
 	}
 
+	_, parentKnown := n.Blocks[b.Header.PrevHash]
+	_, parentWaiting := n.reconstructing[b.Header.PrevHash]
+	accepted, tipChanged := n.acceptBlock(b)
+	if !parentKnown && fromNodeID >= 0 && (!n.requested[b.Header.PrevHash] || parentWaiting) {
+		// Fetch the missing parent from the peer that sent the orphan,
+		// even if it is still waiting for a blocktxn reply that may have
+		// been lost.
+		n.requested[b.Header.PrevHash] = true
+		n.requestData(fromNodeID, MsgBlock, []string{b.Header.PrevHash})
+	}
+	if !accepted {
+		return
+	}
+	if n.syncing != nil {
+		// Blocks are neither relayed nor mined on during the initial block
+		// download.
+		n.syncing.Blocks++
+		n.syncing.Bytes += int64(b.Size())
+		n.checkSync()
+	} else {
+		n.relayBlock(b, fromNodeID)
+		if tipChanged {
+			n.restartMining()
+		}
+	}
+	if n.Strategy != nil && b.Header.MinerID != n.ID {
+		n.Strategy.OnBlockReceived(n, b)
+	}
+}
+
+// acceptBlock validates b and adds it to the node's block tree, moving the best
+// tip if the fork choice prefers it. It does not relay the block.
+func (n *Node) acceptBlock(b Block) (accepted bool, tipChanged bool) {
 	parentBlock, parentKnown := n.Blocks[b.Header.PrevHash]
 	if !parentKnown {
 		n.Stats.ReceivedOrphans++
 		n.OrphanBlocks[b.Header.PrevHash] = append(n.OrphanBlocks[b.Header.PrevHash], b)
-		return
+		return false, false
 	}
 	if b.Header.Height != parentBlock.Header.Height+1 {
-		return
+		return false, false
+	}
+	if n.invalidBlocks[b.Header.PrevHash] {
+		n.invalidBlocks[b.Hash] = true
+		n.Stats.InvalidBlocks++
+		return false, false
+	}
+	if expected := n.Sim.Difficulty.NextDifficulty(n.lookupBlock, parentBlock); !workEqual(b.Header.Difficulty, expected) {
+		n.Stats.InvalidBlocks++
+		return false, false
 	}
 	n.Stats.ValidatedBlocks++
 
-	n.Blocks[b.Hash] = b
-	n.KnownTx[b.Hash] = true
+	n.Blocks[b.Hash] = n.Sim.blockStore.intern(b)
+	delete(n.requested, b.Hash)
+	n.Sim.recordBlockArrival(b)
 	n.ChainHeight[b.Header.Height] = append(n.ChainHeight[b.Header.Height], b.Hash)
-	n.ChainWork[b.Hash] = n.ChainWork[b.Header.PrevHash] + 1
+	n.ChainWork[b.Hash] = n.ChainWork[b.Header.PrevHash] + b.Header.Difficulty
 
 	n.updateMempoolForNewBlock(b)
 
@@ -131,42 +325,35 @@ func (n *Node) ReceiveBlock(b Block) {
 		n.Stats.ProcessedOrphans += len(orphans)
 		delete(n.OrphanBlocks, b.Hash)
 		for _, orphanBlock := range orphans {
-			n.Sim.ScheduleEventWithPriority(n.Sim.CurrentTime, EvReceiveBlock, ReceiveBlockData{TargetNodeID: n.ID, Block: orphanBlock}, 0)
+			n.Sim.ScheduleEventWithPriority(n.Sim.CurrentTime, EvReceiveBlock, ReceiveBlockData{TargetNodeID: n.ID, FromNodeID: -1, Block: orphanBlock}, 0)
 		}
 	}
 
-	currentBestHeight := n.ChainWork[n.BestChainTip]
-	newBlockHeight := n.ChainWork[b.Hash]
-
-	if newBlockHeight > currentBestHeight {
+	if n.prefersChain(b.Hash) {
 		oldTipHash := n.BestChainTip
+		connected, err := n.switchChainState(oldTipHash, b.Hash)
+		if err != nil {
+			n.Stats.InvalidBlocks++
+			log.Printf("T=%.3fs Node %d: Rejecting chain ending in block %s: %v\n",
+				n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, b.Hash[:6], err)
+			return false, false
+		}
 		n.BestChainTip = b.Hash
 
 		if b.Header.PrevHash != oldTipHash {
 			n.handleReorg(oldTipHash, b.Hash)
 		}
-
-		n.relayBlock(b)
-		n.restartMining()
-
-	} else {
-		n.relayBlock(b)
-	}
-}
-
-func (n *Node) relayBlock(b Block) {
-
-	for targetNodeID := range n.Sim.Nodes {
-		if targetNodeID == n.ID {
-			continue
+		for _, connectedBlock := range connected {
+			for _, tx := range connectedBlock.Transactions {
+				n.retryOrphanTxs(tx.ID)
+			}
 		}
-		delay := CalculateNetworkDelay(n.Cfg)
-		n.Sim.ScheduleEvent(n.Sim.CurrentTime.Add(delay), EvReceiveBlock, ReceiveBlockData{
-			TargetNodeID: targetNodeID, Block: b,
-		})
-		n.Stats.RelayedBlocks++
+		if n.ID == n.Sim.ReferenceNodeID {
+			n.Sim.Confirmations.OnTipChanged(n)
+		}
+		return true, true
 	}
-
+	return true, false
 }
 
 func (n *Node) restartMining() {
@@ -174,38 +361,24 @@ func (n *Node) restartMining() {
 		return
 	}
 
-	if n.CurrentMiningJob != nil {
-		n.CurrentMiningJob = nil
-	}
+	n.cancelMiningJob()
 	n.isWaitingToMine = false
 
 	if n.canAttemptMiningNow() {
 
 		n.scheduleMiningAttempt()
 	} else {
-		log.Printf("T=%.3fs Node %d: Mempool below threshold (95%%) upon block update. Waiting for transactions.\n",
-			n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID)
+		log.Printf("T=%.3fs Node %d: %s strategy not ready to mine upon block update. Waiting for transactions.\n",
+			n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, n.Strategy.Name())
 		n.isWaitingToMine = true
 	}
 }
 
 func (n *Node) canAttemptMiningNow() bool {
-	if !n.IsMiner {
+	if !n.IsMiner || n.Strategy == nil || n.syncing != nil {
 		return false
 	}
-
-	requiredBytesFloat := float64(n.Cfg.BlockSizeLimitBytes) * (95.0 / 100.0)
-
-	if requiredBytesFloat <= 0 {
-		return true
-	}
-
-	currentMempoolTotalBytes := 0
-	for _, tx := range n.Mempool {
-		currentMempoolTotalBytes += tx.Size
-	}
-
-	return float64(currentMempoolTotalBytes) >= requiredBytesFloat
+	return n.Strategy.ShouldStartMining(n)
 }
 
 func (n *Node) scheduleMiningAttempt() {
@@ -214,9 +387,12 @@ func (n *Node) scheduleMiningAttempt() {
 		return
 	}
 
-	tipHeight := n.ChainWork[n.BestChainTip]
-	parentHash := n.BestChainTip
-	nextHeight := tipHeight + 1
+	parentHash := n.Strategy.SelectParent(n)
+	parentHeight, ok := n.heightOf(parentHash)
+	if !ok {
+		return
+	}
+	nextHeight := parentHeight + 1
 
 	log.Printf("T=%.3fs Node %d: Scheduling mining attempt for height %d on parent %s\n",
 		n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, nextHeight, parentHash[:6])
@@ -234,36 +410,28 @@ func (n *Node) AttemptMining(data AttemptMiningData) {
 		return
 	}
 
-	if data.ParentBlockHash != n.BestChainTip {
+	if data.ParentBlockHash != n.Strategy.SelectParent(n) {
 		return
 	}
-	if data.Height != n.ChainWork[n.BestChainTip]+1 {
+	if parentHeight, _ := n.heightOf(data.ParentBlockHash); data.Height != parentHeight+1 {
 		return
 	}
 
 	n.Stats.MiningAttempts++
 
-	selectedTxs := []Transaction{}
-	currentBlockSizeBytes := 0
-	mempoolTxs := make([]Transaction, 0, len(n.Mempool))
-	for _, tx := range n.Mempool {
-		mempoolTxs = append(mempoolTxs, tx)
-	}
-	rand.Shuffle(len(mempoolTxs), func(i, j int) { mempoolTxs[i], mempoolTxs[j] = mempoolTxs[j], mempoolTxs[i] })
-
-	for _, tx := range mempoolTxs {
-		if currentBlockSizeBytes+tx.Size <= n.Cfg.BlockSizeLimitBytes {
-			selectedTxs = append(selectedTxs, tx)
-			currentBlockSizeBytes += tx.Size
-		}
+	selectedTxs := n.Strategy.SelectTransactions(n, n.Cfg.BlockSizeLimitBytes-BlockHeaderSize)
+	currentBlockSizeBytes := BlockHeaderSize
+	for _, tx := range selectedTxs {
+		currentBlockSizeBytes += tx.Size
 	}
 
 	log.Printf("T=%.3fs Node %d: Starting Mining Calculation H=%d Parent=%s | Selected=%d txs (%d bytes / %d limit)",
 		n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, data.Height, data.ParentBlockHash[:6],
 		len(selectedTxs), currentBlockSizeBytes, n.Cfg.BlockSizeLimitBytes)
 
-	candidateBlock := NewBlock(data.Height, data.ParentBlockHash, n.Sim.CurrentTime, n.ID, selectedTxs)
-	timeToFind := CalculateTimeToFind(n.Cfg)
+	difficulty := n.Sim.Difficulty.NextDifficulty(n.lookupBlock, n.Blocks[data.ParentBlockHash])
+	candidateBlock := NewBlock(data.Height, data.ParentBlockHash, n.Sim.CurrentTime, n.ID, difficulty, selectedTxs)
+	timeToFind := n.Sim.TimeToFind(n.ID, difficulty)
 	foundTimestamp := n.Sim.CurrentTime.Add(timeToFind)
 
 	if foundTimestamp.Sub(n.Sim.StartTime) < n.Cfg.SimulationDuration {
@@ -272,13 +440,21 @@ func (n *Node) AttemptMining(data AttemptMiningData) {
 			Data:     BlockFoundData{MinerNodeID: n.ID, Block: candidateBlock},
 			Priority: int(EvBlockFound),
 		}
-		heap.Push(&n.Sim.EventQueue, foundEvent)
+		n.cancelMiningJob()
+		n.Sim.PushEvent(foundEvent)
 		n.CurrentMiningJob = foundEvent
 	} else {
-		n.CurrentMiningJob = nil
+		n.cancelMiningJob()
 	}
 }
 
+// cancelMiningJob abandons the current mining job and removes its pending
+// block-found event from the queue.
+func (n *Node) cancelMiningJob() {
+	n.Sim.CancelEvent(n.CurrentMiningJob)
+	n.CurrentMiningJob = nil
+}
+
 func (n *Node) ProcessFoundBlock(data BlockFoundData, event *Event) {
 	if !n.IsMiner {
 		return
@@ -301,7 +477,7 @@ func (n *Node) ProcessFoundBlock(data BlockFoundData, event *Event) {
 			}
 		}
 
-		n.ReceiveBlock(foundBlock)
+		n.Strategy.OnBlockFound(n, foundBlock)
 
 	} else {
 
@@ -310,8 +486,8 @@ func (n *Node) ProcessFoundBlock(data BlockFoundData, event *Event) {
 
 func (n *Node) updateMempoolForNewBlock(b Block) {
 	for _, tx := range b.Transactions {
-		delete(n.Mempool, tx.ID)
-		n.KnownTx[tx.ID] = true
+		n.removeFromMempool(tx.ID)
+		n.markTxKnown(tx.ID)
 	}
 }
 
@@ -324,7 +500,7 @@ func (n *Node) handleReorg(oldTipHash string, newTipHash string) {
 		return
 	}
 
-	staleBlocks := []Block{}
+	staleBlocks := []*Block{}
 	currentHash := oldTipHash
 	initialStaleCount := n.Stats.StaleBlocksInReorg
 	for currentHash != ancestorHash {
@@ -338,20 +514,26 @@ func (n *Node) handleReorg(oldTipHash string, newTipHash string) {
 	}
 
 	n.Sim.IncrementStaleCounterBy(n.Stats.StaleBlocksInReorg - initialStaleCount)
+	if n.ID == n.Sim.ReferenceNodeID {
+		n.Sim.Confirmations.RevertBlocks(staleBlocks)
+	}
 
-	newBlocks := []Block{}
+	newBlocks := []*Block{}
 	currentHash = newTipHash
 	for currentHash != ancestorHash {
 		block, ok := n.Blocks[currentHash]
 		if !ok {
 			break
 		}
-		newBlocks = append([]Block{block}, newBlocks...)
+		newBlocks = append([]*Block{block}, newBlocks...)
 		currentHash = block.Header.PrevHash
 	}
 
-	for _, staleBlock := range staleBlocks {
-		for _, tx := range staleBlock.Transactions {
+	// Oldest first, so parents return to the mempool before their children.
+	revertedTxs := 0
+	for i := len(staleBlocks) - 1; i >= 0; i-- {
+		for j := range staleBlocks[i].Transactions {
+			tx := &staleBlocks[i].Transactions[j]
 			inNewChain := false
 			for _, newBlock := range newBlocks {
 				for _, newTx := range newBlock.Transactions {
@@ -366,21 +548,29 @@ func (n *Node) handleReorg(oldTipHash string, newTipHash string) {
 			}
 			if !inNewChain {
 
-				if _, known := n.KnownTx[tx.ID]; !known {
-					n.Mempool[tx.ID] = tx
-					n.KnownTx[tx.ID] = true
-				} else if _, inMempool := n.Mempool[tx.ID]; !inMempool {
-					n.Mempool[tx.ID] = tx
+				n.markTxKnown(tx.ID)
+				if err := n.Ledger.CheckTx(*tx); err != nil {
+					var missing *MissingInputsError
+					if errors.As(err, &missing) {
+						n.addOrphanTx(tx, missing.ParentID)
+					} else {
+						n.Stats.ConflictingTxDropped++
+					}
+					continue
+				}
+				if n.addToMempool(tx, true) {
+					revertedTxs++
 				}
 			}
 		}
 	}
-
+	ancestorHeight, _ := n.heightOf(ancestorHash)
+	n.Sim.recordReorg(ancestorHeight, len(staleBlocks), revertedTxs)
 }
 
 func (n *Node) findCommonAncestor(hash1, hash2 string) string {
-	h1, ok1 := n.ChainWork[hash1]
-	h2, ok2 := n.ChainWork[hash2]
+	h1, ok1 := n.heightOf(hash1)
+	h2, ok2 := n.heightOf(hash2)
 	if !ok1 || !ok2 {
 		return ""
 	}
@@ -419,27 +609,48 @@ func (n *Node) findCommonAncestor(hash1, hash2 string) string {
 	return curr1
 }
 
-func (n *Node) PrintStats() {
-	tipHeight := -1
-	if h, ok := n.ChainWork[n.BestChainTip]; ok {
-		tipHeight = h
-	} else if n.BestChainTip == n.Sim.GenesisBlock.Hash {
-		tipHeight = 0
+func (n *Node) lookupBlock(hash string) (*Block, bool) {
+	b, ok := n.Blocks[hash]
+	return b, ok
+}
+
+func (n *Node) heightOf(hash string) (int, bool) {
+	b, ok := n.Blocks[hash]
+	if !ok {
+		return -1, false
 	}
+	return b.Header.Height, true
+}
+
+// TipHeight returns the height of the node's best chain tip, or -1 if the tip
+// is unknown.
+func (n *Node) TipHeight() int {
+	h, _ := n.heightOf(n.BestChainTip)
+	return h
+}
+
+func (n *Node) PrintStats() {
+	tipHeight := n.TipHeight()
 
 	fmt.Printf("--- Node %d Stats ---\n", n.ID)
-	fmt.Printf("  Final State: Tip=%s (Height:%d), MempoolSize:%d txs\n",
-		n.BestChainTip[:6], tipHeight, len(n.Mempool))
+	fmt.Printf("  Final State: Tip=%s (Height:%d), MempoolSize:%d txs (%d bytes)\n",
+		n.BestChainTip[:6], tipHeight, len(n.Mempool), n.mempoolBytes)
 	fmt.Printf("  Transactions: Rcvd:%d, AddedToMempool:%d, Relayed/Bcast:%d\n",
 		n.Stats.ReceivedTx, n.Stats.AddedToMempool, n.Stats.RelayedTx)
-	fmt.Printf("  Blocks: Rcvd:%d, Validated:%d, Relayed/Bcast:%d\n",
-		n.Stats.ReceivedBlocks, n.Stats.ValidatedBlocks, n.Stats.RelayedBlocks)
+	fmt.Printf("  Mempool: RejectedLowFee:%d, Evicted:%d, Expired:%d\n",
+		n.Stats.RejectedLowFeeTx, n.Stats.EvictedTx, n.Stats.ExpiredTx)
+	if n.Cfg.TxModel != TxModelSimple {
+		fmt.Printf("  Ledger: RejectedDoubleSpend:%d, RejectedInvalid:%d, ConflictsDropped:%d, OrphanTxs:%d, OrphansDropped:%d\n",
+			n.Stats.RejectedDoubleSpend, n.Stats.RejectedInvalidTx, n.Stats.ConflictingTxDropped, n.Stats.OrphanTxs, n.Stats.OrphanTxsDropped)
+	}
+	fmt.Printf("  Blocks: Rcvd:%d, Validated:%d, Invalid:%d, Relayed/Bcast:%d\n",
+		n.Stats.ReceivedBlocks, n.Stats.ValidatedBlocks, n.Stats.InvalidBlocks, n.Stats.RelayedBlocks)
 	fmt.Printf("  Orphans: Rcvd:%d, ProcessedLater:%d\n",
 		n.Stats.ReceivedOrphans, n.Stats.ProcessedOrphans)
-	fmt.Printf("  Forks: ReorgsHandled:%d, StaleBlocksInReorgs:%d\n",
-		n.Stats.HandledReorgs, n.Stats.StaleBlocksInReorg)
+	fmt.Printf("  Forks: ReorgsHandled:%d, StaleBlocksInReorgs:%d, EqualWorkTies:%d\n",
+		n.Stats.HandledReorgs, n.Stats.StaleBlocksInReorg, n.Stats.ForkTies)
 	if n.IsMiner {
-		fmt.Printf("  Mining: AttemptsStarted:%d, BlocksMinedSuccess:%d\n",
-			n.Stats.MiningAttempts, n.Stats.MinedBlocks)
+		fmt.Printf("  Mining: Strategy:%s, AttemptsStarted:%d, BlocksMinedSuccess:%d\n",
+			n.Strategy.Name(), n.Stats.MiningAttempts, n.Stats.MinedBlocks)
 	}
 }
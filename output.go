@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"math"
+	"os"
+)
+
+// OutputOptions control where a simulation run writes its results. They do
+// not affect the run itself, so they live apart from Config.
+type OutputOptions struct {
+	LogFile     string
+	ResultsJSON string
+	PrintChain  bool
+}
+
+func DefaultOutputOptions() OutputOptions {
+	return OutputOptions{PrintChain: true}
+}
+
+func registerOutputFlags(fs *flag.FlagSet, out *OutputOptions) {
+	fs.StringVar(&out.LogFile, "log_file", out.LogFile, "Write the simulation log to this file instead of stdout")
+	fs.StringVar(&out.ResultsJSON, "results_json", out.ResultsJSON, "Write the headline metrics of the run to this JSON file")
+	fs.BoolVar(&out.PrintChain, "print_chain", out.PrintChain, "Print the reference node's final blockchain at the end of the log")
+}
+
+type resultMetricJSON struct {
+	Name  string   `json:"name"`
+	Value *float64 `json:"value"`
+}
+
+// writeResultsJSON writes the metrics a sweep collects for a single run.
+// Undefined metrics are null.
+func writeResultsJSON(path string, sim *Simulation) error {
+	out := struct {
+		Seed       int64              `json:"seed"`
+		SimulatedS float64            `json:"simulated_s"`
+		Metrics    []resultMetricJSON `json:"metrics"`
+	}{Seed: sim.Cfg.Seed, SimulatedS: sim.CurrentTime.Sub(sim.StartTime).Seconds()}
+	for _, m := range collectMetrics(sim) {
+		metric := resultMetricJSON{Name: m.Name}
+		if !math.IsNaN(m.Value) {
+			value := m.Value
+			metric.Value = &value
+		}
+		out.Metrics = append(out.Metrics, metric)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NodeOverride replaces the network-wide settings for one node. Nil and empty
+// fields keep the node's usual value.
+type NodeOverride struct {
+	NodeID int
+	// HashPower is the node's share of the total hash rate. A positive share
+	// makes the node a miner; zero keeps it from mining.
+	HashPower    *float64
+	UploadMbps   *float64
+	DownloadMbps *float64
+	// PacketLoss and PacketDuplication apply to every link of the node; a
+	// link between two nodes uses the higher of their probabilities.
+	PacketLoss        *float64
+	PacketDuplication *float64
+	Region            string
+	// Strategy is a miner strategy name; it also makes the node a miner.
+	Strategy string
+}
+
+func (o NodeOverride) String() string {
+	parts := []string{}
+	if o.HashPower != nil {
+		parts = append(parts, fmt.Sprintf("hash_power=%g", *o.HashPower))
+	}
+	if o.UploadMbps != nil {
+		parts = append(parts, fmt.Sprintf("upload_mbps=%g", *o.UploadMbps))
+	}
+	if o.DownloadMbps != nil {
+		parts = append(parts, fmt.Sprintf("download_mbps=%g", *o.DownloadMbps))
+	}
+	if o.PacketLoss != nil {
+		parts = append(parts, fmt.Sprintf("packet_loss=%g", *o.PacketLoss))
+	}
+	if o.PacketDuplication != nil {
+		parts = append(parts, fmt.Sprintf("packet_dup=%g", *o.PacketDuplication))
+	}
+	if o.Region != "" {
+		parts = append(parts, "region="+o.Region)
+	}
+	if o.Strategy != "" {
+		parts = append(parts, "strategy="+o.Strategy)
+	}
+	return fmt.Sprintf("node %d (%s)", o.NodeID, strings.Join(parts, ", "))
+}
+
+// hasLossyLinks reports whether any override changes link reliability.
+func hasLossyLinks(overrides []NodeOverride) bool {
+	for _, o := range overrides {
+		if o.PacketLoss != nil || o.PacketDuplication != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// makesMiner reports whether the override forces the node to mine.
+func (o NodeOverride) makesMiner() bool {
+	return (o.HashPower != nil && *o.HashPower > 0) || o.Strategy != ""
+}
+
+// barsMining reports whether the override keeps the node from mining.
+func (o NodeOverride) barsMining() bool {
+	return o.HashPower != nil && *o.HashPower == 0
+}
+
+// checkNodeOverrides checks the overrides against the rest of cfg: the nodes
+// they name must exist and the miners they force must fit in NumMiners.
+func checkNodeOverrides(cfg *Config) error {
+	regions, err := LoadRegionTable(cfg)
+	if err != nil {
+		return &ConfigError{Flag: "regions", Err: err}
+	}
+	forced, barred := 0, 0
+	for _, o := range cfg.NodeOverrides {
+		if o.NodeID < 0 || o.NodeID >= cfg.NumNodes {
+			return invalidFlag("nodes", "node %d has overrides but nodes are 0..%d", o.NodeID, cfg.NumNodes-1)
+		}
+		if o.Region != "" {
+			if _, err := regions.index(o.Region); err != nil {
+				return &ConfigError{Flag: "regions", Err: fmt.Errorf("node %d: %w", o.NodeID, err)}
+			}
+		}
+		if o.HashPower != nil && *o.HashPower > 0 && cfg.MiningModel == MiningUniform && cfg.AttackTrials == 0 {
+			return invalidFlag("mining_model", "node %d: hash_power overrides need -mining_model=exponential", o.NodeID)
+		}
+		if o.makesMiner() {
+			forced++
+		} else if o.barsMining() {
+			barred++
+		}
+	}
+	if forced > cfg.NumMiners {
+		return invalidFlag("miners", "node overrides make %d nodes miners but there are only %d miners", forced, cfg.NumMiners)
+	}
+	if cfg.NumMiners > cfg.NumNodes-barred {
+		return invalidFlag("miners", "%d miners do not fit in the %d nodes that node overrides allow to mine", cfg.NumMiners, cfg.NumNodes-barred)
+	}
+	return nil
+}
+
+// index returns the position of the named region in the table.
+func (t *RegionTable) index(name string) (int, error) {
+	if t == nil {
+		return 0, fmt.Errorf("region %q needs nodes placed in regions (-regions)", name)
+	}
+	for i, n := range t.Names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown region %q (regions are %s)", name, strings.Join(t.Names, ", "))
+}
+
+// chooseMiners picks the mining nodes: every node an override makes a miner,
+// then the lowest-ranked other nodes not barred from mining until there are
+// NumMiners. rank is a random permutation of the node IDs.
+func (s *Simulation) chooseMiners(rank []int) ([]bool, error) {
+	isMiner := make([]bool, s.Cfg.NumNodes)
+	barred := make([]bool, s.Cfg.NumNodes)
+	count := 0
+	for _, o := range s.Cfg.NodeOverrides {
+		if o.makesMiner() {
+			isMiner[o.NodeID] = true
+			count++
+		} else if o.barsMining() {
+			barred[o.NodeID] = true
+		}
+	}
+	if count > s.Cfg.NumMiners {
+		return nil, fmt.Errorf("node overrides make %d nodes miners but there are only %d miners", count, s.Cfg.NumMiners)
+	}
+	byRank := make([]int, len(rank))
+	for id, r := range rank {
+		byRank[r] = id
+	}
+	for _, id := range byRank {
+		if count == s.Cfg.NumMiners {
+			break
+		}
+		if !isMiner[id] && !barred[id] {
+			isMiner[id] = true
+			count++
+		}
+	}
+	return isMiner, nil
+}
+
+// applyNodeOverride sets the node's bandwidth, link reliability and region
+// from its override.
+func (s *Simulation) applyNodeOverride(node *Node, o NodeOverride) error {
+	if o.UploadMbps != nil {
+		node.UploadMbps = *o.UploadMbps
+	}
+	if o.DownloadMbps != nil {
+		node.DownloadMbps = *o.DownloadMbps
+	}
+	if o.PacketLoss != nil {
+		node.PacketLoss = *o.PacketLoss
+	}
+	if o.PacketDuplication != nil {
+		node.PacketDuplication = *o.PacketDuplication
+	}
+	if o.Region != "" {
+		region, err := s.Regions.index(o.Region)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", node.ID, err)
+		}
+		node.Region = region
+	}
+	return nil
+}
+
+// applyStrategyOverrides gives miners the strategy their override names,
+// taking precedence over -miner_strategy and -selfish_miners.
+func (s *Simulation) applyStrategyOverrides() error {
+	selfish := false
+	for _, o := range s.Cfg.NodeOverrides {
+		if o.Strategy == "" {
+			continue
+		}
+		strategy, err := NewMinerStrategy(o.Strategy, s.Cfg)
+		if err != nil {
+			return fmt.Errorf("node %d: %w", o.NodeID, err)
+		}
+		s.Nodes[o.NodeID].Strategy = strategy
+		selfish = selfish || o.Strategy == StrategySelfish
+	}
+	if selfish {
+		s.pickReferenceNode()
+	}
+	return nil
+}
+
+// fixHashShares gives every miner with a hash_power override exactly that
+// share of the hash rate and scales the other miners' shares to fill the
+// rest. If no other miner has hash power, the fixed shares are scaled to sum
+// to 1.
+func fixHashShares(overrides []NodeOverride, shares map[int]float64) (map[int]float64, error) {
+	fixed := make(map[int]float64)
+	fixedTotal := 0.0
+	for _, o := range overrides {
+		if _, miner := shares[o.NodeID]; miner && o.HashPower != nil {
+			fixed[o.NodeID] = *o.HashPower
+			fixedTotal += *o.HashPower
+		}
+	}
+	if len(fixed) == 0 {
+		return shares, nil
+	}
+	restTotal := 0.0
+	for id, share := range shares {
+		if _, ok := fixed[id]; !ok {
+			restTotal += share
+		}
+	}
+	if restTotal > 0 && fixedTotal >= 1 {
+		return nil, fmt.Errorf("hash power overrides add up to %g, leaving nothing for the other miners", fixedTotal)
+	}
+	for id := range shares {
+		share, ok := fixed[id]
+		switch {
+		case ok && restTotal > 0:
+			shares[id] = share
+		case ok:
+			shares[id] = share / fixedTotal
+		case restTotal > 0:
+			shares[id] *= (1 - fixedTotal) / restTotal
+		}
+	}
+	return shares, nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PartitionDrop = "drop"
+	PartitionHold = "hold"
+)
+
+// PartitionChange splits the network into Groups at At, or heals it when
+// Groups is nil.
+type PartitionChange struct {
+	At     time.Duration
+	Groups [][]int
+}
+
+// ParsePartitionSchedule parses "1h:0-9,3h:heal" style schedules. A partition
+// lists groups separated by '|', each group a '+'-joined list of node IDs or
+// ranges, e.g. "1h:0-4+10-14|5-9". Nodes not listed form one more group, so
+// "1h:0-9" cuts nodes 0-9 off from the rest.
+func ParsePartitionSchedule(spec string, numNodes int) ([]PartitionChange, error) {
+	changes := []PartitionChange{}
+	if strings.TrimSpace(spec) == "" {
+		return changes, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid partition change %q (expected <time>:<groups> or <time>:heal)", entry)
+		}
+		at, err := time.ParseDuration(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid partition time %q: %w", parts[0], err)
+		}
+		if parts[1] == "heal" {
+			changes = append(changes, PartitionChange{At: at})
+			continue
+		}
+		groups, err := parsePartitionGroups(parts[1], numNodes)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, PartitionChange{At: at, Groups: groups})
+	}
+	return changes, nil
+}
+
+func parsePartitionGroups(spec string, numNodes int) ([][]int, error) {
+	assigned := make([]bool, numNodes)
+	groups := [][]int{}
+	for _, groupSpec := range strings.Split(spec, "|") {
+		group, err := parseNodeRanges(groupSpec, numNodes)
+		if err != nil {
+			return nil, fmt.Errorf("%w in partition %q", err, spec)
+		}
+		for _, id := range group {
+			if assigned[id] {
+				return nil, fmt.Errorf("node %d is in more than one group of partition %q", id, spec)
+			}
+			assigned[id] = true
+		}
+		groups = append(groups, group)
+	}
+	rest := []int{}
+	for id, ok := range assigned {
+		if !ok {
+			rest = append(rest, id)
+		}
+	}
+	if len(rest) > 0 {
+		groups = append(groups, rest)
+	}
+	if len(groups) < 2 {
+		return nil, fmt.Errorf("partition %q leaves every node in one group", spec)
+	}
+	return groups, nil
+}
+
+// parseNodeRanges parses node IDs and inclusive ranges joined by '+', such as
+// "0-9+15".
+func parseNodeRanges(spec string, numNodes int) ([]int, error) {
+	ids := []int{}
+	for _, item := range strings.Split(spec, "+") {
+		first, last := item, item
+		if dash := strings.Index(item, "-"); dash >= 0 {
+			first, last = item[:dash], item[dash+1:]
+		}
+		from, err1 := strconv.Atoi(first)
+		to, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || from < 0 || to < from || to >= numNodes {
+			return nil, fmt.Errorf("invalid node range %q (nodes are 0..%d)", item, numNodes-1)
+		}
+		for id := from; id <= to; id++ {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// PartitionRecord describes one partition: how far each group's chain grew
+// while it was cut off, and what happened when it healed.
+type PartitionRecord struct {
+	Start        time.Time
+	End          time.Time
+	Groups       [][]int
+	StartHeights []int
+	EndHeights   []int
+	Dropped      int
+	Held         int
+	// Reorgs after the heal.
+	ReorgedNodes  int
+	MaxReorgDepth int
+	RevertedTxs   int
+}
+
+// heldMessage is a message across a partition cut, delivered on heal.
+type heldMessage struct {
+	from      *Node
+	targetID  int
+	sizeBytes int
+	et        EventType
+	data      interface{}
+}
+
+// crossesPartition reports whether a message from one node to another would
+// cross the current partition cut.
+func (s *Simulation) crossesPartition(from, to int) bool {
+	return s.partitionGroup != nil && from >= 0 && s.partitionGroup[from] != s.partitionGroup[to]
+}
+
+func (s *Simulation) handlePartitionChange(data PartitionChangeData) {
+	if s.partitionGroup != nil {
+		s.healPartition()
+	}
+	if data.Groups == nil {
+		return
+	}
+	record := &PartitionRecord{Start: s.CurrentTime, Groups: data.Groups}
+	s.partitionGroup = make([]int, len(s.Nodes))
+	for i, group := range data.Groups {
+		for _, id := range group {
+			s.partitionGroup[id] = i
+		}
+		record.StartHeights = append(record.StartHeights, s.groupHeight(group))
+	}
+	s.Partitions = append(s.Partitions, record)
+	log.Printf("T=%.3fs Network partitioned into %d groups (%s mode)\n",
+		s.CurrentTime.Sub(s.StartTime).Seconds(), len(data.Groups), s.Cfg.PartitionMode)
+}
+
+// healPartition removes the cut. Held messages are delivered; in drop mode
+// nodes instead announce their best tip to the peers they lost, which fetch
+// any missing ancestors as orphan parents, and syncing nodes ask for headers
+// again.
+func (s *Simulation) healPartition() {
+	record := s.Partitions[len(s.Partitions)-1]
+	record.End = s.CurrentTime
+	for _, group := range record.Groups {
+		record.EndHeights = append(record.EndHeights, s.groupHeight(group))
+	}
+	groupOf := s.partitionGroup
+	s.partitionGroup = nil
+	log.Printf("T=%.3fs Network partition healed after %v\n",
+		s.CurrentTime.Sub(s.StartTime).Seconds(), record.End.Sub(record.Start))
+
+	for id := 0; id < len(s.Nodes); id++ {
+		// Requests that were lost across the cut may be sent again.
+		s.Nodes[id].requested = make(map[string]bool)
+	}
+	for _, m := range s.heldMessages {
+		m.from.transmit(m.targetID, m.sizeBytes, m.et, m.data)
+	}
+	s.heldMessages = nil
+	if s.Cfg.PartitionMode != PartitionDrop {
+		return
+	}
+	for id := 0; id < len(s.Nodes); id++ {
+		node := s.Nodes[id]
+		if node.syncing != nil && !node.Offline {
+			// The getheaders or its reply may have been lost.
+			node.requestHeaders()
+		}
+		tip := node.Blocks[node.BestChainTip]
+		for _, targetID := range node.relayTargets(-1) {
+			if groupOf[targetID] != groupOf[id] {
+				node.announceBlock(targetID, *tip)
+			}
+		}
+	}
+}
+
+// groupHeight is the height of the highest tip among the group's nodes.
+func (s *Simulation) groupHeight(group []int) int {
+	height := 0
+	for _, id := range group {
+		if h := s.Nodes[id].TipHeight(); h > height {
+			height = h
+		}
+	}
+	return height
+}
+
+// recordReorg attributes a reorg to the last partition once it has healed.
+// Only reorgs that fork at or below the highest tip at the split resolve the
+// partition; ordinary forks after the heal are not counted.
+func (s *Simulation) recordReorg(ancestorHeight int, depth int, revertedTxs int) {
+	if len(s.Partitions) == 0 {
+		return
+	}
+	record := s.Partitions[len(s.Partitions)-1]
+	if record.End.IsZero() {
+		return
+	}
+	splitHeight := 0
+	for _, h := range record.StartHeights {
+		if h > splitHeight {
+			splitHeight = h
+		}
+	}
+	if ancestorHeight > splitHeight {
+		return
+	}
+	record.ReorgedNodes++
+	record.RevertedTxs += revertedTxs
+	if depth > record.MaxReorgDepth {
+		record.MaxReorgDepth = depth
+	}
+}
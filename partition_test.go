@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePartitionSchedule(t *testing.T) {
+	tests := []struct {
+		spec string
+		want []PartitionChange
+	}{
+		{"", []PartitionChange{}},
+		{"1h:0-4,3h:heal", []PartitionChange{
+			{At: time.Hour, Groups: [][]int{{0, 1, 2, 3, 4}, {5, 6, 7, 8, 9}}},
+			{At: 3 * time.Hour},
+		}},
+		{"30m:0-1+8|2-3", []PartitionChange{
+			{At: 30 * time.Minute, Groups: [][]int{{0, 1, 8}, {2, 3}, {4, 5, 6, 7, 9}}},
+		}},
+		{"0s:0-4|5-9", []PartitionChange{
+			{At: 0, Groups: [][]int{{0, 1, 2, 3, 4}, {5, 6, 7, 8, 9}}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := ParsePartitionSchedule(tt.spec, 10)
+		if err != nil {
+			t.Errorf("ParsePartitionSchedule(%q): %v", tt.spec, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ParsePartitionSchedule(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParsePartitionScheduleErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"1h", "expected <time>:<groups>"},
+		{"1x:0-4", "invalid partition time"},
+		{"1h:0-10", `invalid node range "0-10" (nodes are 0..9)`},
+		{"1h:4-2", `invalid node range "4-2"`},
+		{"1h:a", `invalid node range "a"`},
+		{"1h:0-4|3-6", "node 3 is in more than one group"},
+		{"1h:0-9", "leaves every node in one group"},
+		{"1h:0-4,2h:heal,3h:", "invalid node range"},
+	}
+	for _, tt := range tests {
+		_, err := ParsePartitionSchedule(tt.spec, 10)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParsePartitionSchedule(%q) error = %v, want it to mention %q", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRecordReorgOnlyCountsForksBeforeTheSplit(t *testing.T) {
+	record := &PartitionRecord{StartHeights: []int{4, 5}, End: time.Unix(1, 0)}
+	s := &Simulation{Partitions: []*PartitionRecord{record}}
+	s.recordReorg(5, 3, 10)
+	s.recordReorg(2, 6, 20)
+	s.recordReorg(9, 1, 40)
+	if record.ReorgedNodes != 2 || record.MaxReorgDepth != 6 || record.RevertedTxs != 30 {
+		t.Errorf("after reorgs: %d nodes, depth %d, %d txs; want 2 nodes, depth 6, 30 txs",
+			record.ReorgedNodes, record.MaxReorgDepth, record.RevertedTxs)
+	}
+}
@@ -5,7 +5,12 @@ import (
 	"time"
 )
 
-func CalculateTimeToFind(cfg *Config) time.Duration {
+const (
+	MiningUniform     = "uniform"
+	MiningExponential = "exponential"
+)
+
+func CalculateTimeToFind(cfg *Config, rng *rand.Rand) time.Duration {
 	minDuration := cfg.FindTimeMin
 	maxDuration := cfg.FindTimeMax
 	minSeconds := float64(minDuration.Seconds())
@@ -14,8 +19,37 @@ func CalculateTimeToFind(cfg *Config) time.Duration {
 	if rangeSeconds <= 0 {
 		return minDuration
 	}
-	randomSecondsInAddition := rand.Float64() * rangeSeconds
+	randomSecondsInAddition := rng.Float64() * rangeSeconds
 	totalSeconds := minSeconds + randomSecondsInAddition
 	calculatedDuration := time.Duration(totalSeconds * float64(time.Second))
 	return calculatedDuration
 }
+
+// CalculateExponentialTimeToFind draws a memoryless block discovery time for a
+// miner holding hashShare of the network hash rate. Across all miners the
+// expected interval between blocks is cfg.TargetBlockInterval.
+func CalculateExponentialTimeToFind(cfg *Config, rng *rand.Rand, hashShare float64) time.Duration {
+	if hashShare <= 0 {
+		return maxDuration
+	}
+	meanSeconds := cfg.TargetBlockInterval.Seconds() / hashShare
+	seconds := rng.ExpFloat64() * meanSeconds
+	if seconds >= maxDuration.Seconds() {
+		return maxDuration
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+const maxDuration = time.Duration(1<<63 - 1)
+
+// TimeToFind draws how long minerID needs for a block of the given
+// difficulty. Times scale linearly with difficulty and inversely with the
+// current network hash rate factor.
+func (s *Simulation) TimeToFind(minerID int, difficulty float64) time.Duration {
+	if s.Cfg.MiningModel == MiningExponential {
+		effectiveShare := s.HashPower[minerID] * s.HashRateFactor / difficulty
+		return CalculateExponentialTimeToFind(s.Cfg, s.Rand.Mining, effectiveShare)
+	}
+	base := CalculateTimeToFind(s.Cfg, s.Rand.Mining)
+	return time.Duration(float64(base) * difficulty / s.HashRateFactor)
+}
@@ -0,0 +1,285 @@
+package main
+
+// Message sizes follow the Bitcoin P2P protocol: every message has a 24-byte
+// header, inventory entries are a 4-byte type plus a 32-byte hash, and a
+// headers message carries each 80-byte header plus a transaction count byte.
+const (
+	messageHeaderSize = 24
+	invEntrySize      = 36
+	headersEntrySize  = BlockHeaderSize + 1
+)
+
+const (
+	MsgTx      = "tx"
+	MsgBlock   = "block"
+	MsgInv     = "inv"
+	MsgGetData = "getdata"
+	MsgHeaders = "headers"
+
+	MsgGetHeaders = "getheaders"
+	MsgNotFound   = "notfound"
+)
+
+// messageKinds is the order messages are reported in.
+var messageKinds = []string{MsgTx, MsgBlock, MsgInv, MsgGetData, MsgHeaders, MsgGetHeaders, MsgCmpctBlock, MsgGetBlockTxn, MsgBlockTxn, MsgNotFound}
+
+type MessageStats struct {
+	Count int
+	Bytes int64
+}
+
+// send delivers a message of sizeBytes to targetID after the link delay and
+// counts it under kind. Nothing is sent between offline nodes, and messages
+// across a partition cut are dropped or held until the partition heals.
+func (n *Node) send(targetID int, kind string, sizeBytes int, et EventType, data interface{}) {
+	if n.Offline || n.Sim.Nodes[targetID].Offline {
+		return
+	}
+	stats, ok := n.Sim.Messages[kind]
+	if !ok {
+		stats = &MessageStats{}
+		n.Sim.Messages[kind] = stats
+	}
+	stats.Count++
+	stats.Bytes += int64(sizeBytes)
+
+	if n.Sim.crossesPartition(n.ID, targetID) {
+		record := n.Sim.Partitions[len(n.Sim.Partitions)-1]
+		if n.Cfg.PartitionMode == PartitionHold {
+			n.Sim.heldMessages = append(n.Sim.heldMessages, heldMessage{from: n, targetID: targetID, sizeBytes: sizeBytes, et: et, data: data})
+			record.Held++
+		} else {
+			record.Dropped++
+		}
+		return
+	}
+	n.transmit(targetID, sizeBytes, et, data)
+}
+
+func (n *Node) transmit(targetID int, sizeBytes int, et EventType, data interface{}) {
+	n.deliver(targetID, n.sendDelay(targetID, sizeBytes), et, data)
+}
+
+func inventorySize(entries int) int {
+	return messageHeaderSize + 1 + entries*invEntrySize
+}
+
+// relayTx pushes tx to every relay target, or announces it with an inv when
+// the inv protocol is in use.
+func (n *Node) relayTx(tx *Transaction, fromNodeID int) {
+	for _, targetNodeID := range n.relayTargets(fromNodeID) {
+		if n.Cfg.RelayProtocol == RelayInv {
+			n.send(targetNodeID, MsgInv, inventorySize(1), EvInv, InvData{TargetNodeID: targetNodeID, FromNodeID: n.ID, Kind: MsgTx, Hashes: []string{tx.ID}})
+		} else {
+			n.send(targetNodeID, MsgTx, messageHeaderSize+tx.Size, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: targetNodeID, FromNodeID: n.ID, Tx: tx})
+		}
+		n.Stats.RelayedTx++
+	}
+}
+
+// relayBlock pushes b (or its compact form) to every relay target, or announces its header when the
+// inv protocol is in use.
+func (n *Node) relayBlock(b Block, fromNodeID int) {
+	for _, targetNodeID := range n.relayTargets(fromNodeID) {
+		n.announceBlock(targetNodeID, b)
+		n.Stats.RelayedBlocks++
+	}
+}
+
+// announceBlock sends b's header under the inv protocol, or the block itself.
+func (n *Node) announceBlock(targetID int, b Block) {
+	if n.Cfg.RelayProtocol == RelayInv {
+		n.send(targetID, MsgHeaders, messageHeaderSize+1+headersEntrySize, EvHeaders, HeadersData{TargetNodeID: targetID, FromNodeID: n.ID, Hashes: []string{b.Hash}, Headers: []BlockHeader{b.Header}})
+		return
+	}
+	n.sendBlock(targetID, b)
+}
+
+// ReceiveInv requests the announced transactions the node has neither seen
+// nor already asked another peer for.
+func (n *Node) ReceiveInv(data InvData) {
+	wanted := []string{}
+	for _, hash := range data.Hashes {
+		if n.knowsTx(hash) || n.requested[hash] {
+			continue
+		}
+		n.requested[hash] = true
+		wanted = append(wanted, hash)
+	}
+	n.requestData(data.FromNodeID, data.Kind, wanted)
+}
+
+// ReceiveHeaders requests the announced blocks the node does not have yet. A
+// reply from the sync peer also moves the initial block download along.
+func (n *Node) ReceiveHeaders(data HeadersData) {
+	wanted := []string{}
+	for _, hash := range data.Hashes {
+		if _, known := n.Blocks[hash]; known || n.requested[hash] {
+			continue
+		}
+		n.requested[hash] = true
+		wanted = append(wanted, hash)
+	}
+	n.requestData(data.FromNodeID, MsgBlock, wanted)
+	if data.Response && n.syncing != nil && data.FromNodeID == n.syncing.peer {
+		n.continueSync(data)
+	}
+}
+
+func (n *Node) requestData(peerID int, kind string, hashes []string) {
+	n.sendGetData(peerID, kind, hashes, 0)
+}
+
+// sendGetData requests hashes from peerID; attempt counts earlier requests
+// for the same objects that timed out. Requesting a block gives up on any
+// reconstruction of it still waiting for a blocktxn reply, so the reply to
+// the request is not mistaken for a duplicate.
+func (n *Node) sendGetData(peerID int, kind string, hashes []string, attempt int) {
+	if len(hashes) == 0 {
+		return
+	}
+	if kind == MsgBlock {
+		for _, hash := range hashes {
+			delete(n.reconstructing, hash)
+		}
+	}
+	n.send(peerID, MsgGetData, inventorySize(len(hashes)), EvGetData, InvData{TargetNodeID: peerID, FromNodeID: n.ID, Kind: kind, Hashes: hashes})
+	n.armRequestTimeout(peerID, kind, hashes, attempt)
+}
+
+// ReceiveGetData answers a request with the payloads the node still has.
+// Transactions that have left the mempool since they were announced are
+// listed in a notfound reply instead.
+func (n *Node) ReceiveGetData(data InvData) {
+	notFound := []string{}
+	for _, hash := range data.Hashes {
+		switch data.Kind {
+		case MsgTx:
+			if tx, ok := n.Mempool[hash]; ok {
+				n.send(data.FromNodeID, MsgTx, messageHeaderSize+tx.Size, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: data.FromNodeID, FromNodeID: n.ID, Tx: tx})
+			} else {
+				notFound = append(notFound, hash)
+			}
+		case MsgBlock:
+			if b, ok := n.Blocks[hash]; ok {
+				n.sendBlock(data.FromNodeID, *b)
+			}
+		}
+	}
+	if len(notFound) > 0 {
+		n.send(data.FromNodeID, MsgNotFound, inventorySize(len(notFound)), EvNotFound, InvData{TargetNodeID: data.FromNodeID, FromNodeID: n.ID, Kind: MsgTx, Hashes: notFound})
+	}
+}
+
+// ReceiveNotFound forgets the requests the peer could not answer, so the next
+// announcement of those transactions fetches them from another peer.
+func (n *Node) ReceiveNotFound(data InvData) {
+	for _, hash := range data.Hashes {
+		n.answered(hash)
+		delete(n.requested, hash)
+	}
+}
+
+// BIP152 compact block sizes: a cmpctblock carries the header, an 8-byte
+// nonce and a 6-byte short ID per transaction; getblocktxn lists the indexes
+// of the missing transactions, which blocktxn returns in full.
+const (
+	shortIDSize          = 6
+	compactBlockBaseSize = messageHeaderSize + BlockHeaderSize + 8 + 1 + 1
+	blockTxnBaseSize     = messageHeaderSize + 32 + 1
+	blockTxnIndexSize    = 2
+	// maxCompactBlockDepth is how far below the tip a block may be and
+	// still be served as a compact block; older blocks go out in full.
+	maxCompactBlockDepth = 5
+)
+
+const (
+	MsgCmpctBlock  = "cmpctblock"
+	MsgGetBlockTxn = "getblocktxn"
+	MsgBlockTxn    = "blocktxn"
+)
+
+// CompactBlockStats tracks how compact blocks were reconstructed.
+type CompactBlockStats struct {
+	Received      int
+	Reconstructed int
+	RoundTrips    int
+	MissingTxs    int
+	// BytesSaved is the full block size minus everything sent instead:
+	// the cmpctblock and, when needed, getblocktxn and blocktxn.
+	BytesSaved int64
+}
+
+func compactBlockSize(b Block) int {
+	return compactBlockBaseSize + shortIDSize*len(b.Transactions)
+}
+
+// sendBlock sends b to targetID in full, or as a compact block when compact
+// block relay is on and b is near the tip.
+func (n *Node) sendBlock(targetID int, b Block) {
+	if n.Cfg.CompactBlocks && n.TipHeight()-b.Header.Height < maxCompactBlockDepth {
+		n.send(targetID, MsgCmpctBlock, compactBlockSize(b), EvCmpctBlock, CompactBlockData{TargetNodeID: targetID, FromNodeID: n.ID, Block: b})
+		return
+	}
+	n.send(targetID, MsgBlock, messageHeaderSize+b.Size(), EvReceiveBlock, ReceiveBlockData{TargetNodeID: targetID, FromNodeID: n.ID, Block: b})
+}
+
+// ReceiveCompactBlock rebuilds the block from the mempool. If transactions
+// are missing, it asks the sender for them and waits for the blocktxn reply.
+func (n *Node) ReceiveCompactBlock(data CompactBlockData) {
+	b := data.Block
+	n.answered(b.Hash)
+	size := compactBlockSize(b)
+	_, waiting := n.reconstructing[b.Hash]
+	if _, known := n.Blocks[b.Hash]; known || waiting {
+		n.Sim.RedundantBytes += int64(size)
+		return
+	}
+	stats := &n.Sim.CompactBlocks
+	stats.Received++
+	stats.BytesSaved += int64(messageHeaderSize + b.Size() - size)
+
+	missing := []string{}
+	for _, tx := range b.Transactions {
+		if _, ok := n.Mempool[tx.ID]; !ok && !n.extraTxs[tx.ID] {
+			missing = append(missing, tx.ID)
+		}
+	}
+	if len(missing) == 0 {
+		stats.Reconstructed++
+		n.ReceiveBlock(b, data.FromNodeID)
+		return
+	}
+	n.reconstructing[b.Hash] = data.FromNodeID
+	stats.RoundTrips++
+	stats.MissingTxs += len(missing)
+	requestSize := blockTxnBaseSize + blockTxnIndexSize*len(missing)
+	stats.BytesSaved -= int64(requestSize)
+	n.send(data.FromNodeID, MsgGetBlockTxn, requestSize, EvGetBlockTxn, GetBlockTxnData{TargetNodeID: data.FromNodeID, FromNodeID: n.ID, BlockHash: b.Hash, TxIDs: missing})
+	n.armRequestTimeout(data.FromNodeID, MsgGetBlockTxn, []string{b.Hash}, 0)
+}
+
+func (n *Node) ReceiveGetBlockTxn(data GetBlockTxnData) {
+	b, ok := n.Blocks[data.BlockHash]
+	if !ok {
+		return
+	}
+	wanted := make(map[string]bool, len(data.TxIDs))
+	for _, txID := range data.TxIDs {
+		wanted[txID] = true
+	}
+	size := blockTxnBaseSize
+	for _, tx := range b.Transactions {
+		if wanted[tx.ID] {
+			size += tx.Size
+		}
+	}
+	n.Sim.CompactBlocks.BytesSaved -= int64(size)
+	n.send(data.FromNodeID, MsgBlockTxn, size, EvBlockTxn, CompactBlockData{TargetNodeID: data.FromNodeID, FromNodeID: n.ID, Block: *b})
+}
+
+// ReceiveBlockTxn completes a compact block with the missing transactions.
+func (n *Node) ReceiveBlockTxn(data CompactBlockData) {
+	delete(n.reconstructing, data.Block.Hash)
+	n.ReceiveBlock(data.Block, data.FromNodeID)
+}
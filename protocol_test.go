@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// invTestSim returns a network relaying with inv/getdata.
+func invTestSim(t *testing.T, requestTimeout time.Duration) *Simulation {
+	t.Helper()
+	cfg := testConfig(3, 1)
+	cfg.RelayProtocol = RelayInv
+	cfg.RequestTimeout = requestTimeout
+	return newTestSimulation(t, cfg)
+}
+
+// requests lists the getdata messages queued as "from->to:hashes".
+func requests(sim *Simulation, et EventType) []string {
+	out := []string{}
+	for _, event := range queued(sim, et) {
+		data := event.Data.(InvData)
+		out = append(out, fmt.Sprintf("%d->%d:%v", data.FromNodeID, data.TargetNodeID, data.Hashes))
+	}
+	return out
+}
+
+func TestInvRequestsUnknownTxsOnce(t *testing.T) {
+	sim := invTestSim(t, 0)
+	n := sim.Nodes[0]
+	n.ReceiveTransaction(testTx("known", 250, 1000), -1)
+	n.ReceiveInv(InvData{TargetNodeID: 0, FromNodeID: 1, Kind: MsgTx, Hashes: []string{"known", "new"}})
+	n.ReceiveInv(InvData{TargetNodeID: 0, FromNodeID: 2, Kind: MsgTx, Hashes: []string{"new"}})
+	if got, want := fmt.Sprint(requests(sim, EvGetData)), "[0->1:[new]]"; got != want {
+		t.Errorf("getdata sent = %s, want %s", got, want)
+	}
+}
+
+func TestGetDataAnswersOrNotFound(t *testing.T) {
+	sim := invTestSim(t, 0)
+	peer := sim.Nodes[1]
+	peer.addToMempool(testTx("here", 250, 1000), true)
+	peer.ReceiveGetData(InvData{TargetNodeID: 1, FromNodeID: 0, Kind: MsgTx, Hashes: []string{"here", "gone"}})
+
+	txs := queued(sim, EvReceiveTransaction)
+	if len(txs) != 1 || txs[0].Data.(ReceiveTransactionData).Tx.ID != "here" {
+		t.Errorf("%d transactions sent, want the one still in the mempool", len(txs))
+	}
+	if got, want := fmt.Sprint(requests(sim, EvNotFound)), "[1->0:[gone]]"; got != want {
+		t.Errorf("notfound sent = %s, want %s", got, want)
+	}
+}
+
+// TestNotFoundLetsAnotherPeerServe checks that a notfound reply cancels the
+// request's timeout and lets the next announcement fetch from another peer.
+func TestNotFoundLetsAnotherPeerServe(t *testing.T) {
+	sim := invTestSim(t, 5*time.Second)
+	n := sim.Nodes[0]
+	n.ReceiveInv(InvData{TargetNodeID: 0, FromNodeID: 1, Kind: MsgTx, Hashes: []string{"tx"}})
+	if len(queued(sim, EvRequestTimeout)) != 1 {
+		t.Fatal("getdata did not arm a request timeout")
+	}
+	n.ReceiveNotFound(InvData{TargetNodeID: 0, FromNodeID: 1, Kind: MsgTx, Hashes: []string{"tx"}})
+	if n.requested["tx"] || len(queued(sim, EvRequestTimeout)) != 0 {
+		t.Errorf("after notfound: requested = %v, %d timeouts queued; want false, 0",
+			n.requested["tx"], len(queued(sim, EvRequestTimeout)))
+	}
+	n.ReceiveInv(InvData{TargetNodeID: 0, FromNodeID: 2, Kind: MsgTx, Hashes: []string{"tx"}})
+	if got, want := fmt.Sprint(requests(sim, EvGetData)), "[0->1:[tx] 0->2:[tx]]"; got != want {
+		t.Errorf("getdata sent = %s, want %s", got, want)
+	}
+}
+
+// TestTxRequestTimeoutForgetsRequest checks that an unanswered transaction
+// request is dropped, not retried, so a later inv fetches it again.
+func TestTxRequestTimeoutForgetsRequest(t *testing.T) {
+	sim := invTestSim(t, 5*time.Second)
+	n := sim.Nodes[0]
+	n.ReceiveInv(InvData{TargetNodeID: 0, FromNodeID: 1, Kind: MsgTx, Hashes: []string{"tx"}})
+	timeout := queued(sim, EvRequestTimeout)[0]
+	sim.CancelEvent(timeout)
+	n.handleRequestTimeout(timeout.Data.(RequestTimeoutData), timeout)
+	if n.requested["tx"] || len(queued(sim, EvGetData)) != 1 || sim.Links.Retries != 0 {
+		t.Errorf("after the timeout: requested = %v, %d getdata, %d retries; want false, 1, 0",
+			n.requested["tx"], len(queued(sim, EvGetData)), sim.Links.Retries)
+	}
+}
+
+// compactTestSim returns a network relaying compact blocks, and a block on
+// genesis holding txs as node 0 sees it.
+func compactTestSim(t *testing.T, requestTimeout time.Duration, txs ...Transaction) (*Simulation, Block) {
+	t.Helper()
+	cfg := testConfig(3, 1)
+	cfg.CompactBlocks = true
+	cfg.RequestTimeout = requestTimeout
+	sim := newTestSimulation(t, cfg)
+	return sim, childBlock(sim.Nodes[0], sim.GenesisBlock.Hash, 1, txs...)
+}
+
+func TestCompactBlockReconstructsFromMempoolAndExtraTxs(t *testing.T) {
+	sim, b := compactTestSim(t, 0, *testTx("pooled", 250, 1000), *testTx("rejected", 250, 1000))
+	n := sim.Nodes[0]
+	n.addToMempool(testTx("pooled", 250, 1000), true)
+	n.keepExtraTx("rejected")
+	n.ReceiveCompactBlock(CompactBlockData{TargetNodeID: 0, FromNodeID: 1, Block: b})
+	if n.BestChainTip != b.Hash {
+		t.Errorf("tip = %s, want the compact block", n.BestChainTip[:6])
+	}
+	if stats := sim.CompactBlocks; stats.Reconstructed != 1 || stats.RoundTrips != 0 || len(queued(sim, EvGetBlockTxn)) != 0 {
+		t.Errorf("%d reconstructed, %d round trips; want 1, 0", stats.Reconstructed, stats.RoundTrips)
+	}
+}
+
+func TestCompactBlockFetchesMissingTxs(t *testing.T) {
+	sim, b := compactTestSim(t, 0, *testTx("pooled", 250, 1000), *testTx("missing", 250, 1000))
+	n := sim.Nodes[0]
+	n.addToMempool(testTx("pooled", 250, 1000), true)
+	n.ReceiveCompactBlock(CompactBlockData{TargetNodeID: 0, FromNodeID: 1, Block: b})
+
+	requests := queued(sim, EvGetBlockTxn)
+	if len(requests) != 1 {
+		t.Fatalf("%d getblocktxn sent, want 1", len(requests))
+	}
+	if data := requests[0].Data.(GetBlockTxnData); data.TargetNodeID != 1 || fmt.Sprint(data.TxIDs) != "[missing]" {
+		t.Errorf("getblocktxn to %d for %v, want to 1 for [missing]", data.TargetNodeID, data.TxIDs)
+	}
+	if from, ok := n.reconstructing[b.Hash]; !ok || from != 1 || n.BestChainTip == b.Hash {
+		t.Fatal("the block is not waiting for its missing transactions")
+	}
+	// The same block again from another peer while waiting is redundant.
+	n.ReceiveCompactBlock(CompactBlockData{TargetNodeID: 0, FromNodeID: 2, Block: b})
+	if sim.CompactBlocks.Received != 1 || len(queued(sim, EvGetBlockTxn)) != 1 {
+		t.Errorf("a second cmpctblock was processed while reconstructing")
+	}
+	n.ReceiveBlockTxn(CompactBlockData{TargetNodeID: 0, FromNodeID: 1, Block: b})
+	if _, waiting := n.reconstructing[b.Hash]; waiting || n.BestChainTip != b.Hash {
+		t.Errorf("after blocktxn: waiting = %v, tip %s; want false and the block", waiting, n.BestChainTip[:6])
+	}
+}
+
+// TestBlockTxnTimeoutFetchesFullBlock checks that a blocktxn reply that
+// never arrives makes the node request the full block from another peer.
+func TestBlockTxnTimeoutFetchesFullBlock(t *testing.T) {
+	sim, b := compactTestSim(t, 5*time.Second, *testTx("missing", 250, 1000))
+	n := sim.Nodes[0]
+	n.ReceiveCompactBlock(CompactBlockData{TargetNodeID: 0, FromNodeID: 1, Block: b})
+	timeouts := queued(sim, EvRequestTimeout)
+	if len(timeouts) != 1 {
+		t.Fatalf("%d request timeouts armed, want 1", len(timeouts))
+	}
+	timeout := timeouts[0]
+	sim.CancelEvent(timeout)
+	n.handleRequestTimeout(timeout.Data.(RequestTimeoutData), timeout)
+
+	want := fmt.Sprintf("[0->2:[%s]]", b.Hash)
+	if got := fmt.Sprint(requests(sim, EvGetData)); got != want {
+		t.Errorf("getdata sent = %s, want %s", got, want)
+	}
+	if _, waiting := n.reconstructing[b.Hash]; waiting || !n.requested[b.Hash] || sim.Links.Retries != 1 {
+		t.Errorf("waiting = %v, requested = %v, %d retries; want false, true, 1", waiting, n.requested[b.Hash], sim.Links.Retries)
+	}
+}
+
+// TestPeerLostFetchesFullBlock checks that a node reconstructing from a peer
+// that goes offline asks another peer for the full block.
+func TestPeerLostFetchesFullBlock(t *testing.T) {
+	sim, b := compactTestSim(t, 0, *testTx("missing", 250, 1000))
+	n := sim.Nodes[0]
+	n.ReceiveCompactBlock(CompactBlockData{TargetNodeID: 0, FromNodeID: 1, Block: b})
+	n.peerLost(1)
+	want := fmt.Sprintf("[0->2:[%s]]", b.Hash)
+	if got := fmt.Sprint(requests(sim, EvGetData)); got != want {
+		t.Errorf("getdata sent = %s, want %s", got, want)
+	}
+	if _, waiting := n.reconstructing[b.Hash]; waiting {
+		t.Error("the block is still waiting for the lost peer's blocktxn")
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RegionsNone       = "none"
+	RegionsContinents = "continents"
+	RegionsFile       = "file"
+)
+
+// RegionTable describes where nodes live: each region's share of the nodes and
+// the one-way base latency between every pair of regions.
+type RegionTable struct {
+	Names   []string
+	Weights []float64
+	Latency [][]time.Duration
+}
+
+// continentRegions is a rough picture of the public Bitcoin network: node
+// shares by continent and one-way latencies of about half the typical RTT.
+func continentRegions() *RegionTable {
+	ms := func(rows [][]int) [][]time.Duration {
+		latency := make([][]time.Duration, len(rows))
+		for i, row := range rows {
+			latency[i] = make([]time.Duration, len(row))
+			for j, v := range row {
+				latency[i][j] = time.Duration(v) * time.Millisecond
+			}
+		}
+		return latency
+	}
+	return &RegionTable{
+		Names:   []string{"north-america", "south-america", "europe", "asia", "oceania", "africa"},
+		Weights: []float64{0.32, 0.03, 0.45, 0.14, 0.03, 0.03},
+		Latency: ms([][]int{
+			{20, 75, 45, 95, 80, 120},
+			{75, 25, 100, 160, 150, 170},
+			{45, 100, 15, 110, 140, 70},
+			{95, 160, 110, 30, 70, 140},
+			{80, 150, 140, 70, 15, 175},
+			{120, 170, 70, 140, 175, 40},
+		}),
+	}
+}
+
+// LoadRegionTable returns the region table selected by cfg.Regions, or nil
+// when nodes are not placed in regions.
+func LoadRegionTable(cfg *Config) (*RegionTable, error) {
+	switch cfg.Regions {
+	case RegionsNone:
+		return nil, nil
+	case RegionsContinents:
+		return continentRegions(), nil
+	case RegionsFile:
+		return loadLatencyMatrix(cfg.LatencyMatrixFile)
+	default:
+		return nil, fmt.Errorf("unknown regions option %q (expected %q, %q or %q)", cfg.Regions, RegionsNone, RegionsContinents, RegionsFile)
+	}
+}
+
+// loadLatencyMatrix reads a CSV latency matrix in milliseconds. The first row
+// names the regions (its first cell is ignored) and each following row is a
+// region name followed by its latency to every region, in header order. Nodes
+// are split evenly across the regions. Blank lines and lines starting with '#'
+// are ignored.
+func loadLatencyMatrix(path string) (*RegionTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening latency matrix: %w", err)
+	}
+	defer f.Close()
+
+	table := &RegionTable{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+		if table.Names == nil {
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("%s:%d: header needs at least one region", path, lineNum)
+			}
+			table.Names = fields[1:]
+			continue
+		}
+		row := len(table.Latency)
+		if row >= len(table.Names) {
+			return nil, fmt.Errorf("%s:%d: more rows than regions (%d)", path, lineNum, len(table.Names))
+		}
+		if fields[0] != table.Names[row] {
+			return nil, fmt.Errorf("%s:%d: expected row for region %q, got %q", path, lineNum, table.Names[row], fields[0])
+		}
+		if len(fields) != len(table.Names)+1 {
+			return nil, fmt.Errorf("%s:%d: expected %d latencies, got %d", path, lineNum, len(table.Names), len(fields)-1)
+		}
+		latencies := make([]time.Duration, len(table.Names))
+		for i, field := range fields[1:] {
+			ms, err := strconv.ParseFloat(field, 64)
+			if err != nil || ms < 0 {
+				return nil, fmt.Errorf("%s:%d: invalid latency %q", path, lineNum, field)
+			}
+			latencies[i] = time.Duration(ms * float64(time.Millisecond))
+		}
+		table.Latency = append(table.Latency, latencies)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading latency matrix: %w", err)
+	}
+	if len(table.Names) == 0 || len(table.Latency) != len(table.Names) {
+		return nil, fmt.Errorf("%s: expected a %d x %d latency matrix", path, len(table.Names), len(table.Names))
+	}
+	table.Weights = make([]float64, len(table.Names))
+	for i := range table.Weights {
+		table.Weights[i] = 1
+	}
+	return table, nil
+}
+
+// Assign places numNodes nodes in regions. Each region gets its weighted share
+// of the nodes, rounded by largest remainder, and the placement is shuffled so
+// that miners are not all in the first region.
+func (t *RegionTable) Assign(numNodes int, rng *rand.Rand) []int {
+	total := 0.0
+	for _, w := range t.Weights {
+		total += w
+	}
+	counts := make([]int, len(t.Weights))
+	remainders := make([]float64, len(t.Weights))
+	assigned := 0
+	for i, w := range t.Weights {
+		exact := float64(numNodes) * w / total
+		counts[i] = int(exact)
+		remainders[i] = exact - float64(counts[i])
+		assigned += counts[i]
+	}
+	order := make([]int, len(t.Weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return remainders[order[a]] > remainders[order[b]] })
+	for i := 0; assigned < numNodes; i++ {
+		counts[order[i%len(order)]]++
+		assigned++
+	}
+
+	regions := make([]int, 0, numNodes)
+	for region, count := range counts {
+		for i := 0; i < count; i++ {
+			regions = append(regions, region)
+		}
+	}
+	rng.Shuffle(len(regions), func(i, j int) { regions[i], regions[j] = regions[j], regions[i] })
+	return regions
+}
+
+// linkLatency draws the latency from one node to another: the base latency
+// between their regions plus up to LatencyJitter of it again, or the global
+// delay_min..delay_max range when nodes are not placed in regions.
+func (s *Simulation) linkLatency(from, to *Node) time.Duration {
+	if s.Regions == nil {
+		return CalculateNetworkDelay(s.Cfg, s.Rand.Network)
+	}
+	base := s.Regions.Latency[from.Region][to.Region]
+	jitter := float64(base) * s.Cfg.LatencyJitter * s.Rand.Network.Float64()
+	return base + time.Duration(jitter)
+}
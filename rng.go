@@ -0,0 +1,53 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"time"
+)
+
+// SimulationEpoch is the simulated wall-clock time of the genesis block. It is
+// fixed so that block timestamps and hashes are identical across runs.
+var SimulationEpoch = time.Date(2009, time.January, 3, 18, 15, 5, 0, time.UTC)
+
+// RandStreams holds independent random sources for each subsystem, all derived
+// from the simulation seed. Drawing more numbers from one stream (e.g. a new
+// transaction size distribution) leaves the others untouched.
+type RandStreams struct {
+	Topology   *rand.Rand
+	Network    *rand.Rand
+	Mining     *rand.Rand
+	Tx         *rand.Rand
+	ForkChoice *rand.Rand
+	Fees       *rand.Rand
+	Regions    *rand.Rand
+	Churn      *rand.Rand
+	Links      *rand.Rand
+}
+
+func NewRandStreams(seed int64) *RandStreams {
+	return &RandStreams{
+		Topology:   newSubStream(seed, "topology"),
+		Network:    newSubStream(seed, "network"),
+		Mining:     newSubStream(seed, "mining"),
+		Tx:         newSubStream(seed, "tx"),
+		ForkChoice: newSubStream(seed, "forkchoice"),
+		Fees:       newSubStream(seed, "fees"),
+		Regions:    newSubStream(seed, "regions"),
+		Churn:      newSubStream(seed, "churn"),
+		Links:      newSubStream(seed, "links"),
+	}
+}
+
+// newSubStream derives a stream seed by mixing the master seed with the stream
+// name through a splitmix64 finalizer.
+func newSubStream(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	z := uint64(seed) ^ h.Sum64()
+	z += 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+	return rand.New(rand.NewSource(int64(z)))
+}
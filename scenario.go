@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Scenario is a simulation described in a YAML or JSON file. It has four
+// optional sections:
+//
+//	config:    simulation settings, keyed by command-line flag name
+//	output:    output settings (log_file, results_json, print_chain)
+//	overrides: per-node hash power, bandwidth, region and miner strategy
+//	events:    partitions, heals, hash rate changes and transaction bursts
+//
+// Flags given on the command line take precedence over the file.
+type Scenario struct {
+	Path string
+
+	config    *yaml.Node
+	output    *yaml.Node
+	overrides *yaml.Node
+	events    *yaml.Node
+	// set maps every flag the file set to its value, so that validation
+	// errors can point at the line.
+	set map[string]*yaml.Node
+}
+
+// LoadScenario reads and parses a scenario file. JSON is read as YAML, which
+// it is a subset of.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading scenario: %w", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sc := &Scenario{Path: path, set: make(map[string]*yaml.Node)}
+	if len(doc.Content) == 0 {
+		return sc, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, sc.errorf(root, "", "expected a mapping with config, output, overrides and events sections")
+	}
+	for i := 0; i < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		kind := yaml.MappingNode
+		switch key.Value {
+		case "config":
+			sc.config = value
+		case "output":
+			sc.output = value
+		case "overrides":
+			sc.overrides, kind = value, yaml.SequenceNode
+		case "events":
+			sc.events, kind = value, yaml.SequenceNode
+		default:
+			return nil, sc.errorf(key, key.Value, "unknown section (expected config, output, overrides or events)")
+		}
+		if value.Kind != kind && !isNull(value) {
+			return nil, sc.errorf(value, key.Value, "expected a %s", kindName(kind))
+		}
+	}
+	return sc, nil
+}
+
+// Apply sets the file's config and output values through the flags in fs,
+// skipping flags that were set on the command line, and then adds its node
+// overrides and events to cfg, which must be the Config behind fs. Output
+// values are ignored when fs has no output flags.
+func (sc *Scenario) Apply(fs *flag.FlagSet, cfg *Config) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	known := flag.NewFlagSet("config", flag.ContinueOnError)
+	registerConfigFlags(known, &Config{})
+	if err := sc.applySettings(fs, "config", sc.config, known, explicit); err != nil {
+		return err
+	}
+	known = flag.NewFlagSet("output", flag.ContinueOnError)
+	registerOutputFlags(known, &OutputOptions{})
+	if err := sc.applySettings(fs, "output", sc.output, known, explicit); err != nil {
+		return err
+	}
+	if err := sc.applyOverrides(cfg); err != nil {
+		return err
+	}
+	return sc.applyEvents(cfg)
+}
+
+func (sc *Scenario) applySettings(fs *flag.FlagSet, section string, settings *yaml.Node, known *flag.FlagSet, explicit map[string]bool) error {
+	if settings == nil || isNull(settings) {
+		return nil
+	}
+	for i := 0; i < len(settings.Content); i += 2 {
+		key, value := settings.Content[i], settings.Content[i+1]
+		field := section + "." + key.Value
+		if known.Lookup(key.Value) == nil {
+			return sc.errorf(key, field, "unknown setting (settings are named like the command-line flags)")
+		}
+		if value.Kind != yaml.ScalarNode {
+			return sc.errorf(value, field, "expected a single value")
+		}
+		if fs.Lookup(key.Value) == nil || explicit[key.Value] {
+			continue
+		}
+		if err := fs.Set(key.Value, value.Value); err != nil {
+			return sc.errorf(value, field, "invalid value %q: %v", value.Value, err)
+		}
+		sc.set[key.Value] = value
+	}
+	return nil
+}
+
+// applyOverrides sets cfg.NodeOverrides from the overrides section. Entries
+// apply in order, so a later entry for the same node replaces the fields it
+// sets.
+func (sc *Scenario) applyOverrides(cfg *Config) error {
+	if sc.overrides == nil || isNull(sc.overrides) {
+		return nil
+	}
+	regions, regionsErr := LoadRegionTable(cfg)
+	merged := make(map[int]*NodeOverride)
+	for i, entry := range sc.overrides.Content {
+		prefix := fmt.Sprintf("overrides[%d]", i)
+		if entry.Kind != yaml.MappingNode {
+			return sc.errorf(entry, prefix, "expected a mapping")
+		}
+		nodes := sc.lookup(entry, "node")
+		if nodes == nil {
+			return sc.errorf(entry, prefix, "missing node (an ID or ranges such as \"0-9+15\")")
+		}
+		ids, err := parseNodeRanges(nodes.Value, cfg.NumNodes)
+		if nodes.Kind != yaml.ScalarNode || err != nil {
+			return sc.errorf(nodes, prefix+".node", "invalid node range %q (nodes are 0..%d)", nodes.Value, cfg.NumNodes-1)
+		}
+		var o NodeOverride
+		for j := 0; j < len(entry.Content); j += 2 {
+			key, value := entry.Content[j], entry.Content[j+1]
+			field := prefix + "." + key.Value
+			if key.Value != "node" && value.Kind != yaml.ScalarNode {
+				return sc.errorf(value, field, "expected a single value")
+			}
+			switch key.Value {
+			case "node":
+			case "hash_power":
+				share, err := strconv.ParseFloat(value.Value, 64)
+				if err != nil || share < 0 || share > 1 {
+					return sc.errorf(value, field, "hash power %q must be a share of the hash rate in [0, 1] (0 = not a miner)", value.Value)
+				}
+				o.HashPower = &share
+			case "upload_mbps", "download_mbps":
+				mbps, err := strconv.ParseFloat(value.Value, 64)
+				if err != nil || mbps < 0 {
+					return sc.errorf(value, field, "bandwidth %q must be non-negative (0 = unlimited)", value.Value)
+				}
+				if key.Value == "upload_mbps" {
+					o.UploadMbps = &mbps
+				} else {
+					o.DownloadMbps = &mbps
+				}
+			case "packet_loss", "packet_dup":
+				p, err := strconv.ParseFloat(value.Value, 64)
+				if err != nil || p < 0 || p >= 1 {
+					return sc.errorf(value, field, "probability %q must be in [0, 1)", value.Value)
+				}
+				if key.Value == "packet_loss" {
+					o.PacketLoss = &p
+				} else {
+					o.PacketDuplication = &p
+				}
+			case "region":
+				if regionsErr == nil {
+					if _, err := regions.index(value.Value); err != nil {
+						return sc.errorf(value, field, "%v", err)
+					}
+				}
+				o.Region = value.Value
+			case "strategy":
+				if _, err := NewMinerStrategy(value.Value, cfg); err != nil {
+					return sc.errorf(value, field, "%v", err)
+				}
+				o.Strategy = value.Value
+			default:
+				return sc.errorf(key, field, "unknown override (expected node, hash_power, upload_mbps, download_mbps, packet_loss, packet_dup, region or strategy)")
+			}
+		}
+		for _, id := range ids {
+			m, ok := merged[id]
+			if !ok {
+				m = &NodeOverride{NodeID: id}
+				merged[id] = m
+			}
+			if o.HashPower != nil {
+				m.HashPower = o.HashPower
+			}
+			if o.UploadMbps != nil {
+				m.UploadMbps = o.UploadMbps
+			}
+			if o.DownloadMbps != nil {
+				m.DownloadMbps = o.DownloadMbps
+			}
+			if o.PacketLoss != nil {
+				m.PacketLoss = o.PacketLoss
+			}
+			if o.PacketDuplication != nil {
+				m.PacketDuplication = o.PacketDuplication
+			}
+			if o.Region != "" {
+				m.Region = o.Region
+			}
+			if o.Strategy != "" {
+				m.Strategy = o.Strategy
+			}
+			if m.barsMining() && m.Strategy != "" {
+				return sc.errorf(entry, prefix, "node %d has a miner strategy but a hash power of 0", id)
+			}
+		}
+	}
+
+	cfg.NodeOverrides = cfg.NodeOverrides[:0]
+	for _, o := range merged {
+		cfg.NodeOverrides = append(cfg.NodeOverrides, *o)
+	}
+	sort.Slice(cfg.NodeOverrides, func(i, j int) bool { return cfg.NodeOverrides[i].NodeID < cfg.NodeOverrides[j].NodeID })
+	if regionsErr != nil {
+		// validateConfig reports the region setting itself.
+		return nil
+	}
+	if err := checkNodeOverrides(cfg); err != nil {
+		return sc.errorf(sc.overrides, "overrides", "%v", err)
+	}
+	return nil
+}
+
+// applyEvents appends the events section to the partition, hash rate and
+// transaction burst schedules.
+func (sc *Scenario) applyEvents(cfg *Config) error {
+	if sc.events == nil || isNull(sc.events) {
+		return nil
+	}
+	for i, entry := range sc.events.Content {
+		prefix := fmt.Sprintf("events[%d]", i)
+		if entry.Kind != yaml.MappingNode {
+			return sc.errorf(entry, prefix, "expected a mapping")
+		}
+		atNode := sc.lookup(entry, "at")
+		if atNode == nil {
+			return sc.errorf(entry, prefix, "missing at (the simulated time of the event, e.g. 2h)")
+		}
+		at, err := time.ParseDuration(atNode.Value)
+		if err != nil || at < 0 {
+			return sc.errorf(atNode, prefix+".at", "invalid time %q (expected a duration such as 90m)", atNode.Value)
+		}
+		if len(entry.Content) != 4 {
+			return sc.errorf(entry, prefix, "expected at and exactly one of partition, heal, hash_rate or tx_burst")
+		}
+		key, value := entry.Content[0], entry.Content[1]
+		if key.Value == "at" {
+			key, value = entry.Content[2], entry.Content[3]
+		}
+		field := prefix + "." + key.Value
+		switch key.Value {
+		case "partition":
+			if value.Kind != yaml.ScalarNode {
+				return sc.errorf(value, field, "expected groups of node ranges split by '|', such as \"0-9|10-19\"")
+			}
+			if _, err := parsePartitionGroups(value.Value, cfg.NumNodes); err != nil {
+				return sc.errorf(value, field, "%v", err)
+			}
+			cfg.PartitionSchedule = appendSchedule(cfg.PartitionSchedule, at, value.Value)
+		case "heal":
+			if heal, err := strconv.ParseBool(value.Value); value.Kind != yaml.ScalarNode || err != nil || !heal {
+				return sc.errorf(value, field, "expected true")
+			}
+			cfg.PartitionSchedule = appendSchedule(cfg.PartitionSchedule, at, "heal")
+		case "hash_rate":
+			multiplier, err := strconv.ParseFloat(value.Value, 64)
+			if value.Kind != yaml.ScalarNode || err != nil || multiplier <= 0 {
+				return sc.errorf(value, field, "hash rate multiplier %q must be positive", value.Value)
+			}
+			cfg.HashRateSchedule = appendSchedule(cfg.HashRateSchedule, at, value.Value)
+		case "tx_burst":
+			burst, err := sc.txBurst(value, field)
+			if err != nil {
+				return err
+			}
+			cfg.TxBurstSchedule = appendSchedule(cfg.TxBurstSchedule, at, burst)
+		default:
+			return sc.errorf(key, field, "unknown event (expected partition, heal, hash_rate or tx_burst)")
+		}
+	}
+	return nil
+}
+
+// txBurst reads a tx_burst event, {count: <n>, spread: <duration>}, in the
+// form -tx_bursts takes after the time.
+func (sc *Scenario) txBurst(value *yaml.Node, field string) (string, error) {
+	if value.Kind != yaml.MappingNode {
+		return "", sc.errorf(value, field, "expected count and an optional spread")
+	}
+	countNode := sc.lookup(value, "count")
+	if countNode == nil {
+		return "", sc.errorf(value, field, "missing count")
+	}
+	count, err := strconv.Atoi(countNode.Value)
+	if err != nil || count < 1 {
+		return "", sc.errorf(countNode, field+".count", "count %q must be a positive integer", countNode.Value)
+	}
+	spread := time.Duration(0)
+	for j := 0; j < len(value.Content); j += 2 {
+		key, v := value.Content[j], value.Content[j+1]
+		switch key.Value {
+		case "count":
+		case "spread":
+			spread, err = time.ParseDuration(v.Value)
+			if err != nil || spread < 0 {
+				return "", sc.errorf(v, field+".spread", "invalid spread %q (expected a duration such as 10m)", v.Value)
+			}
+		default:
+			return "", sc.errorf(key, field+"."+key.Value, "unknown setting (expected count or spread)")
+		}
+	}
+	return fmt.Sprintf("%d/%v", count, spread), nil
+}
+
+// locate points a validation error at the line of the scenario file that set
+// the offending flag. Other errors, and errors when no scenario was loaded,
+// are returned unchanged.
+func (sc *Scenario) locate(err error) error {
+	var configErr *ConfigError
+	if sc == nil || !errors.As(err, &configErr) {
+		return err
+	}
+	value, ok := sc.set[configErr.Flag]
+	if !ok {
+		return err
+	}
+	return sc.errorf(value, "config."+configErr.Flag, "%v", configErr.Err)
+}
+
+func (sc *Scenario) errorf(node *yaml.Node, field, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	if field != "" {
+		msg = field + ": " + msg
+	}
+	return fmt.Errorf("%s:%d:%d: %s", sc.Path, node.Line, node.Column, msg)
+}
+
+// lookup returns the value of key in a mapping node, or nil.
+func (sc *Scenario) lookup(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func appendSchedule(schedule string, at time.Duration, value string) string {
+	entry := at.String() + ":" + value
+	if strings.TrimSpace(schedule) == "" {
+		return entry
+	}
+	return schedule + "," + entry
+}
+
+func isNull(node *yaml.Node) bool {
+	return node.Kind == yaml.ScalarNode && node.Tag == "!!null"
+}
+
+func kindName(kind yaml.Kind) string {
+	if kind == yaml.SequenceNode {
+		return "list"
+	}
+	return "mapping"
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// applyScenario loads content as a scenario file and applies it over the
+// defaults and the given command-line args, then validates the result the way
+// main does.
+func applyScenario(t *testing.T, content string, args ...string) (Config, OutputOptions, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "scenario.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, out := DefaultConfig(), DefaultOutputOptions()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerConfigFlags(fs, &cfg)
+	registerOutputFlags(fs, &out)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	sc, err := LoadScenario(path)
+	if err != nil {
+		return cfg, out, err
+	}
+	if err := sc.Apply(fs, &cfg); err != nil {
+		return cfg, out, err
+	}
+	return cfg, out, sc.locate(validateConfig(&cfg))
+}
+
+func TestScenarioApply(t *testing.T) {
+	content := `
+config:
+  nodes: 30
+  miners: 6
+  duration: 3h
+  mining_model: exponential
+output:
+  results_json: results.json
+  print_chain: false
+overrides:
+  - node: 0
+    hash_power: 0.4
+  - node: "10-11"
+    upload_mbps: 1
+  - node: 10
+    download_mbps: 2
+  - node: 3
+    strategy: empty
+events:
+  - at: 1h
+    partition: "0-14"
+  - at: 90m
+    heal: true
+  - at: 2h
+    hash_rate: 0.5
+  - at: 20m
+    tx_burst: {count: 300, spread: 5m}
+`
+	cfg, out, err := applyScenario(t, content, "-miners=8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.NumNodes != 30 || cfg.SimulationDuration != 3*time.Hour || cfg.MiningModel != MiningExponential {
+		t.Errorf("config: nodes %d, duration %v, mining model %s", cfg.NumNodes, cfg.SimulationDuration, cfg.MiningModel)
+	}
+	if cfg.NumMiners != 8 {
+		t.Errorf("miners = %d, want the command line's 8", cfg.NumMiners)
+	}
+	if out.ResultsJSON != "results.json" || out.PrintChain {
+		t.Errorf("output: results_json %q, print_chain %v", out.ResultsJSON, out.PrintChain)
+	}
+	overrides := []string{}
+	for _, o := range cfg.NodeOverrides {
+		overrides = append(overrides, o.String())
+	}
+	want := []string{
+		"node 0 (hash_power=0.4)",
+		"node 3 (strategy=empty)",
+		"node 10 (upload_mbps=1, download_mbps=2)",
+		"node 11 (upload_mbps=1)",
+	}
+	if fmt.Sprint(overrides) != fmt.Sprint(want) {
+		t.Errorf("overrides = %v, want %v", overrides, want)
+	}
+	if cfg.PartitionSchedule != "1h0m0s:0-14,1h30m0s:heal" {
+		t.Errorf("partition schedule = %q", cfg.PartitionSchedule)
+	}
+	if cfg.HashRateSchedule != "2h0m0s:0.5" {
+		t.Errorf("hash rate schedule = %q", cfg.HashRateSchedule)
+	}
+	if cfg.TxBurstSchedule != "20m0s:300/5m0s" {
+		t.Errorf("tx burst schedule = %q", cfg.TxBurstSchedule)
+	}
+}
+
+func TestScenarioErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"syntax", "config: [\n", "scenario.yaml: yaml:"},
+		{"not a mapping", "- nodes\n", ":1:1: expected a mapping"},
+		{"unknown section", "network:\n  nodes: 3\n", ":1:1: network: unknown section"},
+		{"section kind", "config:\n  - nodes\n", ":2:3: config: expected a mapping"},
+		{"unknown setting", "config:\n  nodez: 3\n", ":2:3: config.nodez: unknown setting"},
+		{"invalid value", "config:\n  nodes: many\n", `:2:10: config.nodes: invalid value "many"`},
+		{"validation", "config:\n  nodes: 10\n  miners: 20\n", ":3:11: config.miners: number of miners (20) cannot exceed number of nodes (10)"},
+		{"override without node", "overrides:\n  - hash_power: 0.5\n", ":2:5: overrides[0]: missing node"},
+		{"override node range", "overrides:\n  - node: 25\n", `:2:11: overrides[0].node: invalid node range "25" (nodes are 0..19)`},
+		{"override hash power", "config:\n  mining_model: exponential\noverrides:\n  - node: 1\n    hash_power: 1.5\n", `:5:17: overrides[0].hash_power: hash power "1.5" must be`},
+		{"unknown override", "overrides:\n  - node: 1\n    color: red\n", ":3:5: overrides[0].color: unknown override"},
+		{"hash power needs exponential", "overrides:\n  - node: 1\n    hash_power: 0.5\n", ":2:3: overrides: -mining_model: node 1: hash_power overrides need -mining_model=exponential"},
+		{"event without at", "events:\n  - partition: 0-9\n", ":2:5: events[0]: missing at"},
+		{"event time", "events:\n  - at: soon\n    heal: true\n", `:2:9: events[0].at: invalid time "soon"`},
+		{"two events", "events:\n  - at: 1h\n    heal: true\n    hash_rate: 2\n", ":2:5: events[0]: expected at and exactly one of"},
+		{"partition range", "events:\n  - at: 1h\n    partition: 0-30\n", `:3:16: events[0].partition: invalid node range "0-30"`},
+		{"burst count", "events:\n  - at: 1h\n    tx_burst: {count: 0}\n", `:3:23: events[0].tx_burst.count: count "0" must be a positive integer`},
+	}
+	for _, tt := range tests {
+		_, _, err := applyScenario(t, tt.content)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoadScenarioMissingFile(t *testing.T) {
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.yaml")); err == nil || !strings.Contains(err.Error(), "reading scenario") {
+		t.Errorf("LoadScenario error = %v, want a read error", err)
+	}
+}
+
+func TestParseTxBurstSchedule(t *testing.T) {
+	bursts, err := ParseTxBurstSchedule("2h:500/10m, 5h:100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TxBurst{{At: 2 * time.Hour, Count: 500, Spread: 10 * time.Minute}, {At: 5 * time.Hour, Count: 100}}
+	if fmt.Sprint(bursts) != fmt.Sprint(want) {
+		t.Errorf("ParseTxBurstSchedule = %v, want %v", bursts, want)
+	}
+	for _, spec := range []string{"2h", "-1h:5", "2h:0", "2h:five", "2h:5/soon"} {
+		if _, err := ParseTxBurstSchedule(spec); err == nil {
+			t.Errorf("ParseTxBurstSchedule(%q) succeeded, want an error", spec)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// txIndex numbers transaction IDs in the order the simulation first sees
+// them, so each node can keep the transactions it knows in a bitset rather
+// than a map of ID strings.
+type txIndex map[string]uint32
+
+func (ix txIndex) number(id string) uint32 {
+	if num, ok := ix[id]; ok {
+		return num
+	}
+	num := uint32(len(ix))
+	ix[id] = num
+	return num
+}
+
+// seenSet is a bitset of txIndex numbers.
+type seenSet []uint64
+
+func (s seenSet) has(num uint32) bool {
+	word := int(num / 64)
+	return word < len(s) && s[word]&(1<<(num%64)) != 0
+}
+
+func (s *seenSet) add(num uint32) {
+	word := int(num / 64)
+	for word >= len(*s) {
+		*s = append(*s, 0)
+	}
+	(*s)[word] |= 1 << (num % 64)
+}
+
+func (s seenSet) remove(num uint32) {
+	if word := int(num / 64); word < len(s) {
+		s[word] &^= 1 << (num % 64)
+	}
+}
+
+// knowsTx reports whether the node has seen the transaction.
+func (n *Node) knowsTx(id string) bool {
+	num, ok := n.Sim.txIndex[id]
+	return ok && n.knownTx.has(num)
+}
+
+func (n *Node) markTxKnown(id string) {
+	n.knownTx.add(n.Sim.txIndex.number(id))
+}
+
+// forgetTx lets the node accept the transaction again when it is next
+// relayed.
+func (n *Node) forgetTx(id string) {
+	if num, ok := n.Sim.txIndex[id]; ok {
+		n.knownTx.remove(num)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import "log"
+
+// SelfishStrategy implements the Eyal–Sirer selfish mining state machine.
+// Found blocks are kept on a private branch and released only to override or
+// tie the honest chain. When to mine and what to include follow the honest
+// rules.
+type SelfishStrategy struct {
+	*HonestStrategy
+
+	// withheld holds private blocks that have not been published yet, oldest
+	// first.
+	withheld         []Block
+	privateBranchLen int
+	privateHeight    int
+	publicHeight     int
+
+	BlocksFound     int
+	BlocksPublished int
+}
+
+func NewSelfishStrategy(honest *HonestStrategy) *SelfishStrategy {
+	return &SelfishStrategy{HonestStrategy: honest}
+}
+
+func (sm *SelfishStrategy) Name() string { return StrategySelfish }
+
+// OnBlockFound keeps the block on the private branch instead of relaying it.
+// The attacker's best tip is its private tip, since the fork choice never lets
+// it switch to an equal-work honest branch.
+func (sm *SelfishStrategy) OnBlockFound(n *Node, b Block) {
+	deltaPrev := sm.privateHeight - sm.publicHeight
+
+	accepted, tipChanged := n.acceptBlock(b)
+	if !accepted {
+		return
+	}
+	sm.BlocksFound++
+	sm.withheld = append(sm.withheld, b)
+	sm.privateBranchLen++
+	sm.privateHeight = b.Header.Height
+
+	if deltaPrev == 0 && sm.privateBranchLen == 2 {
+		// Won the race from a tie: publish the whole branch.
+		sm.publishAll(n)
+		sm.privateBranchLen = 0
+	}
+	if tipChanged {
+		n.restartMining()
+	}
+}
+
+func (sm *SelfishStrategy) OnBlockReceived(n *Node, b Block) {
+	if b.Header.Height <= sm.publicHeight {
+		return
+	}
+	deltaPrev := sm.privateHeight - sm.publicHeight
+	sm.publicHeight = b.Header.Height
+
+	switch {
+	case deltaPrev <= 0:
+		// The honest chain is ahead: give up the private branch.
+		sm.withheld = nil
+		sm.privateBranchLen = 0
+		sm.privateHeight = sm.publicHeight
+	case deltaPrev == 1:
+		// Match the honest block and race.
+		sm.publishAll(n)
+	case deltaPrev == 2:
+		// Override the honest chain with the longer private one.
+		sm.publishAll(n)
+		sm.privateBranchLen = 0
+	default:
+		sm.publishNext(n)
+	}
+}
+
+func (sm *SelfishStrategy) publishAll(n *Node) {
+	for len(sm.withheld) > 0 {
+		sm.publishNext(n)
+	}
+}
+
+func (sm *SelfishStrategy) publishNext(n *Node) {
+	if len(sm.withheld) == 0 {
+		return
+	}
+	b := sm.withheld[0]
+	sm.withheld = sm.withheld[1:]
+	sm.BlocksPublished++
+	if b.Header.Height > sm.publicHeight {
+		sm.publicHeight = b.Header.Height
+	}
+	log.Printf("T=%.3fs Node %d: Selfish miner publishes block %s (H=%d, %d still withheld)\n",
+		n.Sim.CurrentTime.Sub(n.Sim.StartTime).Seconds(), n.ID, b.Hash[:6], b.Header.Height, len(sm.withheld))
+	n.relayBlock(b, -1)
+}
+
+// SelfishRevenueShare is Eyal and Sirer's closed-form relative revenue of a
+// selfish pool with hash share alpha and tie propagation gamma.
+func SelfishRevenueShare(alpha, gamma float64) float64 {
+	numerator := alpha*(1-alpha)*(1-alpha)*(4*alpha+gamma*(1-2*alpha)) - alpha*alpha*alpha
+	denominator := 1 - alpha*(1+(2-alpha)*alpha)
+	if denominator <= 0 {
+		return 1
+	}
+	return numerator / denominator
+}
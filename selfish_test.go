@@ -0,0 +1,86 @@
+package main
+
+import "testing"
+
+// selfishTestSim returns a network whose first miner is a selfish attacker,
+// and the attacker's node, strategy and an honest miner's ID.
+func selfishTestSim(t *testing.T, gamma float64) (*Simulation, *Node, *SelfishStrategy, int) {
+	t.Helper()
+	cfg := testConfig(4, 2)
+	cfg.SelfishMiners = 1
+	cfg.SelfishGamma = gamma
+	sim := newTestSimulation(t, cfg)
+	attacker := sim.Nodes[sim.MinerIDs[0]]
+	return sim, attacker, attacker.Strategy.(*SelfishStrategy), sim.MinerIDs[1]
+}
+
+func TestSelfishMiningStates(t *testing.T) {
+	tests := []struct {
+		name          string
+		lead          int // private blocks found before the honest block
+		wantPublished int
+		wantWithheld  int
+		wantTip       string // "private" or "honest"
+	}{
+		{"honest ahead: adopt", 0, 0, 0, "honest"},
+		{"lead 1: publish and race", 1, 1, 0, "private"},
+		{"lead 2: override", 2, 2, 0, "private"},
+		{"lead 3: publish one", 3, 1, 2, "private"},
+	}
+	for _, tt := range tests {
+		sim, attacker, sm, honestID := selfishTestSim(t, 0)
+		genesis := sim.GenesisBlock.Hash
+		tip := genesis
+		for i := 0; i < tt.lead; i++ {
+			b := childBlock(attacker, tip, attacker.ID)
+			sm.OnBlockFound(attacker, b)
+			tip = b.Hash
+		}
+		if sm.BlocksPublished != 0 || len(sm.withheld) != tt.lead {
+			t.Fatalf("%s: before the honest block: %d published, %d withheld", tt.name, sm.BlocksPublished, len(sm.withheld))
+		}
+		attacker.ReceiveBlock(childBlock(attacker, genesis, honestID), honestID)
+		if sm.BlocksPublished != tt.wantPublished || len(sm.withheld) != tt.wantWithheld {
+			t.Errorf("%s: %d published, %d withheld; want %d, %d",
+				tt.name, sm.BlocksPublished, len(sm.withheld), tt.wantPublished, tt.wantWithheld)
+		}
+		if onPrivate := attacker.BestChainTip == tip && tip != genesis; onPrivate != (tt.wantTip == "private") {
+			t.Errorf("%s: attacker tip %s, want its %s branch", tt.name, attacker.BestChainTip[:6], tt.wantTip)
+		}
+	}
+}
+
+// TestSelfishMinerWinsRaceFromTie checks that a block found during a tie is
+// published at once together with the rest of the branch.
+func TestSelfishMinerWinsRaceFromTie(t *testing.T) {
+	sim, attacker, sm, honestID := selfishTestSim(t, 0)
+	genesis := sim.GenesisBlock.Hash
+	a1 := childBlock(attacker, genesis, attacker.ID)
+	sm.OnBlockFound(attacker, a1)
+	attacker.ReceiveBlock(childBlock(attacker, genesis, honestID), honestID)
+	sm.OnBlockFound(attacker, childBlock(attacker, a1.Hash, attacker.ID))
+	if sm.BlocksPublished != 2 || len(sm.withheld) != 0 || sm.privateBranchLen != 0 {
+		t.Errorf("%d published, %d withheld, branch %d; want 2, 0, 0", sm.BlocksPublished, len(sm.withheld), sm.privateBranchLen)
+	}
+}
+
+// TestHonestNodesSideWithAttackerByGamma checks the tie rule between an
+// attacker block and an honest one at the extremes of gamma.
+func TestHonestNodesSideWithAttackerByGamma(t *testing.T) {
+	for _, gamma := range []float64{0, 1} {
+		sim, attacker, _, honestID := selfishTestSim(t, gamma)
+		observer := sim.Nodes[honestID]
+		genesis := sim.GenesisBlock.Hash
+		honestBlock := childBlock(observer, genesis, honestID)
+		attackerBlock := childBlock(observer, genesis, attacker.ID)
+		observer.ReceiveBlock(honestBlock, -1)
+		observer.ReceiveBlock(attackerBlock, attacker.ID)
+		wantTip := honestBlock.Hash
+		if gamma == 1 {
+			wantTip = attackerBlock.Hash
+		}
+		if observer.BestChainTip != wantTip {
+			t.Errorf("gamma %v: honest node on %s, want %s", gamma, observer.BestChainTip[:6], wantTip[:6])
+		}
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"container/heap"
 	"fmt"
 	"log"
-	"math/rand"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -15,6 +15,7 @@ type TxMetadata struct {
 	ConfirmedTime   time.Time
 	IncludedInBlock string
 	IsConfirmed     bool
+	FeeRate         float64
 }
 
 type Simulation struct {
@@ -25,19 +26,67 @@ type Simulation struct {
 	StartTime        time.Time
 	GlobalStaleCount int
 	MinerIDs         []int
+	HashPower        map[int]float64
+	HashRateFactor   float64
+	Difficulty       DifficultyAdjuster
 	TxSource         *SimpleTxSource
 	AllInputTxHashes map[string]bool
 	TxStatus         map[string]*TxMetadata
 	ProcessedTxCount int
 	GenesisBlock     Block
+	ReferenceNodeID  int
+	Confirmations    *ConfirmationTracker
+	Rand             *RandStreams
+	// Regions is nil unless nodes are placed in regions.
+	Regions *RegionTable
+	// DoubleSpends maps each injected transaction that was double spent to
+	// its conflicting twin.
+	DoubleSpends map[string]string
+	// Attacker is set when the run is a double-spend attack trial.
+	Attacker *DoubleSpendStrategy
+	// BlockPropagation50 and BlockPropagation90 hold, per block, the time
+	// from being found until half and 90% of the nodes had it.
+	BlockPropagation50 []time.Duration
+	BlockPropagation90 []time.Duration
+	blockArrivals      map[string]int
+	// Messages counts every message sent by kind, and RedundantBytes the
+	// tx and block payloads that arrived at a node that already had them.
+	Messages       map[string]*MessageStats
+	RedundantBytes int64
+	CompactBlocks  CompactBlockStats
+	// Partitions records every scheduled partition in order.
+	Partitions     []*PartitionRecord
+	partitionGroup []int
+	heldMessages   []heldMessage
+	// Syncs records every initial block download by a late joiner or a
+	// restarted node.
+	Syncs       []*SyncRecord
+	Crashes     int
+	Restarts    int
+	lateJoiners []int
+	// Links counts lost and duplicated messages and request retries.
+	Links LinkStats
+	// EventCount is the number of events dispatched so far.
+	EventCount int
+	blockStore blockStore
+	txIndex    txIndex
+	eventSeq   uint64
+	// freeEvents holds dispatched message events for reuse.
+	freeEvents []*Event
+	stopNote   string
 }
 
 func NewSimulation(cfg Config) *Simulation {
-	genesisTime := time.Now()
+	genesisTime := SimulationEpoch
+	streams := NewRandStreams(cfg.Seed)
 	genesis := Block{
-		Header:       BlockHeader{Height: 0, Timestamp: genesisTime, PrevHash: strings.Repeat("0", 64), MinerID: -1, NumTx: 0},
+		Header:       BlockHeader{Height: 0, Timestamp: genesisTime, PrevHash: strings.Repeat("0", 64), MinerID: -1, NumTx: 0, Difficulty: GenesisDifficulty},
 		Transactions: []Transaction{},
 	}
+	if cfg.TxModel == TxModelUTXO {
+		genesis.Transactions = append(genesis.Transactions, genesisFundingTx(&cfg, genesisTime))
+		genesis.Header.NumTx = len(genesis.Transactions)
+	}
 	genesis.Hash = genesis.CalculateHash()
 	genesis.FoundTime = genesisTime
 
@@ -49,12 +98,25 @@ func NewSimulation(cfg Config) *Simulation {
 		CurrentTime:      genesisTime,
 		GlobalStaleCount: 0,
 		MinerIDs:         make([]int, 0),
+		HashPower:        make(map[int]float64),
+		HashRateFactor:   1.0,
 		AllInputTxHashes: make(map[string]bool),
 		TxStatus:         make(map[string]*TxMetadata),
-		TxSource:         NewSimpleTxSource(&cfg, genesisTime),
+		TxSource:         NewSimpleTxSource(&cfg, genesisTime, streams.Tx, streams.Fees),
 		GenesisBlock:     genesis,
 		ProcessedTxCount: 0,
+		ReferenceNodeID:  0,
+		Rand:             streams,
+		DoubleSpends:     make(map[string]string),
+		blockArrivals:    make(map[string]int),
+		blockStore:       make(blockStore),
+		txIndex:          make(txIndex),
+		Messages:         make(map[string]*MessageStats),
+	}
+	for _, tx := range genesis.Transactions {
+		sim.TxSource.AddSpendable(tx)
 	}
+	sim.Confirmations = NewConfirmationTracker(sim, cfg.ConfirmDepth)
 	heap.Init(&sim.EventQueue)
 	return sim
 }
@@ -64,60 +126,227 @@ func (s *Simulation) ScheduleEvent(t time.Time, et EventType, data interface{})
 }
 
 func (s *Simulation) ScheduleEventWithPriority(t time.Time, et EventType, data interface{}, priority int) {
-	event := &Event{Timestamp: t, Type: et, Data: data, Priority: priority}
+	var event *Event
+	if last := len(s.freeEvents) - 1; last >= 0 {
+		event = s.freeEvents[last]
+		s.freeEvents = s.freeEvents[:last]
+		*event = Event{}
+	} else {
+		event = &Event{}
+	}
+	event.Timestamp, event.Type, event.Data, event.Priority = t, et, data, priority
+	s.PushEvent(event)
+}
+
+// recycleEvent returns a dispatched message event to the free list. Mining
+// jobs and request timeouts are not recycled because nodes keep pointers to
+// them for cancellation.
+func (s *Simulation) recycleEvent(event *Event) {
+	switch event.Type {
+	case EvReceiveTransaction, EvReceiveBlock, EvInv, EvGetData, EvHeaders,
+		EvCmpctBlock, EvGetBlockTxn, EvBlockTxn, EvGetHeaders, EvNotFound:
+		event.Data = nil
+		s.freeEvents = append(s.freeEvents, event)
+	}
+}
+
+// PushEvent stamps the event with an insertion sequence number, so events with
+// equal timestamp and priority pop in the order they were scheduled.
+func (s *Simulation) PushEvent(event *Event) {
+	s.eventSeq++
+	event.seq = s.eventSeq
 	heap.Push(&s.EventQueue, event)
 }
 
+// CancelEvent removes a pending event from the queue. It reports false if
+// the event is nil or no longer queued.
+func (s *Simulation) CancelEvent(event *Event) bool {
+	if event == nil || event.index < 0 || event.index >= len(s.EventQueue) || s.EventQueue[event.index] != event {
+		return false
+	}
+	heap.Remove(&s.EventQueue, event.index)
+	return true
+}
+
+// Stop ends the run after the current event.
+func (s *Simulation) Stop(reason string) {
+	s.stopNote = reason
+}
+
 func (s *Simulation) IncrementStaleCounterBy(count int) {
 	s.GlobalStaleCount += count
 }
 
-func (s *Simulation) Setup() {
+func (s *Simulation) Setup() error {
 	log.Println("Setting up simulation...")
-	minerCount := 0
-	nodeIDs := rand.Perm(s.Cfg.NumNodes)
-	for i := 0; i < s.Cfg.NumNodes; i++ {
-		nodeID := i
-		isMiner := false
-		isMinerCandidate := false
-		originalIndex := nodeIDs[i]
-		if originalIndex < s.Cfg.NumMiners {
-			isMinerCandidate = true
-		}
-		if isMinerCandidate && minerCount < s.Cfg.NumMiners {
-			isMiner = true
+	adjuster, err := NewDifficultyAdjuster(s.Cfg)
+	if err != nil {
+		return err
+	}
+	s.Difficulty = adjuster
+	s.Regions, err = LoadRegionTable(s.Cfg)
+	if err != nil {
+		return err
+	}
+	var nodeRegions []int
+	if s.Regions != nil {
+		nodeRegions = s.Regions.Assign(s.Cfg.NumNodes, s.Rand.Regions)
+	}
+	isMiner, err := s.chooseMiners(s.Rand.Topology.Perm(s.Cfg.NumNodes))
+	if err != nil {
+		return err
+	}
+	overrides := make(map[int]NodeOverride, len(s.Cfg.NodeOverrides))
+	for _, o := range s.Cfg.NodeOverrides {
+		overrides[o.NodeID] = o
+	}
+	for nodeID := 0; nodeID < s.Cfg.NumNodes; nodeID++ {
+		if isMiner[nodeID] {
 			s.MinerIDs = append(s.MinerIDs, nodeID)
-			minerCount++
 		}
 
-		s.Nodes[nodeID] = NewNode(nodeID, isMiner, s, s.Cfg)
+		node := NewNode(nodeID, isMiner[nodeID], s, s.Cfg)
+		if s.Regions != nil {
+			node.Region = nodeRegions[nodeID]
+		}
+		if o, ok := overrides[nodeID]; ok {
+			if err := s.applyNodeOverride(node, o); err != nil {
+				return err
+			}
+		}
+		ledger, err := NewLedger(s.Cfg.TxModel, node)
+		if err != nil {
+			return err
+		}
+		if err := ledger.ConnectBlock(s.GenesisBlock); err != nil {
+			return fmt.Errorf("connecting genesis block: %w", err)
+		}
+		node.Ledger = ledger
+		s.Nodes[nodeID] = node
 	}
 
-	for i := 0; i < s.Cfg.NumNodes; i++ {
-		numPeersToAttempt := 3 + rand.Intn(3)
-		peersConnected := 0
-		attemptCounter := 0
-		for peersConnected < numPeersToAttempt && len(s.Nodes[i].Peers) < s.Cfg.NumNodes-1 {
-			peerID := rand.Intn(s.Cfg.NumNodes)
-			if peerID != i && !contains(s.Nodes[i].Peers, peerID) {
-				s.Nodes[i].AddPeer(peerID)
-				if !contains(s.Nodes[peerID].Peers, i) {
-					s.Nodes[peerID].AddPeer(i)
-				}
-				peersConnected++
-			}
-			attemptCounter++
-			if attemptCounter > s.Cfg.NumNodes*2 {
-				break
-			}
+	if len(s.MinerIDs) > 0 {
+		s.HashPower, err = AssignHashPower(s.Cfg, s.MinerIDs)
+		if err != nil {
+			return fmt.Errorf("assigning hash power: %w", err)
 		}
 	}
+	for _, minerID := range s.MinerIDs {
+		strategy, err := NewMinerStrategy(s.Cfg.MinerStrategy, s.Cfg)
+		if err != nil {
+			return err
+		}
+		s.Nodes[minerID].Strategy = strategy
+	}
+	if err := s.setupSelfishMiners(); err != nil {
+		return err
+	}
+	if err := s.applyStrategyOverrides(); err != nil {
+		return err
+	}
+	if err := s.setupDoubleSpendAttack(); err != nil {
+		return err
+	}
+	if err := s.setupLateJoiners(); err != nil {
+		return err
+	}
+	for _, minerID := range s.MinerIDs {
+		log.Printf("Miner %d: hash power share %.2f%%\n", minerID, s.HashPower[minerID]*100)
+	}
+
+	if err := s.buildTopology(); err != nil {
+		return fmt.Errorf("building peer graph: %w", err)
+	}
 	log.Printf("Created %d nodes (%d miners), connected peers.\n", s.Cfg.NumNodes, s.Cfg.NumMiners)
+	return nil
+}
+
+// setupSelfishMiners turns the first SelfishMiners miners into attackers.
+// If SelfishHashShare is set, the attackers split that share evenly and the
+// honest miners' shares are scaled to fill the rest.
+func (s *Simulation) setupSelfishMiners() error {
+	if s.Cfg.SelfishMiners <= 0 {
+		return nil
+	}
+	if s.Cfg.SelfishMiners > len(s.MinerIDs) {
+		return fmt.Errorf("selfish miners (%d) cannot exceed miners (%d)", s.Cfg.SelfishMiners, len(s.MinerIDs))
+	}
+	attackers := s.MinerIDs[:s.Cfg.SelfishMiners]
+	for _, minerID := range attackers {
+		strategy, err := NewMinerStrategy(StrategySelfish, s.Cfg)
+		if err != nil {
+			return err
+		}
+		s.Nodes[minerID].Strategy = strategy
+	}
+
+	if s.Cfg.SelfishHashShare > 0 {
+		honestTotal := 0.0
+		for _, minerID := range s.MinerIDs[s.Cfg.SelfishMiners:] {
+			honestTotal += s.HashPower[minerID]
+		}
+		for _, minerID := range s.MinerIDs {
+			if s.IsSelfish(minerID) {
+				s.HashPower[minerID] = s.Cfg.SelfishHashShare / float64(len(attackers))
+			} else if honestTotal > 0 {
+				s.HashPower[minerID] *= (1 - s.Cfg.SelfishHashShare) / honestTotal
+			}
+		}
+	}
+
+	s.pickReferenceNode()
+	log.Printf("Selfish miners: %v (gamma %.2f), reference node: %d\n", attackers, s.Cfg.SelfishGamma, s.ReferenceNodeID)
+	return nil
+}
+
+// pickReferenceNode makes the first honest node the reference node: metrics
+// are read from an honest node's view of the chain.
+func (s *Simulation) pickReferenceNode() {
+	for id := 0; id < len(s.Nodes); id++ {
+		if !s.IsSelfish(id) {
+			s.ReferenceNodeID = id
+			return
+		}
+	}
+}
+
+func (s *Simulation) IsSelfish(nodeID int) bool {
+	node, ok := s.Nodes[nodeID]
+	if !ok {
+		return false
+	}
+	_, selfish := node.Strategy.(*SelfishStrategy)
+	return selfish
 }
 
-func (s *Simulation) Run() {
+func (s *Simulation) Run() error {
 	log.Println("Starting simulation run...")
-	s.Setup()
+	if err := s.Setup(); err != nil {
+		return err
+	}
+
+	hashRateChanges, err := ParseHashRateSchedule(s.Cfg.HashRateSchedule)
+	if err != nil {
+		return err
+	}
+	for _, change := range hashRateChanges {
+		s.ScheduleEvent(s.StartTime.Add(change.At), EvHashRateChange, HashRateChangeData{Multiplier: change.Multiplier})
+	}
+	partitionChanges, err := ParsePartitionSchedule(s.Cfg.PartitionSchedule, s.Cfg.NumNodes)
+	if err != nil {
+		return err
+	}
+	for _, change := range partitionChanges {
+		s.ScheduleEvent(s.StartTime.Add(change.At), EvPartitionChange, PartitionChangeData{Groups: change.Groups})
+	}
+	bursts, err := ParseTxBurstSchedule(s.Cfg.TxBurstSchedule)
+	if err != nil {
+		return err
+	}
+	for _, burst := range bursts {
+		s.ScheduleEvent(s.StartTime.Add(burst.At), EvTxBurst, TxBurstData{Remaining: burst.Count, Interval: burst.Spread / time.Duration(burst.Count)})
+	}
+	s.scheduleChurn()
 
 	if s.Cfg.TransactionRatePerSec > 0 && s.Cfg.TotalInputTransactions > 0 {
 		firstTxDelay := time.Duration(float64(time.Second) / s.Cfg.TransactionRatePerSec)
@@ -128,11 +357,15 @@ func (s *Simulation) Run() {
 	}
 
 	lastProgressLogTime := s.StartTime
-	eventCounter := 0
 	stopReason := "event queue empty"
 
 	for {
 
+		if s.stopNote != "" {
+			stopReason = s.stopNote
+			log.Printf("Simulation stopping at T=%.3fs. Reason: %s.", s.CurrentTime.Sub(s.StartTime).Seconds(), stopReason)
+			break
+		}
 		if s.EventQueue.Len() == 0 {
 			stopReason = "event queue empty"
 			log.Printf("Simulation stopping at T=%.3fs. Reason: %s.", s.CurrentTime.Sub(s.StartTime).Seconds(), stopReason)
@@ -154,12 +387,12 @@ func (s *Simulation) Run() {
 			event.Timestamp = s.CurrentTime
 		}
 		s.CurrentTime = event.Timestamp
-		eventCounter++
+		s.EventCount++
 
-		if s.CurrentTime.Sub(lastProgressLogTime) > 20*time.Second || eventCounter%10000 == 0 {
+		if s.CurrentTime.Sub(lastProgressLogTime) > 20*time.Second || s.EventCount%10000 == 0 {
 			log.Printf("T=%.3fs/%.3fs | Events: %d | Queue: %d | Injected Txs: %d/%d | Stale Blocks(G): %d",
 				s.CurrentTime.Sub(s.StartTime).Seconds(), s.Cfg.SimulationDuration.Seconds(),
-				eventCounter, s.EventQueue.Len(), s.TxSource.GeneratedCount, s.Cfg.TotalInputTransactions, s.GlobalStaleCount)
+				s.EventCount, s.EventQueue.Len(), s.TxSource.GeneratedCount, s.Cfg.TotalInputTransactions, s.GlobalStaleCount)
 			lastProgressLogTime = s.CurrentTime
 		}
 
@@ -168,44 +401,109 @@ func (s *Simulation) Run() {
 			s.handleInjectTransaction()
 		case EvReceiveTransaction:
 			data := event.Data.(ReceiveTransactionData)
-			if node, ok := s.Nodes[data.TargetNodeID]; ok {
-				node.ReceiveTransaction(data.Tx)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveTransaction(data.Tx, data.FromNodeID)
 			}
 		case EvAttemptMining:
 			data := event.Data.(AttemptMiningData)
-			if node, ok := s.Nodes[data.MinerNodeID]; ok {
+			if node, ok := s.onlineNode(data.MinerNodeID); ok {
 				node.AttemptMining(data)
 			}
 		case EvBlockFound:
 			data := event.Data.(BlockFoundData)
-			if node, ok := s.Nodes[data.MinerNodeID]; ok {
+			if node, ok := s.onlineNode(data.MinerNodeID); ok {
 				node.ProcessFoundBlock(data, event)
 			}
 		case EvReceiveBlock:
 			data := event.Data.(ReceiveBlockData)
-			if node, ok := s.Nodes[data.TargetNodeID]; ok {
-				node.ReceiveBlock(data.Block)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveBlock(data.Block, data.FromNodeID)
+			}
+		case EvInv:
+			data := event.Data.(InvData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveInv(data)
+			}
+		case EvGetData:
+			data := event.Data.(InvData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveGetData(data)
 			}
+		case EvNotFound:
+			data := event.Data.(InvData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveNotFound(data)
+			}
+		case EvHeaders:
+			data := event.Data.(HeadersData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveHeaders(data)
+			}
+		case EvCmpctBlock:
+			data := event.Data.(CompactBlockData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveCompactBlock(data)
+			}
+		case EvGetBlockTxn:
+			data := event.Data.(GetBlockTxnData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveGetBlockTxn(data)
+			}
+		case EvBlockTxn:
+			data := event.Data.(CompactBlockData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveBlockTxn(data)
+			}
+		case EvGetHeaders:
+			data := event.Data.(GetHeadersData)
+			if node, ok := s.onlineNode(data.TargetNodeID); ok {
+				node.ReceiveGetHeaders(data)
+			}
+		case EvRequestTimeout:
+			data := event.Data.(RequestTimeoutData)
+			if node, ok := s.onlineNode(data.NodeID); ok {
+				node.handleRequestTimeout(data, event)
+			}
+		case EvNodeDown:
+			s.handleNodeDown(event.Data.(NodeChurnData))
+		case EvNodeUp:
+			s.handleNodeUp(event.Data.(NodeChurnData))
+		case EvPartitionChange:
+			s.handlePartitionChange(event.Data.(PartitionChangeData))
+		case EvHashRateChange:
+			s.handleHashRateChange(event.Data.(HashRateChangeData))
+		case EvTxBurst:
+			s.handleTxBurst(event.Data.(TxBurstData))
 		default:
 			log.Printf("Warning: Unknown event type %d encountered\n", event.Type)
 		}
+		s.recycleEvent(event)
 	}
 
 	log.Printf("Simulation loop finished. Reason: %s. Final Sim Time: %.3f seconds\n", stopReason, s.CurrentTime.Sub(s.StartTime).Seconds())
+	return nil
+}
+
+// handleHashRateChange scales the total network hash rate. Miners that are
+// mid-job redraw their find time, which is exact for the memoryless model.
+func (s *Simulation) handleHashRateChange(data HashRateChangeData) {
+	log.Printf("T=%.3fs Network hash rate changes from x%.2f to x%.2f\n",
+		s.CurrentTime.Sub(s.StartTime).Seconds(), s.HashRateFactor, data.Multiplier)
+	s.HashRateFactor = data.Multiplier
+	for _, minerID := range s.MinerIDs {
+		if node := s.Nodes[minerID]; node.CurrentMiningJob != nil {
+			node.restartMining()
+		}
+	}
 }
 
 func (s *Simulation) handleInjectTransaction() {
 	if s.TxSource.GeneratedCount >= s.TxSource.TotalToGenerate {
 		return
 	}
-	tx, more := s.TxSource.GetNextTransaction(s.CurrentTime)
-	if !more {
+	if !s.injectTransaction() {
 		return
 	}
-	s.AllInputTxHashes[tx.ID] = true
-	s.TxStatus[tx.ID] = &TxMetadata{InjectTime: s.CurrentTime}
-	originNodeID := rand.Intn(s.Cfg.NumNodes)
-	s.ScheduleEventWithPriority(s.CurrentTime, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: originNodeID, Tx: *tx}, 1)
 	if s.TxSource.GeneratedCount < s.TxSource.TotalToGenerate && s.Cfg.TransactionRatePerSec > 0 {
 		nextInjectDelay := time.Duration(float64(time.Second) / s.Cfg.TransactionRatePerSec)
 		nextInjectTime := s.CurrentTime.Add(nextInjectDelay)
@@ -214,3 +512,80 @@ func (s *Simulation) handleInjectTransaction() {
 		}
 	}
 }
+
+// injectTransaction hands the next transaction from the source to a random
+// online node. It reports false once the source is exhausted.
+func (s *Simulation) injectTransaction() bool {
+	tx, more := s.TxSource.GetNextTransaction(s.CurrentTime)
+	if !more {
+		return false
+	}
+	s.AllInputTxHashes[tx.ID] = true
+	s.TxStatus[tx.ID] = &TxMetadata{InjectTime: s.CurrentTime, FeeRate: tx.FeeRate()}
+	originNodeID := s.nearestOnline(s.Rand.Tx.Intn(s.Cfg.NumNodes))
+	s.ScheduleEventWithPriority(s.CurrentTime, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: originNodeID, FromNodeID: -1, Tx: tx}, 1)
+	if s.Cfg.DoubleSpendRate > 0 && s.Rand.Tx.Float64() < s.Cfg.DoubleSpendRate {
+		s.injectDoubleSpend(*tx)
+	}
+	return true
+}
+
+// TxBurst injects Count transactions on top of the regular rate, evenly
+// spread over Spread from At.
+type TxBurst struct {
+	At     time.Duration
+	Count  int
+	Spread time.Duration
+}
+
+// ParseTxBurstSchedule parses "2h:500/10m,5h:100/0s" style schedules.
+func ParseTxBurstSchedule(spec string) ([]TxBurst, error) {
+	bursts := []TxBurst{}
+	if strings.TrimSpace(spec) == "" {
+		return bursts, nil
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid tx burst %q (expected <time>:<count>/<spread>)", entry)
+		}
+		at, err := time.ParseDuration(parts[0])
+		if err != nil || at < 0 {
+			return nil, fmt.Errorf("invalid tx burst time %q", parts[0])
+		}
+		countSpec, spreadSpec, _ := strings.Cut(parts[1], "/")
+		count, err := strconv.Atoi(countSpec)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid tx burst count %q", countSpec)
+		}
+		spread := time.Duration(0)
+		if spreadSpec != "" {
+			if spread, err = time.ParseDuration(spreadSpec); err != nil || spread < 0 {
+				return nil, fmt.Errorf("invalid tx burst spread %q", spreadSpec)
+			}
+		}
+		bursts = append(bursts, TxBurst{At: at, Count: count, Spread: spread})
+	}
+	return bursts, nil
+}
+
+// handleTxBurst injects one burst transaction. Bursts come on top of
+// TotalInputTransactions, so each raises the source's total by one.
+func (s *Simulation) handleTxBurst(data TxBurstData) {
+	s.TxSource.TotalToGenerate++
+	s.injectTransaction()
+	if data.Remaining > 1 {
+		s.ScheduleEvent(s.CurrentTime.Add(data.Interval), EvTxBurst, TxBurstData{Remaining: data.Remaining - 1, Interval: data.Interval})
+	}
+}
+
+// injectDoubleSpend sends a transaction conflicting with tx to a random node.
+func (s *Simulation) injectDoubleSpend(tx Transaction) {
+	conflict, ok := s.TxSource.ConflictingSpend(tx)
+	if !ok {
+		return
+	}
+	s.DoubleSpends[tx.ID] = conflict.ID
+	conflictNodeID := s.nearestOnline(s.Rand.Tx.Intn(s.Cfg.NumNodes))
+	s.ScheduleEventWithPriority(s.CurrentTime, EvReceiveTransaction, ReceiveTransactionData{TargetNodeID: conflictNodeID, FromNodeID: -1, Tx: &conflict}, 1)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// testConfig is a small network without injected transactions, so tests
+// drive every message themselves.
+func testConfig(nodes, miners int) Config {
+	cfg := DefaultConfig()
+	cfg.NumNodes = nodes
+	cfg.NumMiners = miners
+	cfg.TotalInputTransactions = 0
+	cfg.Seed = 1
+	return cfg
+}
+
+// newTestSimulation validates cfg and sets up its nodes without running the
+// event loop. Log output is discarded for the rest of the test.
+func newTestSimulation(t *testing.T, cfg Config) *Simulation {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	if err := validateConfig(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	sim := NewSimulation(cfg)
+	if err := sim.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	return sim
+}
+
+// childBlock builds a valid block on parent, as node n sees it, found by
+// minerID ten minutes after its parent.
+func childBlock(n *Node, parent string, minerID int, txs ...Transaction) Block {
+	p := n.Blocks[parent]
+	difficulty := n.Sim.Difficulty.NextDifficulty(n.lookupBlock, p)
+	found := p.Header.Timestamp.Add(10 * time.Minute)
+	b := NewBlock(p.Header.Height+1, parent, found, minerID, difficulty, txs)
+	b.FoundTime = found
+	return b
+}
+
+// testTx returns a simple-model transaction of size bytes paying fee.
+func testTx(id string, size int, fee int64) *Transaction {
+	return &Transaction{ID: id, Size: size, Fee: fee, Timestamp: SimulationEpoch}
+}
+
+// queued returns the pending events of type et in the order they were
+// scheduled.
+func queued(sim *Simulation, et EventType) []*Event {
+	events := []*Event{}
+	for _, event := range sim.EventQueue {
+		if event.Type == et {
+			events = append(events, event)
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].seq < events[j].seq })
+	return events
+}
+
+func TestCancelEvent(t *testing.T) {
+	sim := newTestSimulation(t, testConfig(2, 1))
+	events := []*Event{}
+	for i := 0; i < 4; i++ {
+		event := &Event{Timestamp: sim.CurrentTime.Add(time.Duration(i) * time.Second), Type: EvTxBurst, Data: i}
+		sim.PushEvent(event)
+		events = append(events, event)
+	}
+	if !sim.CancelEvent(events[1]) {
+		t.Error("CancelEvent of a queued event = false")
+	}
+	if sim.CancelEvent(events[1]) {
+		t.Error("CancelEvent of a cancelled event = true")
+	}
+	if sim.CancelEvent(nil) {
+		t.Error("CancelEvent(nil) = true")
+	}
+	popped := heap.Pop(&sim.EventQueue).(*Event)
+	if sim.CancelEvent(popped) {
+		t.Error("CancelEvent of a dispatched event = true")
+	}
+	order := []interface{}{popped.Data}
+	for _, event := range queued(sim, EvTxBurst) {
+		order = append(order, event.Data)
+	}
+	if fmt.Sprint(order) != "[0 2 3]" {
+		t.Errorf("events left = %v, want [0 2 3]", order)
+	}
+}
+
+// TestRestartMiningCancelsOldJob checks that a new tip removes the pending
+// block-found event of the old mining job, and that a stale job is ignored.
+func TestRestartMiningCancelsOldJob(t *testing.T) {
+	sim := newTestSimulation(t, testConfig(2, 1))
+	miner := sim.Nodes[sim.MinerIDs[0]]
+	genesis := sim.GenesisBlock.Hash
+	miner.AttemptMining(AttemptMiningData{MinerNodeID: miner.ID, ParentBlockHash: genesis, Height: 1})
+	job := miner.CurrentMiningJob
+	if job == nil || len(queued(sim, EvBlockFound)) != 1 {
+		t.Fatal("no mining job queued")
+	}
+	miner.ReceiveBlock(childBlock(miner, genesis, 1-miner.ID), 1-miner.ID)
+	if miner.CurrentMiningJob == job || len(queued(sim, EvBlockFound)) != 0 {
+		t.Errorf("the old job is still current or queued after the tip moved")
+	}
+	miner.ProcessFoundBlock(job.Data.(BlockFoundData), job)
+	if miner.Stats.MinedBlocks != 0 {
+		t.Error("a cancelled job produced a block")
+	}
+}
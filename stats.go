@@ -0,0 +1,101 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+type LatencySummary struct {
+	Count  int
+	Mean   time.Duration
+	Median time.Duration
+	P90    time.Duration
+	P99    time.Duration
+}
+
+func summarizeDurations(samples []time.Duration) LatencySummary {
+	summary := LatencySummary{Count: len(samples)}
+	if len(samples) == 0 {
+		return summary
+	}
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	summary.Mean = total / time.Duration(len(sorted))
+	summary.Median = percentile(sorted, 50)
+	summary.P90 = percentile(sorted, 90)
+	summary.P99 = percentile(sorted, 99)
+	return summary
+}
+
+// percentile uses the nearest-rank method on an already sorted slice.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100.0*float64(len(sorted)) + 0.999999)
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// SampleSummary is the mean of independent replications of a metric with the
+// half-width of its 95% Student-t confidence interval.
+type SampleSummary struct {
+	N      int
+	Mean   float64
+	StdDev float64
+	CI95   float64
+}
+
+// summarizeSamples ignores NaN samples, which mark runs where the metric was
+// undefined.
+func summarizeSamples(samples []float64) SampleSummary {
+	var summary SampleSummary
+	sum := 0.0
+	for _, x := range samples {
+		if !math.IsNaN(x) {
+			summary.N++
+			sum += x
+		}
+	}
+	if summary.N == 0 {
+		summary.Mean = math.NaN()
+		return summary
+	}
+	summary.Mean = sum / float64(summary.N)
+	if summary.N < 2 {
+		return summary
+	}
+	squares := 0.0
+	for _, x := range samples {
+		if !math.IsNaN(x) {
+			squares += (x - summary.Mean) * (x - summary.Mean)
+		}
+	}
+	summary.StdDev = math.Sqrt(squares / float64(summary.N-1))
+	summary.CI95 = studentT975(summary.N-1) * summary.StdDev / math.Sqrt(float64(summary.N))
+	return summary
+}
+
+// studentT975 is the 97.5th percentile of Student's t distribution with df
+// degrees of freedom, falling back to the normal value for large df.
+func studentT975(df int) float64 {
+	table := []float64{12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+		2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+		2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042}
+	if df >= 1 && df <= len(table) {
+		return table[df-1]
+	}
+	return 1.96
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	TxSelectionFeeRate = "feerate"
+	TxSelectionRandom  = "random"
+)
+
+const (
+	StrategyHonest     = "honest"
+	StrategyEmptyBlock = "empty"
+	StrategySelfish    = "selfish"
+)
+
+// MinerStrategy decides how a mining node behaves. The node owns the block
+// tree, mempool and fork choice; the strategy only answers the four mining
+// questions below and is told about blocks other miners produce.
+type MinerStrategy interface {
+	Name() string
+	// ShouldStartMining reports whether the miner should start a new job now.
+	// It is asked again whenever the tip changes or a transaction arrives
+	// while the miner is waiting.
+	ShouldStartMining(n *Node) bool
+	// SelectParent returns the hash of the block to mine on.
+	SelectParent(n *Node) string
+	// SelectTransactions builds the block template from the mempool.
+	SelectTransactions(n *Node, maxBytes int) []Transaction
+	// OnBlockFound handles a block this miner just found.
+	OnBlockFound(n *Node, b Block)
+	// OnBlockReceived is called after the node accepted a block found by
+	// another miner.
+	OnBlockReceived(n *Node, b Block)
+}
+
+func NewMinerStrategy(name string, cfg *Config) (MinerStrategy, error) {
+	honest := &HonestStrategy{FillThreshold: cfg.MiningFillThreshold, Selection: cfg.TxSelection}
+	switch name {
+	case StrategyHonest:
+		return honest, nil
+	case StrategyEmptyBlock:
+		return &EmptyBlockStrategy{HonestStrategy: honest}, nil
+	case StrategySelfish:
+		return NewSelfishStrategy(honest), nil
+	}
+	return nil, fmt.Errorf("unknown miner strategy %q", name)
+}
+
+// HonestStrategy is the default miner: it waits until the mempool holds
+// FillThreshold of a block's worth of bytes, mines on the best tip, fills the
+// block highest fee rate first (or in random order), and publishes found
+// blocks immediately.
+type HonestStrategy struct {
+	FillThreshold float64
+	Selection     string
+	// RefreshTemplates restarts the mining job whenever a transaction enters
+	// the mempool, so it is included at once. Under the exponential mining
+	// model restarting does not change when the next block is found.
+	RefreshTemplates bool
+}
+
+func (s *HonestStrategy) Name() string { return StrategyHonest }
+
+func (s *HonestStrategy) ShouldStartMining(n *Node) bool {
+	requiredBytesFloat := float64(n.Cfg.BlockSizeLimitBytes) * s.FillThreshold
+
+	if requiredBytesFloat <= 0 {
+		return true
+	}
+
+	return float64(n.mempoolBytes) >= requiredBytesFloat
+}
+
+func (s *HonestStrategy) SelectParent(n *Node) string {
+	return n.BestChainTip
+}
+
+func (s *HonestStrategy) SelectTransactions(n *Node, maxBytes int) []Transaction {
+	n.expireMempool()
+	mempoolTxs := make([]Transaction, 0, len(n.Mempool))
+	for _, tx := range n.Mempool {
+		mempoolTxs = append(mempoolTxs, *tx)
+	}
+	sort.Slice(mempoolTxs, func(i, j int) bool { return mempoolTxs[i].ID < mempoolTxs[j].ID })
+	if s.Selection == TxSelectionRandom {
+		n.Sim.Rand.Mining.Shuffle(len(mempoolTxs), func(i, j int) { mempoolTxs[i], mempoolTxs[j] = mempoolTxs[j], mempoolTxs[i] })
+	} else {
+		sortByFeeRate(mempoolTxs)
+	}
+	return n.Ledger.PackBlock(mempoolTxs, maxBytes)
+}
+
+func (s *HonestStrategy) OnBlockFound(n *Node, b Block) {
+	n.ReceiveBlock(b, -1)
+}
+
+func (s *HonestStrategy) OnBlockReceived(n *Node, b Block) {}
+
+// sortByFeeRate orders transactions highest fee rate first, keeping the
+// existing order between equal rates.
+func sortByFeeRate(txs []Transaction) {
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].FeeRate() > txs[j].FeeRate() })
+}
+
+// EmptyBlockStrategy mines immediately on every new tip and never includes
+// transactions, like pools that skip validation to save propagation time.
+type EmptyBlockStrategy struct {
+	*HonestStrategy
+}
+
+func (s *EmptyBlockStrategy) Name() string { return StrategyEmptyBlock }
+
+func (s *EmptyBlockStrategy) ShouldStartMining(n *Node) bool { return true }
+
+func (s *EmptyBlockStrategy) SelectTransactions(n *Node, maxBytes int) []Transaction {
+	return []Transaction{}
+}
@@ -0,0 +1,431 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepAxis is one dimension of a sweep grid. Linked flags take their values
+// together: "find_time_min:find_time_max=1m:3m,5m:7m" is an axis of two
+// points, not four.
+type sweepAxis struct {
+	Flags  []string
+	Values [][]string
+}
+
+func parseSweepAxis(spec string) (sweepAxis, error) {
+	eq := strings.Index(spec, "=")
+	if eq <= 0 || eq == len(spec)-1 {
+		return sweepAxis{}, fmt.Errorf("invalid -vary %q (expected <flag>=<value>,<value>,... or <flag>:<flag>=<value>:<value>,...)", spec)
+	}
+	axis := sweepAxis{Flags: strings.Split(spec[:eq], ":")}
+	for _, item := range strings.Split(spec[eq+1:], ",") {
+		values := strings.Split(item, ":")
+		if len(values) != len(axis.Flags) {
+			return sweepAxis{}, fmt.Errorf("value %q of -vary %q needs %d ':'-separated parts", item, spec, len(axis.Flags))
+		}
+		axis.Values = append(axis.Values, values)
+	}
+	return axis, nil
+}
+
+// sweepAxes collects repeated -vary flags.
+type sweepAxes []sweepAxis
+
+func (a *sweepAxes) String() string {
+	return fmt.Sprintf("%d axes", len(*a))
+}
+
+func (a *sweepAxes) Set(spec string) error {
+	axis, err := parseSweepAxis(spec)
+	if err != nil {
+		return err
+	}
+	*a = append(*a, axis)
+	return nil
+}
+
+type sweepSetting struct {
+	Flag  string
+	Value string
+}
+
+// SweepPoint is one grid point: the base configuration with one value set
+// for every axis.
+type SweepPoint struct {
+	Settings []sweepSetting
+	Cfg      Config
+}
+
+func (p SweepPoint) label() string {
+	parts := []string{}
+	for _, s := range p.Settings {
+		parts = append(parts, s.Flag+"="+s.Value)
+	}
+	if len(parts) == 0 {
+		return "base"
+	}
+	return strings.Join(parts, " ")
+}
+
+// expandSweepGrid builds the cross product of the axes over base, setting
+// each value through the command-line flag of the same name so that it is
+// parsed exactly as on the command line. Every point must pass validation.
+func expandSweepGrid(base Config, axes []sweepAxis) ([]SweepPoint, error) {
+	points := []SweepPoint{{Cfg: base}}
+	for _, axis := range axes {
+		next := []SweepPoint{}
+		for _, point := range points {
+			for _, values := range axis.Values {
+				p := SweepPoint{Settings: append([]sweepSetting{}, point.Settings...), Cfg: point.Cfg}
+				fs := flag.NewFlagSet("sweep", flag.ContinueOnError)
+				fs.SetOutput(io.Discard)
+				registerConfigFlags(fs, &p.Cfg)
+				for i, name := range axis.Flags {
+					if fs.Lookup(name) == nil {
+						return nil, fmt.Errorf("-vary: unknown flag %q", name)
+					}
+					if err := fs.Set(name, values[i]); err != nil {
+						return nil, fmt.Errorf("-vary %s=%s: %w", name, values[i], err)
+					}
+					p.Settings = append(p.Settings, sweepSetting{Flag: name, Value: values[i]})
+				}
+				next = append(next, p)
+			}
+		}
+		points = next
+	}
+	for i := range points {
+		if err := validateConfig(&points[i].Cfg); err != nil {
+			return nil, fmt.Errorf("grid point %s: %w", points[i].label(), err)
+		}
+		if points[i].Cfg.AttackTrials > 0 {
+			return nil, fmt.Errorf("grid point %s: sweeps run regular simulations, not double-spend trials", points[i].label())
+		}
+	}
+	return points, nil
+}
+
+type metric struct {
+	Name  string
+	Value float64
+}
+
+// collectMetrics returns the headline results of a finished run. A metric
+// that is undefined for the run, such as a latency with no samples, is NaN.
+func collectMetrics(sim *Simulation) []metric {
+	metrics := []metric{}
+	add := func(name string, value float64) {
+		metrics = append(metrics, metric{Name: name, Value: value})
+	}
+	seconds := func(d time.Duration, samples int) float64 {
+		if samples == 0 {
+			return math.NaN()
+		}
+		return d.Seconds()
+	}
+
+	mainChain, err := getMainChainBlocks(sim, sim.ReferenceNodeID)
+	if err != nil {
+		mainChain = nil
+	}
+	blocks := 0
+	if len(mainChain) > 0 {
+		blocks = len(mainChain) - 1
+	}
+	add("main_chain_blocks", float64(blocks))
+	interval := math.NaN()
+	if avg, err := calculateAverageBlockInterval(mainChain); err == nil {
+		interval = avg.Seconds()
+	}
+	add("block_interval_s", interval)
+	add("block_throughput_tps", calculateBlockBasedThroughput(mainChain, sim.Cfg))
+	add("stale_blocks", float64(sim.GlobalStaleCount))
+	staleRate := math.NaN()
+	if len(mainChain) > 1 {
+		stale := len(sim.Nodes[sim.ReferenceNodeID].Blocks) - len(mainChain)
+		staleRate = float64(stale) / float64(stale+len(mainChain)-1)
+	}
+	add("stale_rate", staleRate)
+
+	p50 := summarizeDurations(sim.BlockPropagation50)
+	p90 := summarizeDurations(sim.BlockPropagation90)
+	add("propagation_50_mean_s", seconds(p50.Mean, p50.Count))
+	add("propagation_90_mean_s", seconds(p90.Mean, p90.Count))
+
+	inclusion := []time.Duration{}
+	confirmation := []time.Duration{}
+	for _, meta := range sim.TxStatus {
+		if !meta.FirstBlockTime.IsZero() {
+			inclusion = append(inclusion, meta.FirstBlockTime.Sub(meta.InjectTime))
+		}
+		if meta.IsConfirmed {
+			confirmation = append(confirmation, meta.ConfirmedTime.Sub(meta.InjectTime))
+		}
+	}
+	included := summarizeDurations(inclusion)
+	confirmed := summarizeDurations(confirmation)
+	add("inclusion_latency_median_s", seconds(included.Median, included.Count))
+	add("confirmation_latency_median_s", seconds(confirmed.Median, confirmed.Count))
+	confirmedFraction := math.NaN()
+	if len(sim.TxStatus) > 0 {
+		confirmedFraction = float64(confirmed.Count) / float64(len(sim.TxStatus))
+	}
+	add("confirmed_tx_fraction", confirmedFraction)
+
+	var bytesSent int64
+	for _, node := range sim.Nodes {
+		bytesSent += node.Stats.BytesSent
+	}
+	add("bytes_sent_mib", float64(bytesSent)/(1024*1024))
+	add("events", float64(sim.EventCount))
+	return metrics
+}
+
+// SweepRun is one replication of one grid point.
+type SweepRun struct {
+	Point   int
+	Seed    int64
+	Metrics []metric
+}
+
+// RunSweep runs replications of every point on a pool of workers. Run i
+// (point i/replications, replication i%replications) is seeded baseSeed+i,
+// so results do not depend on the number of workers. Simulation logs are
+// discarded while the runs are in progress.
+func RunSweep(points []SweepPoint, replications, workers int, baseSeed int64, progress *log.Logger) ([]SweepRun, error) {
+	runs := make([]SweepRun, len(points)*replications)
+	errs := make([]error, len(runs))
+	for i := range runs {
+		runs[i] = SweepRun{Point: i / replications, Seed: baseSeed + int64(i)}
+	}
+	previous := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(previous)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	done := 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run := &runs[i]
+				cfg := points[run.Point].Cfg
+				cfg.Seed = run.Seed
+				start := time.Now()
+				sim := NewSimulation(cfg)
+				if errs[i] = sim.Run(); errs[i] == nil {
+					run.Metrics = collectMetrics(sim)
+				}
+				mu.Lock()
+				done++
+				progress.Printf("Run %d/%d done in %v: %s (seed %d)\n",
+					done, len(runs), time.Since(start).Round(time.Millisecond), points[run.Point].label(), run.Seed)
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s (seed %d): %w", points[runs[i].Point].label(), runs[i].Seed, err)
+		}
+	}
+	return runs, nil
+}
+
+// SweepResult aggregates the replications of one grid point.
+type SweepResult struct {
+	Point   SweepPoint
+	Seeds   []int64
+	Names   []string
+	Metrics []SampleSummary
+}
+
+func aggregateSweep(points []SweepPoint, runs []SweepRun) []SweepResult {
+	results := make([]SweepResult, len(points))
+	samples := make([][][]float64, len(points))
+	for i := range points {
+		results[i].Point = points[i]
+	}
+	for _, run := range runs {
+		result := &results[run.Point]
+		result.Seeds = append(result.Seeds, run.Seed)
+		if result.Names == nil {
+			for _, m := range run.Metrics {
+				result.Names = append(result.Names, m.Name)
+			}
+			samples[run.Point] = make([][]float64, len(run.Metrics))
+		}
+		for j, m := range run.Metrics {
+			samples[run.Point][j] = append(samples[run.Point][j], m.Value)
+		}
+	}
+	for i := range results {
+		for _, values := range samples[i] {
+			results[i].Metrics = append(results[i].Metrics, summarizeSamples(values))
+		}
+	}
+	return results
+}
+
+func formatSweepValue(x float64) string {
+	if math.IsNaN(x) {
+		return ""
+	}
+	return strconv.FormatFloat(x, 'g', 6, 64)
+}
+
+// writeSweepCSV writes one row per grid point: the swept flags, the number
+// of runs, and the mean and 95% CI half-width of every metric.
+func writeSweepCSV(path string, results []SweepResult) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	header := []string{}
+	for _, s := range results[0].Point.Settings {
+		header = append(header, s.Flag)
+	}
+	header = append(header, "runs")
+	for _, name := range results[0].Names {
+		header = append(header, name+"_mean", name+"_ci95")
+	}
+	w.Write(header)
+	for _, result := range results {
+		row := []string{}
+		for _, s := range result.Point.Settings {
+			row = append(row, s.Value)
+		}
+		row = append(row, strconv.Itoa(len(result.Seeds)))
+		for _, summary := range result.Metrics {
+			ci := math.NaN()
+			if summary.N > 1 {
+				ci = summary.CI95
+			}
+			row = append(row, formatSweepValue(summary.Mean), formatSweepValue(ci))
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+type sweepMetricJSON struct {
+	Name   string   `json:"name"`
+	N      int      `json:"n"`
+	Mean   *float64 `json:"mean"`
+	StdDev float64  `json:"stddev"`
+	CI95   float64  `json:"ci95"`
+}
+
+type sweepPointJSON struct {
+	Settings map[string]string `json:"settings"`
+	Seeds    []int64           `json:"seeds"`
+	Metrics  []sweepMetricJSON `json:"metrics"`
+}
+
+// writeSweepJSON writes the same table as writeSweepCSV, plus each point's
+// seeds and the standard deviation of every metric. Undefined means are null.
+func writeSweepJSON(path string, replications int, results []SweepResult) error {
+	out := struct {
+		Replications int              `json:"replications"`
+		Points       []sweepPointJSON `json:"points"`
+	}{Replications: replications}
+	for _, result := range results {
+		point := sweepPointJSON{Settings: map[string]string{}, Seeds: result.Seeds}
+		for _, s := range result.Point.Settings {
+			point.Settings[s.Flag] = s.Value
+		}
+		for j, summary := range result.Metrics {
+			m := sweepMetricJSON{Name: result.Names[j], N: summary.N, StdDev: summary.StdDev, CI95: summary.CI95}
+			if !math.IsNaN(summary.Mean) {
+				mean := summary.Mean
+				m.Mean = &mean
+			}
+			point.Metrics = append(point.Metrics, m)
+		}
+		out.Points = append(out.Points, point)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// runSweepCommand runs the sweep subcommand: every simulation flag sets the
+// base configuration, and each -vary adds an axis to the grid.
+func runSweepCommand(args []string) {
+	cfg := DefaultConfig()
+	fs := flag.NewFlagSet("sweep", flag.ExitOnError)
+	registerConfigFlags(fs, &cfg)
+	var axes sweepAxes
+	fs.Var(&axes, "vary", "Grid axis as '<flag>=<v1>,<v2>,...', or '<flag>:<flag>=<a1>:<b1>,<a2>:<b2>,...' for flags that change together (repeatable)")
+	replications := fs.Int("reps", 5, "Replications per grid point, each with its own seed")
+	workers := fs.Int("workers", runtime.NumCPU(), "Number of runs in parallel")
+	out := fs.String("out", "sweep", "Output path prefix: writes <out>.csv and <out>.json")
+	scenarioPath := fs.String("scenario", "", "YAML or JSON scenario file for the base configuration (its output section is ignored)")
+	fs.Parse(args)
+
+	if *scenarioPath != "" {
+		scenario, err := LoadScenario(*scenarioPath)
+		if err == nil {
+			err = scenario.Apply(fs, &cfg)
+		}
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if *replications < 1 || *workers < 1 {
+		log.Fatalf("Error: -reps and -workers must be at least 1.")
+	}
+	points, err := expandSweepGrid(cfg, axes)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	if cfg.Seed == 0 {
+		cfg.Seed = time.Now().UnixNano()
+	}
+	log.Printf("--- Sweep: %d grid points x %d replications on %d workers (seeds %d..%d) ---\n",
+		len(points), *replications, *workers, cfg.Seed, cfg.Seed+int64(len(points)**replications)-1)
+
+	start := time.Now()
+	runs, err := RunSweep(points, *replications, *workers, cfg.Seed, log.New(os.Stderr, "", log.LstdFlags))
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	results := aggregateSweep(points, runs)
+	if err := writeSweepCSV(*out+".csv", results); err != nil {
+		log.Fatalf("Error: writing CSV: %v", err)
+	}
+	if err := writeSweepJSON(*out+".json", *replications, results); err != nil {
+		log.Fatalf("Error: writing JSON: %v", err)
+	}
+	log.Printf("Sweep finished in %v. Results: %s.csv, %s.json\n", time.Since(start).Round(time.Millisecond), *out, *out)
+}
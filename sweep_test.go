@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSweepAxis(t *testing.T) {
+	tests := []struct {
+		spec string
+		want sweepAxis
+	}{
+		{"nodes=20,50,100", sweepAxis{Flags: []string{"nodes"}, Values: [][]string{{"20"}, {"50"}, {"100"}}}},
+		{"nodes=20", sweepAxis{Flags: []string{"nodes"}, Values: [][]string{{"20"}}}},
+		{"find_time_min:find_time_max=1m:3m,5m:7m", sweepAxis{
+			Flags:  []string{"find_time_min", "find_time_max"},
+			Values: [][]string{{"1m", "3m"}, {"5m", "7m"}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := parseSweepAxis(tt.spec)
+		if err != nil {
+			t.Errorf("parseSweepAxis(%q): %v", tt.spec, err)
+			continue
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseSweepAxis(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestParseSweepAxisErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"nodes", "expected <flag>=<value>"},
+		{"=20", "expected <flag>=<value>"},
+		{"nodes=", "expected <flag>=<value>"},
+		{"nodes:miners=20:5,50", `value "50" of -vary "nodes:miners=20:5,50" needs 2 ':'-separated parts`},
+		{"nodes=20:5", "needs 1 ':'-separated parts"},
+	}
+	for _, tt := range tests {
+		_, err := parseSweepAxis(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("parseSweepAxis(%q) error = %v, want it to mention %q", tt.spec, err, tt.wantErr)
+		}
+	}
+}
+
+func TestExpandSweepGrid(t *testing.T) {
+	axes := []sweepAxis{}
+	for _, spec := range []string{"nodes:miners=20:5,50:10", "block_size_bytes=524288,1048576,2097152"} {
+		axis, err := parseSweepAxis(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		axes = append(axes, axis)
+	}
+	points, err := expandSweepGrid(DefaultConfig(), axes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 6 {
+		t.Fatalf("got %d grid points, want 6", len(points))
+	}
+	last := points[5]
+	if got := last.label(); got != "nodes=50 miners=10 block_size_bytes=2097152" {
+		t.Errorf("last point label = %q", got)
+	}
+	if last.Cfg.NumNodes != 50 || last.Cfg.NumMiners != 10 || last.Cfg.BlockSizeLimitBytes != 2097152 {
+		t.Errorf("last point config: nodes %d, miners %d, block size %d",
+			last.Cfg.NumNodes, last.Cfg.NumMiners, last.Cfg.BlockSizeLimitBytes)
+	}
+	if points[0].Cfg.NumNodes != 20 || points[0].Cfg.BlockSizeLimitBytes != 524288 {
+		t.Errorf("first point config: nodes %d, block size %d", points[0].Cfg.NumNodes, points[0].Cfg.BlockSizeLimitBytes)
+	}
+}
+
+// TestExpandSweepGridKeepsEarlierAxes checks that setting one axis through the
+// flags leaves values set by earlier axes alone.
+func TestExpandSweepGridKeepsEarlierAxes(t *testing.T) {
+	axes := []sweepAxis{}
+	for _, spec := range []string{"block_interval=5m,20m", "nodes=20,50"} {
+		axis, err := parseSweepAxis(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		axes = append(axes, axis)
+	}
+	base := DefaultConfig()
+	points, err := expandSweepGrid(base, axes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Duration{5 * time.Minute, 5 * time.Minute, 20 * time.Minute, 20 * time.Minute}
+	for i, p := range points {
+		if p.Cfg.TargetBlockInterval != want[i] {
+			t.Errorf("point %s: block interval = %v, want %v", p.label(), p.Cfg.TargetBlockInterval, want[i])
+		}
+	}
+
+	base.TargetBlockInterval = 2 * time.Minute
+	axis, _ := parseSweepAxis("nodes=20,50")
+	points, err = expandSweepGrid(base, []sweepAxis{axis})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range points {
+		if p.Cfg.TargetBlockInterval != 2*time.Minute {
+			t.Errorf("point %s: block interval = %v, want the base's 2m0s", p.label(), p.Cfg.TargetBlockInterval)
+		}
+	}
+}
+
+func TestExpandSweepGridErrors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{"no_such_flag=1,2", `-vary: unknown flag "no_such_flag"`},
+		{"nodes=twenty", "-vary nodes=twenty"},
+		{"miners=5,30", "grid point miners=30"},
+		{"attack_trials=10", "not double-spend trials"},
+	}
+	for _, tt := range tests {
+		axis, err := parseSweepAxis(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = expandSweepGrid(DefaultConfig(), []sweepAxis{axis})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("expandSweepGrid(%q) error = %v, want it to mention %q", tt.spec, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	TopologyRandom     = "random"
+	TopologyRegular    = "regular"
+	TopologyErdosRenyi = "erdos-renyi"
+	TopologyScaleFree  = "scale-free"
+	TopologySmallWorld = "small-world"
+	TopologyStar       = "star"
+	TopologyFile       = "file"
+)
+
+// peerGraph builds the peer connections between the simulation's nodes. Every
+// connection has an initiating (outbound) side and an accepting (inbound) side,
+// and connect refuses connections beyond the configured limits. Nodes below
+// uncapped are hubs and accept any number of inbound connections.
+type peerGraph struct {
+	sim         *Simulation
+	maxOutbound int
+	maxInbound  int
+	uncapped    int
+	outbound    []int
+	inbound     []int
+}
+
+func (g *peerGraph) connect(from, to int) bool {
+	if from == to || contains(g.sim.Nodes[from].Peers, to) {
+		return false
+	}
+	if g.maxOutbound > 0 && g.outbound[from] >= g.maxOutbound {
+		return false
+	}
+	if g.maxInbound > 0 && to >= g.uncapped && g.inbound[to] >= g.maxInbound {
+		return false
+	}
+	g.sim.Nodes[from].AddPeer(to)
+	g.sim.Nodes[to].AddPeer(from)
+	g.outbound[from]++
+	g.inbound[to]++
+	return true
+}
+
+// buildTopology connects the nodes with the generator chosen by cfg.Topology
+// and warns if the resulting graph is not connected.
+func (s *Simulation) buildTopology() error {
+	n := s.Cfg.NumNodes
+	g := &peerGraph{
+		sim:         s,
+		maxOutbound: s.Cfg.MaxOutbound,
+		maxInbound:  s.Cfg.MaxInbound,
+		outbound:    make([]int, n),
+		inbound:     make([]int, n),
+	}
+	switch s.Cfg.Topology {
+	case TopologyRandom:
+		g.random()
+	case TopologyRegular:
+		g.regular(s.Cfg.PeerDegree)
+	case TopologyErdosRenyi:
+		g.erdosRenyi(s.Cfg.PeerDegree)
+	case TopologyScaleFree:
+		g.scaleFree(s.Cfg.PeerDegree)
+	case TopologySmallWorld:
+		g.smallWorld(s.Cfg.PeerDegree, s.Cfg.RewireProb)
+	case TopologyStar:
+		g.star(s.Cfg.Hubs)
+	case TopologyFile:
+		if err := g.loadEdgeList(s.Cfg.TopologyFile); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown topology %q", s.Cfg.Topology)
+	}
+
+	edges, minDegree, maxDegree := 0, n, 0
+	for _, node := range s.Nodes {
+		degree := len(node.Peers)
+		edges += degree
+		if degree < minDegree {
+			minDegree = degree
+		}
+		if degree > maxDegree {
+			maxDegree = degree
+		}
+	}
+	edges /= 2
+	meanDegree := 0.0
+	if n > 0 {
+		meanDegree = 2 * float64(edges) / float64(n)
+	}
+	log.Printf("Peer graph (%s): %d connections | Degree Min %d, Mean %.2f, Max %d\n", s.Cfg.Topology, edges, minDegree, meanDegree, maxDegree)
+	if components, largest := s.peerComponents(); components > 1 {
+		log.Printf("Warning: Peer graph is partitioned into %d components (largest has %d of %d nodes); gossip relay cannot reach every node.\n", components, largest, n)
+	}
+	return nil
+}
+
+// peerComponents returns the number of connected components of the peer graph
+// and the size of the largest.
+func (s *Simulation) peerComponents() (components int, largest int) {
+	visited := make([]bool, s.Cfg.NumNodes)
+	for start := 0; start < s.Cfg.NumNodes; start++ {
+		if visited[start] {
+			continue
+		}
+		components++
+		size := 0
+		queue := []int{start}
+		visited[start] = true
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			size++
+			for _, peerID := range s.Nodes[id].Peers {
+				if !visited[peerID] {
+					visited[peerID] = true
+					queue = append(queue, peerID)
+				}
+			}
+		}
+		if size > largest {
+			largest = size
+		}
+	}
+	return components, largest
+}
+
+// random is the original generator: each node tries to open 3 to 5
+// connections to random nodes and gives up after 2*NumNodes attempts.
+func (g *peerGraph) random() {
+	s := g.sim
+	for i := 0; i < s.Cfg.NumNodes; i++ {
+		numPeersToAttempt := 3 + s.Rand.Topology.Intn(3)
+		peersConnected := 0
+		attemptCounter := 0
+		for peersConnected < numPeersToAttempt && len(s.Nodes[i].Peers) < s.Cfg.NumNodes-1 {
+			peerID := s.Rand.Topology.Intn(s.Cfg.NumNodes)
+			if g.connect(i, peerID) {
+				peersConnected++
+			}
+			attemptCounter++
+			if attemptCounter > s.Cfg.NumNodes*2 {
+				break
+			}
+		}
+	}
+}
+
+// regular pairs up degree connection stubs per node at random. A pair that
+// would be a self-loop or a duplicate connection swaps its second stub with a
+// random later one; stubs that cannot be paired are dropped, so a few nodes
+// may end up one or two peers short.
+func (g *peerGraph) regular(degree int) {
+	n := g.sim.Cfg.NumNodes
+	rng := g.sim.Rand.Topology
+	if degree > n-1 {
+		degree = n - 1
+	}
+	stubs := make([]int, 0, n*degree)
+	for i := 0; i < n; i++ {
+		for d := 0; d < degree; d++ {
+			stubs = append(stubs, i)
+		}
+	}
+	rng.Shuffle(len(stubs), func(i, j int) { stubs[i], stubs[j] = stubs[j], stubs[i] })
+
+	for i := 0; i+1 < len(stubs); i += 2 {
+		for tries := 0; tries < 10 && i+2 < len(stubs); tries++ {
+			a, b := stubs[i], stubs[i+1]
+			if a != b && !contains(g.sim.Nodes[a].Peers, b) {
+				break
+			}
+			j := i + 2 + rng.Intn(len(stubs)-i-2)
+			stubs[i+1], stubs[j] = stubs[j], stubs[i+1]
+		}
+		g.connect(stubs[i], stubs[i+1])
+	}
+}
+
+// erdosRenyi connects each pair of nodes independently with the probability
+// that gives the requested mean degree.
+func (g *peerGraph) erdosRenyi(meanDegree int) {
+	n := g.sim.Cfg.NumNodes
+	rng := g.sim.Rand.Topology
+	if n < 2 {
+		return
+	}
+	p := float64(meanDegree) / float64(n-1)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if rng.Float64() < p {
+				if rng.Intn(2) == 0 {
+					g.connect(i, j)
+				} else {
+					g.connect(j, i)
+				}
+			}
+		}
+	}
+}
+
+// scaleFree is the Barabási–Albert model: starting from a small clique, each
+// new node opens degree/2 connections to existing nodes chosen with
+// probability proportional to their degree.
+func (g *peerGraph) scaleFree(degree int) {
+	n := g.sim.Cfg.NumNodes
+	rng := g.sim.Rand.Topology
+	m := degree / 2
+	if m < 1 {
+		m = 1
+	}
+	if m >= n {
+		m = n - 1
+	}
+	// The seed clique the graph grows from takes any number of connections,
+	// so a node whose picks are all full can still attach to a seed.
+	g.uncapped = m + 1
+	// endpoints lists every node once per connection it has, so a uniform
+	// pick from it is a degree-proportional pick.
+	endpoints := []int{}
+	for i := 0; i <= m && i < n; i++ {
+		for j := 0; j < i; j++ {
+			if g.connect(i, j) {
+				endpoints = append(endpoints, i, j)
+			}
+		}
+	}
+	for i := m + 1; i < n; i++ {
+		connected := 0
+		for attempts := 0; connected < m && attempts < 10*m && len(endpoints) > 0; attempts++ {
+			target := endpoints[rng.Intn(len(endpoints))]
+			if g.connect(i, target) {
+				endpoints = append(endpoints, i, target)
+				connected++
+			}
+		}
+	}
+}
+
+// smallWorld is the Watts–Strogatz model: a ring where each node connects to
+// its degree/2 nearest neighbours on each side, with each of those connections
+// rewired to a random node with probability rewireProb.
+func (g *peerGraph) smallWorld(degree int, rewireProb float64) {
+	n := g.sim.Cfg.NumNodes
+	rng := g.sim.Rand.Topology
+	half := degree / 2
+	if half < 1 {
+		half = 1
+	}
+	for i := 0; i < n; i++ {
+		for j := 1; j <= half; j++ {
+			target := (i + j) % n
+			if rng.Float64() < rewireProb {
+				for attempts := 0; attempts < n; attempts++ {
+					candidate := rng.Intn(n)
+					if candidate != i && !contains(g.sim.Nodes[i].Peers, candidate) {
+						target = candidate
+						break
+					}
+				}
+			}
+			g.connect(i, target)
+		}
+	}
+}
+
+// star makes the first hubs nodes a fully connected relay backbone and
+// connects every other node to each hub, like miners on a relay network.
+func (g *peerGraph) star(hubs int) {
+	n := g.sim.Cfg.NumNodes
+	if hubs > n {
+		hubs = n
+	}
+	g.uncapped = hubs
+	for i := 0; i < hubs; i++ {
+		for j := i + 1; j < hubs; j++ {
+			g.connect(i, j)
+		}
+	}
+	for i := hubs; i < n; i++ {
+		for hub := 0; hub < hubs; hub++ {
+			g.connect(i, hub)
+		}
+	}
+}
+
+// loadEdgeList reads one connection per line as "<from> <to>" (spaces, tabs
+// or commas), with the first node as the initiating side. Connection limits
+// are not applied to an explicit edge list. Blank lines and lines starting
+// with '#' are ignored.
+func (g *peerGraph) loadEdgeList(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening topology file: %w", err)
+	}
+	defer f.Close()
+
+	g.maxOutbound, g.maxInbound = 0, 0
+	n := g.sim.Cfg.NumNodes
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' })
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected '<from> <to>'", path, lineNum)
+		}
+		var ends [2]int
+		for i, field := range fields {
+			id, err := strconv.Atoi(field)
+			if err != nil || id < 0 || id >= n {
+				return fmt.Errorf("%s:%d: invalid node ID %q (expected 0..%d)", path, lineNum, field, n-1)
+			}
+			ends[i] = id
+		}
+		g.connect(ends[0], ends[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading topology file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+// testGraph returns an empty peer graph over n bare nodes.
+func testGraph(n, maxOutbound, maxInbound int) *peerGraph {
+	cfg := DefaultConfig()
+	cfg.NumNodes = n
+	s := &Simulation{Cfg: &cfg, Nodes: make(map[int]*Node), Rand: NewRandStreams(1)}
+	for i := 0; i < n; i++ {
+		s.Nodes[i] = &Node{ID: i}
+	}
+	return &peerGraph{
+		sim:         s,
+		maxOutbound: maxOutbound,
+		maxInbound:  maxInbound,
+		outbound:    make([]int, n),
+		inbound:     make([]int, n),
+	}
+}
+
+func TestStarHubsIgnoreInboundLimit(t *testing.T) {
+	g := testGraph(50, 8, 5)
+	g.star(2)
+	for hub := 0; hub < 2; hub++ {
+		if peers := len(g.sim.Nodes[hub].Peers); peers != 49 {
+			t.Errorf("hub %d has %d peers, want 49", hub, peers)
+		}
+	}
+	if components, _ := g.sim.peerComponents(); components != 1 {
+		t.Errorf("star graph has %d components, want 1", components)
+	}
+}
+
+func TestScaleFreeCapsInboundBeyondSeeds(t *testing.T) {
+	g := testGraph(300, 8, 6)
+	g.scaleFree(8)
+	for i := g.uncapped; i < 300; i++ {
+		if g.inbound[i] > 6 {
+			t.Errorf("node %d accepted %d connections, want at most 6", i, g.inbound[i])
+		}
+	}
+	if components, _ := g.sim.peerComponents(); components != 1 {
+		t.Errorf("scale-free graph has %d components, want 1", components)
+	}
+	if g.uncapped != 5 {
+		t.Errorf("uncapped = %d, want the 5 seed nodes", g.uncapped)
+	}
+}
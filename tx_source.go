@@ -12,15 +12,44 @@ type SimpleTxSource struct {
 	GeneratedCount  int
 	StartTime       time.Time
 	Cfg             *Config
+	Rand            *rand.Rand
+	FeeRand         *rand.Rand
+
+	// spendable holds outputs the UTXO model can still spend. New outputs are
+	// added as soon as their transaction is generated, so later transactions
+	// can spend unconfirmed parents.
+	spendable []utxoEntry
+	// contested holds both transactions of each double-spend pair, keyed by
+	// ID. Their outputs only become spendable once one of them confirms, so
+	// no transaction builds on the twin that loses.
+	contested map[string]*Transaction
+	// settled holds the twin of each confirmed transaction that won its
+	// double-spend pair, so a reorg can reopen the contest.
+	settled map[string]*Transaction
+	// accounts tracks each wallet's next nonce and a lower bound on its
+	// balance for the account model. Incoming payments are not counted, so a
+	// sender never relies on funds that are still pending.
+	accounts []accountState
 }
 
-func NewSimpleTxSource(cfg *Config, startTime time.Time) *SimpleTxSource {
-	return &SimpleTxSource{
+func NewSimpleTxSource(cfg *Config, startTime time.Time, rng *rand.Rand, feeRng *rand.Rand) *SimpleTxSource {
+	s := &SimpleTxSource{
 		TotalToGenerate: cfg.TotalInputTransactions,
 		StartTime:       startTime,
 		GeneratedCount:  0,
 		Cfg:             cfg,
+		Rand:            rng,
+		FeeRand:         feeRng,
+		contested:       make(map[string]*Transaction),
+		settled:         make(map[string]*Transaction),
+	}
+	if cfg.TxModel == TxModelAccount {
+		s.accounts = make([]accountState, cfg.NumWallets)
+		for i := range s.accounts {
+			s.accounts[i].Balance = cfg.InitialBalance
+		}
 	}
+	return s
 }
 
 func (s *SimpleTxSource) GetNextTransaction(currentTime time.Time) (*Transaction, bool) {
@@ -36,7 +65,7 @@ func (s *SimpleTxSource) GetNextTransaction(currentTime time.Time) (*Transaction
 
 	var sizeFloat float64
 	if stdDev > 0 {
-		sizeFloat = rand.NormFloat64()*stdDev + mean
+		sizeFloat = s.Rand.NormFloat64()*stdDev + mean
 	} else {
 		sizeFloat = mean
 	}
@@ -46,10 +75,194 @@ func (s *SimpleTxSource) GetNextTransaction(currentTime time.Time) (*Transaction
 
 	size := int(math.Round(sizeFloat))
 	tx := Transaction{
-		ID:        fmt.Sprintf("tx-%d-%d", s.GeneratedCount, rand.Intn(1000000)),
+		ID:        fmt.Sprintf("tx-%d-%d", s.GeneratedCount, s.Rand.Intn(1000000)),
 		Timestamp: currentTime,
 		Data:      "simulated payload data",
 		Size:      size,
+		Fee:       int64(math.Round(s.drawFeeRate() * float64(size))),
+	}
+	switch s.Cfg.TxModel {
+	case TxModelUTXO:
+		s.spendFromWallets(&tx)
+	case TxModelAccount:
+		s.spendFromAccount(&tx)
 	}
 	return &tx, true
 }
+
+// AddSpendable makes the outputs of tx available to future transactions.
+func (s *SimpleTxSource) AddSpendable(tx Transaction) {
+	for i, out := range tx.Outputs {
+		s.spendable = append(s.spendable, utxoEntry{OutPoint: OutPoint{TxID: tx.ID, Index: i}, Output: out})
+	}
+}
+
+// dustLimit is the smallest output value the UTXO model creates, so wallets do
+// not end up with outputs too small to pay for their own spend.
+const dustLimit = 546
+
+// spendFromWallets gives tx one or two random spendable inputs (more if they
+// cannot cover the fee), a payment to a random wallet and change back to the
+// first input's owner. The fee is capped at the input value. If no output is
+// spendable tx gets no inputs, and nodes reject it as invalid.
+func (s *SimpleTxSource) spendFromWallets(tx *Transaction) {
+	numInputs := 1
+	if len(s.spendable) > 1 && s.Rand.Float64() < 0.3 {
+		numInputs = 2
+	}
+	var total int64
+	owner := -1
+	for i := 0; (i < numInputs || total < tx.Fee+dustLimit) && len(s.spendable) > 0; i++ {
+		idx := s.Rand.Intn(len(s.spendable))
+		entry := s.spendable[idx]
+		s.spendable[idx] = s.spendable[len(s.spendable)-1]
+		s.spendable = s.spendable[:len(s.spendable)-1]
+		tx.Inputs = append(tx.Inputs, TxInput{PrevOut: entry.OutPoint})
+		total += entry.Output.Value
+		if owner < 0 {
+			owner = entry.Output.Owner
+		}
+	}
+	if len(tx.Inputs) == 0 {
+		return
+	}
+	if tx.Fee > total {
+		tx.Fee = total
+	}
+	remaining := total - tx.Fee
+	payment := remaining
+	if remaining > dustLimit {
+		payment = dustLimit + s.Rand.Int63n(remaining-dustLimit)
+	}
+	tx.Outputs = append(tx.Outputs, TxOutput{Value: payment, Owner: s.Rand.Intn(s.Cfg.NumWallets)})
+	if change := remaining - payment; change >= dustLimit {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: change, Owner: owner})
+	} else {
+		tx.Outputs[0].Value += change
+	}
+	s.AddSpendable(*tx)
+}
+
+// spendFromAccount sends a random amount, up to half the known balance, from a
+// random wallet to another using the sender's next nonce.
+func (s *SimpleTxSource) spendFromAccount(tx *Transaction) {
+	sender := s.Rand.Intn(len(s.accounts))
+	account := &s.accounts[sender]
+	if tx.Fee > account.Balance {
+		tx.Fee = account.Balance
+	}
+	tx.Sender = sender
+	tx.Recipient = s.Rand.Intn(len(s.accounts))
+	tx.Nonce = account.Nonce
+	if spendable := (account.Balance - tx.Fee) / 2; spendable > 0 {
+		tx.Value = 1 + s.Rand.Int63n(spendable)
+	}
+	account.Nonce++
+	account.Balance -= tx.Value + tx.Fee
+}
+
+// ConflictingSpend returns a transaction that conflicts with tx, paying a
+// different wallet at twice the fee: in the UTXO model it spends the same
+// inputs, in the account model it reuses the nonce. The outputs of tx are
+// taken back out of the spendable pool until ConfirmTx sees either of the two
+// confirmed. It reports false if the model has no notion of conflicts.
+func (s *SimpleTxSource) ConflictingSpend(tx Transaction) (Transaction, bool) {
+	conflict := Transaction{
+		ID:        tx.ID + "-ds",
+		Timestamp: tx.Timestamp,
+		Data:      tx.Data,
+		Size:      tx.Size,
+		Fee:       tx.Fee * 2,
+	}
+	switch {
+	case len(tx.Inputs) > 0:
+		total := tx.outputValue() + tx.Fee
+		if conflict.Fee > total {
+			conflict.Fee = total
+		}
+		conflict.Inputs = tx.Inputs
+		conflict.Outputs = []TxOutput{{Value: total - conflict.Fee, Owner: s.Rand.Intn(s.Cfg.NumWallets)}}
+		s.withholdOutputs(tx.ID)
+		s.contested[tx.ID] = &conflict
+		s.contested[conflict.ID] = &tx
+	case s.Cfg.TxModel == TxModelAccount:
+		// Moving the difference in fee out of the value keeps the total the
+		// sender spends unchanged.
+		if conflict.Fee > tx.Value+tx.Fee {
+			conflict.Fee = tx.Value + tx.Fee
+		}
+		conflict.Sender = tx.Sender
+		conflict.Nonce = tx.Nonce
+		conflict.Recipient = s.Rand.Intn(s.Cfg.NumWallets)
+		conflict.Value = tx.Value + tx.Fee - conflict.Fee
+	default:
+		return Transaction{}, false
+	}
+	return conflict, true
+}
+
+// withholdOutputs removes the outputs of the transaction txID from the
+// spendable pool.
+func (s *SimpleTxSource) withholdOutputs(txID string) {
+	kept := s.spendable[:0]
+	for _, entry := range s.spendable {
+		if entry.OutPoint.TxID != txID {
+			kept = append(kept, entry)
+		}
+	}
+	s.spendable = kept
+}
+
+// ConfirmTx settles the double-spend pair tx belongs to, if any: the outputs
+// of tx become spendable and its twin's never do.
+func (s *SimpleTxSource) ConfirmTx(tx Transaction) {
+	twin, ok := s.contested[tx.ID]
+	if !ok {
+		return
+	}
+	delete(s.contested, tx.ID)
+	delete(s.contested, twin.ID)
+	s.settled[tx.ID] = twin
+	s.AddSpendable(tx)
+}
+
+// UnconfirmTx undoes ConfirmTx for a transaction a reorg took off the chain:
+// the pair is contested again and the unspent outputs of tx are withheld.
+func (s *SimpleTxSource) UnconfirmTx(tx Transaction) {
+	twin, ok := s.settled[tx.ID]
+	if !ok {
+		return
+	}
+	delete(s.settled, tx.ID)
+	s.withholdOutputs(tx.ID)
+	s.contested[tx.ID] = twin
+	s.contested[twin.ID] = &tx
+}
+
+const (
+	FeeDistNone        = "none"
+	FeeDistLognormal   = "lognormal"
+	FeeDistExponential = "exponential"
+	FeeDistUniform     = "uniform"
+)
+
+// drawFeeRate samples a fee rate in sat/byte. FeeRateMedian is the median of
+// the lognormal and exponential distributions; every distribution is clamped
+// to [FeeRateMin, FeeRateMax].
+func (s *SimpleTxSource) drawFeeRate() float64 {
+	var rate float64
+	switch s.Cfg.FeeRateDist {
+	case FeeDistNone:
+		return 0
+	case FeeDistLognormal:
+		rate = s.FeeRand.NormFloat64()*s.Cfg.FeeRateSigma + math.Log(s.Cfg.FeeRateMedian)
+		rate = math.Exp(rate)
+	case FeeDistExponential:
+		rate = s.FeeRand.ExpFloat64() * s.Cfg.FeeRateMedian / math.Ln2
+	case FeeDistUniform:
+		rate = s.Cfg.FeeRateMin + s.FeeRand.Float64()*(s.Cfg.FeeRateMax-s.Cfg.FeeRateMin)
+	}
+	rate = math.Max(s.Cfg.FeeRateMin, rate)
+	rate = math.Min(s.Cfg.FeeRateMax, rate)
+	return rate
+}
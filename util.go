@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"math/rand"
 	"time"
 )
@@ -14,13 +15,19 @@ func contains(slice []int, item int) bool {
 	return false
 }
 
-func CalculateNetworkDelay(cfg *Config) time.Duration {
+// workEqual compares cumulative work with a relative tolerance, since sums of
+// fractional difficulties along different branches can differ by rounding.
+func workEqual(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func CalculateNetworkDelay(cfg *Config, rng *rand.Rand) time.Duration {
 	minDelay := float64(cfg.NetworkDelayMin)
 	maxDelay := float64(cfg.NetworkDelayMax)
 
 	if minDelay >= maxDelay {
 		return cfg.NetworkDelayMin
 	}
-	delay := minDelay + rand.Float64()*(maxDelay-minDelay)
+	delay := minDelay + rng.Float64()*(maxDelay-minDelay)
 	return time.Duration(delay)
 }
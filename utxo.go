@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+type OutPoint struct {
+	TxID  string
+	Index int
+}
+
+type TxInput struct {
+	PrevOut OutPoint
+}
+
+type TxOutput struct {
+	Value int64
+	Owner int
+}
+
+// GenesisFundingTxID is the genesis transaction that creates every wallet's
+// starting coins in the UTXO model.
+const GenesisFundingTxID = "genesis-funding"
+
+type utxoEntry struct {
+	OutPoint OutPoint
+	Output   TxOutput
+}
+
+func genesisFundingTx(cfg *Config, t time.Time) Transaction {
+	tx := Transaction{ID: GenesisFundingTxID, Timestamp: t, Data: "genesis funding"}
+	for wallet := 0; wallet < cfg.NumWallets; wallet++ {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: cfg.InitialBalance, Owner: wallet})
+	}
+	return tx
+}
+
+// UTXOLedger keeps the set of unspent outputs at the node's best tip, plus
+// undo data so blocks can be disconnected on a reorg.
+type UTXOLedger struct {
+	Node          *Node
+	utxos         map[OutPoint]TxOutput
+	undo          map[string][]utxoEntry
+	confirmedTxs  map[string]bool
+	mempoolSpends map[OutPoint]string
+}
+
+func NewUTXOLedger(n *Node) *UTXOLedger {
+	return &UTXOLedger{
+		Node:          n,
+		utxos:         make(map[OutPoint]TxOutput),
+		undo:          make(map[string][]utxoEntry),
+		confirmedTxs:  make(map[string]bool),
+		mempoolSpends: make(map[OutPoint]string),
+	}
+}
+
+func (l *UTXOLedger) ConnectBlock(b Block) error {
+	spent := []utxoEntry{}
+	created := []OutPoint{}
+	// Outputs created and spent within the block are restored and then
+	// deleted again, so restore before deleting.
+	rollback := func() {
+		for _, s := range spent {
+			l.utxos[s.OutPoint] = s.Output
+		}
+		for _, op := range created {
+			delete(l.utxos, op)
+		}
+	}
+
+	for _, tx := range b.Transactions {
+		if len(tx.Inputs) == 0 {
+			if b.Header.Height == 0 && tx.ID == GenesisFundingTxID {
+				for i, out := range tx.Outputs {
+					op := OutPoint{TxID: tx.ID, Index: i}
+					l.utxos[op] = out
+					created = append(created, op)
+				}
+				continue
+			}
+			rollback()
+			return fmt.Errorf("tx %s has no inputs", tx.ID)
+		}
+		var inputValue int64
+		for _, in := range tx.Inputs {
+			out, ok := l.utxos[in.PrevOut]
+			if !ok {
+				rollback()
+				return fmt.Errorf("tx %s spends missing or spent output %s:%d", tx.ID, in.PrevOut.TxID, in.PrevOut.Index)
+			}
+			inputValue += out.Value
+			spent = append(spent, utxoEntry{OutPoint: in.PrevOut, Output: out})
+			delete(l.utxos, in.PrevOut)
+		}
+		if err := checkFee(tx, inputValue); err != nil {
+			rollback()
+			return err
+		}
+		for i, out := range tx.Outputs {
+			op := OutPoint{TxID: tx.ID, Index: i}
+			l.utxos[op] = out
+			created = append(created, op)
+		}
+	}
+	for _, tx := range b.Transactions {
+		l.confirmedTxs[tx.ID] = true
+	}
+	l.undo[b.Hash] = spent
+	return nil
+}
+
+func (l *UTXOLedger) DisconnectBlock(b Block) {
+	for _, s := range l.undo[b.Hash] {
+		l.utxos[s.OutPoint] = s.Output
+	}
+	delete(l.undo, b.Hash)
+	for _, tx := range b.Transactions {
+		delete(l.confirmedTxs, tx.ID)
+		for i := range tx.Outputs {
+			delete(l.utxos, OutPoint{TxID: tx.ID, Index: i})
+		}
+	}
+}
+
+// checkFee requires tx to pay exactly its inputs minus its outputs as fee.
+func checkFee(tx Transaction, inputValue int64) error {
+	if inputValue < tx.outputValue() {
+		return fmt.Errorf("tx %s spends more than its inputs: %w", tx.ID, ErrInvalidTx)
+	}
+	if tx.Fee != inputValue-tx.outputValue() {
+		return fmt.Errorf("tx %s claims a fee of %d but leaves %d: %w", tx.ID, tx.Fee, inputValue-tx.outputValue(), ErrInvalidTx)
+	}
+	return nil
+}
+
+// CheckTx accepts inputs that are unspent on chain or created by a mempool
+// transaction, as long as no other mempool transaction spends them first.
+// Only the genesis funding transaction may create coins without inputs.
+func (l *UTXOLedger) CheckTx(tx Transaction) error {
+	if len(tx.Inputs) == 0 {
+		return fmt.Errorf("tx %s has no inputs: %w", tx.ID, ErrInvalidTx)
+	}
+	var inputValue int64
+	for _, in := range tx.Inputs {
+		if spender, ok := l.mempoolSpends[in.PrevOut]; ok && spender != tx.ID {
+			return ErrConflict
+		}
+		out, ok := l.utxos[in.PrevOut]
+		if !ok {
+			if l.confirmedTxs[in.PrevOut.TxID] {
+				// The parent is on chain but this output is already spent.
+				return ErrConflict
+			}
+			parent, inMempool := l.Node.Mempool[in.PrevOut.TxID]
+			if !inMempool {
+				return &MissingInputsError{ParentID: in.PrevOut.TxID}
+			}
+			if in.PrevOut.Index >= len(parent.Outputs) {
+				return ErrConflict
+			}
+			out = parent.Outputs[in.PrevOut.Index]
+		}
+		inputValue += out.Value
+	}
+	return checkFee(tx, inputValue)
+}
+
+func (l *UTXOLedger) MempoolAdded(tx Transaction) {
+	for _, in := range tx.Inputs {
+		l.mempoolSpends[in.PrevOut] = tx.ID
+	}
+}
+
+func (l *UTXOLedger) MempoolRemoved(tx Transaction) {
+	for _, in := range tx.Inputs {
+		if l.mempoolSpends[in.PrevOut] == tx.ID {
+			delete(l.mempoolSpends, in.PrevOut)
+		}
+	}
+}
+
+func (l *UTXOLedger) MempoolConflicts(b Block) []string {
+	conflicts := []string{}
+	seen := make(map[string]bool)
+	for _, tx := range b.Transactions {
+		for _, in := range tx.Inputs {
+			if spender, ok := l.mempoolSpends[in.PrevOut]; ok && spender != tx.ID && !seen[spender] {
+				seen[spender] = true
+				conflicts = append(conflicts, spender)
+			}
+		}
+	}
+	for i := 0; i < len(conflicts); i++ {
+		for op, spender := range l.mempoolSpends {
+			if op.TxID == conflicts[i] && !seen[spender] {
+				seen[spender] = true
+				conflicts = append(conflicts, spender)
+			}
+		}
+	}
+	return conflicts
+}
+
+// PackBlock makes repeated passes over the candidates so that a child can be
+// included after its parent even when the child pays a higher fee rate.
+func (l *UTXOLedger) PackBlock(candidates []Transaction, maxBytes int) []Transaction {
+	selectedTxs := []Transaction{}
+	currentBlockSizeBytes := 0
+	selected := make(map[string]bool)
+	spent := make(map[OutPoint]bool)
+	created := make(map[OutPoint]bool)
+
+	available := func(op OutPoint) bool {
+		if spent[op] {
+			return false
+		}
+		if _, ok := l.utxos[op]; ok {
+			return true
+		}
+		return created[op]
+	}
+
+	for progress := true; progress; {
+		progress = false
+		for _, tx := range candidates {
+			if selected[tx.ID] || currentBlockSizeBytes+tx.Size > maxBytes {
+				continue
+			}
+			ready := true
+			for _, in := range tx.Inputs {
+				if !available(in.PrevOut) {
+					ready = false
+					break
+				}
+			}
+			if !ready {
+				continue
+			}
+			for _, in := range tx.Inputs {
+				spent[in.PrevOut] = true
+			}
+			for i := range tx.Outputs {
+				created[OutPoint{TxID: tx.ID, Index: i}] = true
+			}
+			selected[tx.ID] = true
+			selectedTxs = append(selectedTxs, tx)
+			currentBlockSizeBytes += tx.Size
+			progress = true
+		}
+	}
+	return selectedTxs
+}
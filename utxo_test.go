@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// utxoTestSim returns a UTXO network with three wallets of 1000 satoshis.
+func utxoTestSim(t *testing.T) *Simulation {
+	t.Helper()
+	cfg := testConfig(3, 1)
+	cfg.TxModel = TxModelUTXO
+	cfg.NumWallets = 3
+	cfg.InitialBalance = 1000
+	return newTestSimulation(t, cfg)
+}
+
+func genesisOut(i int) OutPoint { return OutPoint{TxID: GenesisFundingTxID, Index: i} }
+
+// spendTx spends inputs into outputs of the given values, all owned by wallet
+// 0, and claims fee.
+func spendTx(id string, fee int64, inputs []OutPoint, values ...int64) Transaction {
+	tx := Transaction{ID: id, Size: 200, Fee: fee, Timestamp: SimulationEpoch}
+	for _, in := range inputs {
+		tx.Inputs = append(tx.Inputs, TxInput{PrevOut: in})
+	}
+	for _, v := range values {
+		tx.Outputs = append(tx.Outputs, TxOutput{Value: v})
+	}
+	return tx
+}
+
+func TestUTXOConnectAndDisconnect(t *testing.T) {
+	sim := utxoTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*UTXOLedger)
+	parent := spendTx("parent", 10, []OutPoint{genesisOut(0)}, 600, 390)
+	child := spendTx("child", 20, []OutPoint{{TxID: "parent", Index: 0}}, 580)
+	b := childBlock(n, sim.GenesisBlock.Hash, 1, parent, child)
+	if err := ledger.ConnectBlock(b); err != nil {
+		t.Fatal(err)
+	}
+	for op, want := range map[OutPoint]bool{
+		genesisOut(0): false, genesisOut(1): true,
+		{TxID: "parent", Index: 0}: false, {TxID: "parent", Index: 1}: true, {TxID: "child", Index: 0}: true,
+	} {
+		if _, ok := ledger.utxos[op]; ok != want {
+			t.Errorf("after connecting: output %s:%d unspent = %v, want %v", op.TxID, op.Index, ok, want)
+		}
+	}
+	ledger.DisconnectBlock(b)
+	if len(ledger.utxos) != 3 || ledger.utxos[genesisOut(0)].Value != 1000 || ledger.confirmedTxs["parent"] {
+		t.Errorf("after disconnecting: %d outputs, genesis:0 holds %d; want the 3 genesis outputs back",
+			len(ledger.utxos), ledger.utxos[genesisOut(0)].Value)
+	}
+}
+
+func TestUTXOConnectBlockRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		txs  []Transaction
+	}{
+		{"missing input", []Transaction{spendTx("a", 0, []OutPoint{{TxID: "nowhere"}}, 10)}},
+		{"double spend in block", []Transaction{
+			spendTx("a", 0, []OutPoint{genesisOut(0)}, 1000),
+			spendTx("b", 0, []OutPoint{genesisOut(0)}, 1000),
+		}},
+		{"coins from nothing", []Transaction{spendTx("a", 0, nil, 5000)}},
+		{"overspend", []Transaction{spendTx("a", 0, []OutPoint{genesisOut(0)}, 1001)}},
+		{"fee too high", []Transaction{spendTx("a", 50, []OutPoint{genesisOut(0)}, 990)}},
+		{"fee too low", []Transaction{spendTx("a", 5, []OutPoint{genesisOut(0)}, 990)}},
+	}
+	for _, tt := range tests {
+		sim := utxoTestSim(t)
+		n := sim.Nodes[0]
+		ledger := n.Ledger.(*UTXOLedger)
+		// A valid spend first, so the rollback has something to undo.
+		valid := spendTx("valid", 0, []OutPoint{genesisOut(1)}, 1000)
+		b := childBlock(n, sim.GenesisBlock.Hash, 1, append([]Transaction{valid}, tt.txs...)...)
+		if err := ledger.ConnectBlock(b); err == nil {
+			t.Errorf("%s: ConnectBlock accepted the block", tt.name)
+		}
+		if len(ledger.utxos) != 3 || ledger.utxos[genesisOut(1)].Value != 1000 {
+			t.Errorf("%s: a rejected block left %d outputs behind, want the 3 genesis outputs", tt.name, len(ledger.utxos))
+		}
+	}
+}
+
+func TestUTXOCheckTx(t *testing.T) {
+	sim := utxoTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*UTXOLedger)
+	onChain := spendTx("onchain", 0, []OutPoint{genesisOut(2)}, 1000)
+	if err := ledger.ConnectBlock(childBlock(n, sim.GenesisBlock.Hash, 1, onChain)); err != nil {
+		t.Fatal(err)
+	}
+	pending := spendTx("pending", 10, []OutPoint{genesisOut(0)}, 990)
+	n.addToMempool(&pending, true)
+
+	tests := []struct {
+		name string
+		tx   Transaction
+		want error
+	}{
+		{"valid", spendTx("a", 10, []OutPoint{genesisOut(1)}, 500, 490), nil},
+		{"spends a mempool parent", spendTx("a", 10, []OutPoint{{TxID: "pending"}}, 980), nil},
+		{"conflicts with the mempool", spendTx("a", 20, []OutPoint{genesisOut(0)}, 980), ErrConflict},
+		{"spent on chain", spendTx("a", 0, []OutPoint{genesisOut(2)}, 1000), ErrConflict},
+		{"unknown parent", spendTx("a", 0, []OutPoint{{TxID: "later"}}, 10), ErrMissingInputs},
+		{"no inputs", spendTx("a", 0, nil, 10), ErrInvalidTx},
+		{"fee mismatch", spendTx("a", 0, []OutPoint{genesisOut(1)}, 900), ErrInvalidTx},
+		{"overspend", spendTx("a", 0, []OutPoint{genesisOut(1)}, 1100), ErrInvalidTx},
+	}
+	for _, tt := range tests {
+		err := ledger.CheckTx(tt.tx)
+		if (tt.want == nil) != (err == nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("%s: CheckTx = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestUTXOReorgDropsLosingSpend moves a node to a branch that spends the same
+// output differently: the ledger follows the new branch and the old spend
+// does not return to the mempool.
+func TestUTXOReorgDropsLosingSpend(t *testing.T) {
+	sim := utxoTestSim(t)
+	n := sim.Nodes[0]
+	ledger := n.Ledger.(*UTXOLedger)
+	genesis := sim.GenesisBlock.Hash
+	payMerchant := spendTx("pay-merchant", 10, []OutPoint{genesisOut(0)}, 990)
+	payBack := spendTx("pay-back", 20, []OutPoint{genesisOut(0)}, 980)
+	keep := spendTx("keep", 0, []OutPoint{genesisOut(1)}, 1000)
+
+	a1 := childBlock(n, genesis, 1, payMerchant, keep)
+	n.ReceiveBlock(a1, -1)
+	b1 := childBlock(n, genesis, 2, payBack)
+	n.ReceiveBlock(b1, -1)
+	b2 := childBlock(n, b1.Hash, 2)
+	n.ReceiveBlock(b2, -1)
+
+	if n.BestChainTip != b2.Hash {
+		t.Fatalf("tip = %s, want b2", n.BestChainTip[:6])
+	}
+	if _, ok := ledger.utxos[OutPoint{TxID: "pay-back"}]; !ok {
+		t.Error("the winning spend's output is not in the UTXO set")
+	}
+	if _, ok := ledger.utxos[OutPoint{TxID: "pay-merchant"}]; ok {
+		t.Error("the losing spend's output is still in the UTXO set")
+	}
+	if _, ok := n.Mempool["pay-merchant"]; ok || n.Stats.ConflictingTxDropped != 1 {
+		t.Errorf("losing spend in mempool = %v, %d conflicts dropped; want false, 1", ok, n.Stats.ConflictingTxDropped)
+	}
+	if _, ok := n.Mempool["keep"]; !ok {
+		t.Error("a stale block's transaction that conflicts with nothing did not return to the mempool")
+	}
+}
+
+// TestTxSourceSettlesDoubleSpends follows a double-spend pair through the
+// source: withheld until one twin confirms, reopened when a reorg reverts it.
+func TestTxSourceSettlesDoubleSpends(t *testing.T) {
+	sim := utxoTestSim(t)
+	src := sim.TxSource
+	src.TotalToGenerate = 1
+	tx, _ := src.GetNextTransaction(SimulationEpoch)
+	conflict, ok := src.ConflictingSpend(*tx)
+	if !ok {
+		t.Fatal("no conflicting spend in the UTXO model")
+	}
+	spendable := func(txID string) int {
+		count := 0
+		for _, entry := range src.spendable {
+			if entry.OutPoint.TxID == txID {
+				count++
+			}
+		}
+		return count
+	}
+	if spendable(tx.ID) != 0 || spendable(conflict.ID) != 0 {
+		t.Fatal("outputs of a contested pair are spendable before either confirms")
+	}
+	src.ConfirmTx(conflict)
+	if spendable(conflict.ID) != len(conflict.Outputs) || spendable(tx.ID) != 0 {
+		t.Errorf("after the conflict confirms: %d of its outputs and %d of the original's spendable; want %d and 0",
+			spendable(conflict.ID), spendable(tx.ID), len(conflict.Outputs))
+	}
+	src.UnconfirmTx(conflict)
+	if spendable(conflict.ID) != 0 || src.contested[tx.ID] == nil || src.contested[conflict.ID] == nil {
+		t.Error("a reverted confirmation did not reopen the pair")
+	}
+	src.ConfirmTx(*tx)
+	if spendable(tx.ID) != len(tx.Outputs) || spendable(conflict.ID) != 0 {
+		t.Errorf("after the original confirms instead: %d of its outputs and %d of the conflict's spendable",
+			spendable(tx.ID), spendable(conflict.ID))
+	}
+}